@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/go-gota/gota/dataframe"
+	"github.com/go-gota/gota/series"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+)
+
+// PCA includes the parameters of a fitted principal component
+// analysis, which are saved with a model so that the same
+// projection can be applied at prediction time.
+type PCA struct {
+	Columns    []string    `json:"columns"`
+	Means      []float64   `json:"means"`
+	Scales     []float64   `json:"scales,omitempty"`
+	Components [][]float64 `json:"components"`
+	Variances  []float64   `json:"explained_variance"`
+	Ratios     []float64   `json:"explained_variance_ratio"`
+	Whiten     bool        `json:"whiten"`
+}
+
+func main() {
+
+	// Declare the input and output flags.
+	inPtr := flag.String("in", "../data/iris.csv", "The CSV file containing the features")
+	labelPtr := flag.String("label", "species", "A column to exclude from the features and color the plot by")
+	componentsPtr := flag.Int("components", 0, "The number of components to keep, or 0 to use -variance")
+	variancePtr := flag.Float64("variance", 0.95, "The fraction of variance the kept components should explain")
+	standardizePtr := flag.Bool("standardize", true, "Scale the features to unit variance before fitting")
+	whitenPtr := flag.Bool("whiten", false, "Scale the components to unit variance")
+	modelPtr := flag.String("model", "pca.json", "The output file for the fitted projection")
+	plotPtr := flag.String("plot", "pca.png", "The output file for the 2D scatter plot")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Open the CSV file.
+	f, err := os.Open(*inPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	// Create a dataframe from the CSV file.
+	df := dataframe.ReadCSV(f)
+	if df.Err != nil {
+		log.Fatal(df.Err)
+	}
+
+	// Form a matrix from the numeric feature columns.
+	var names []string
+	for _, name := range df.Names() {
+		t := df.Col(name).Type()
+		if name != *labelPtr && (t == series.Float || t == series.Int) {
+			names = append(names, name)
+		}
+	}
+	x := mat.DenseCopyOf(&matrix{df.Select(names)})
+
+	// Fit the projection.
+	pca, err := FitPCA(x, names, *componentsPtr, *variancePtr, *standardizePtr, *whitenPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Output the explained variance to standard out.
+	fmt.Printf("\nKept %d of %d components\n\n", len(pca.Components), len(names))
+	var cumulative float64
+	for i, ratio := range pca.Ratios {
+		cumulative += ratio
+		fmt.Printf("PC%d: variance %0.4f, ratio %0.4f, cumulative %0.4f\n", i+1, pca.Variances[i], ratio, cumulative)
+	}
+	fmt.Println()
+
+	// Marshal the projection and save it to a file.
+	outputData, err := json.MarshalIndent(pca, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(*modelPtr, outputData, 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	// Project the data and plot the first two components.
+	z := pca.Transform(x)
+
+	var labels []string
+	for _, name := range df.Names() {
+		if name == *labelPtr {
+			labels = df.Col(name).Records()
+		}
+	}
+
+	if _, kept := z.Dims(); kept < 2 {
+		fmt.Println("Skipping the 2D plot as only one component was kept")
+		return
+	}
+
+	if err := ScatterPlot2D(z, labels, *plotPtr); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// matrix wraps a dataframe to implement the mat.Matrix interface.
+type matrix struct {
+	dataframe.DataFrame
+}
+
+func (m matrix) At(i, j int) float64 {
+	return m.Elem(i, j).Float()
+}
+
+func (m matrix) T() mat.Matrix {
+	return mat.Transpose{Matrix: m}
+}
+
+// FitPCA fits the principal components of x. If components is zero, the
+// smallest number of components explaining at least threshold of the
+// variance is kept. If standardize is set the columns are scaled to
+// unit variance first, and if whiten is set the projected components
+// are scaled to unit variance.
+func FitPCA(x *mat.Dense, columns []string, components int, threshold float64, standardize, whiten bool) (*PCA, error) {
+
+	rows, cols := x.Dims()
+	if rows < 2 {
+		return nil, errors.New("at least two rows are required")
+	}
+	if components < 0 || components > cols {
+		return nil, fmt.Errorf("components must be between 0 and %d", cols)
+	}
+
+	pca := PCA{
+		Columns: columns,
+		Means:   make([]float64, cols),
+		Whiten:  whiten,
+	}
+
+	// Center, and optionally scale, each of the columns.
+	if standardize {
+		pca.Scales = make([]float64, cols)
+	}
+	centered := mat.NewDense(rows, cols, nil)
+	for j := 0; j < cols; j++ {
+		col := mat.Col(nil, j, x)
+		mean, std := stat.MeanStdDev(col, nil)
+		pca.Means[j] = mean
+		if standardize {
+			if std == 0 {
+				std = 1
+			}
+			pca.Scales[j] = std
+		}
+		for i, v := range col {
+			v -= mean
+			if standardize {
+				v /= std
+			}
+			centered.Set(i, j, v)
+		}
+	}
+
+	// Calculate the principal components through the SVD.
+	var pc stat.PC
+	if ok := pc.PrincipalComponents(centered, nil); !ok {
+		return nil, errors.New("could not calculate the principal components")
+	}
+	vars := pc.VarsTo(nil)
+	var vecs mat.Dense
+	pc.VectorsTo(&vecs)
+
+	var total float64
+	for _, v := range vars {
+		total += v
+	}
+
+	// Choose the number of components by the variance threshold.
+	if components == 0 {
+		var cumulative float64
+		for components < len(vars) {
+			cumulative += vars[components] / total
+			components++
+			if cumulative >= threshold {
+				break
+			}
+		}
+	}
+
+	for k := 0; k < components; k++ {
+
+		// A component without variance cannot be scaled to unit variance.
+		if whiten && vars[k] <= 1e-12*total {
+			return nil, fmt.Errorf("component %d has no variance and cannot be whitened, keep fewer components", k+1)
+		}
+
+		pca.Components = append(pca.Components, mat.Col(nil, k, &vecs))
+		pca.Variances = append(pca.Variances, vars[k])
+		pca.Ratios = append(pca.Ratios, vars[k]/total)
+	}
+
+	return &pca, nil
+}
+
+// Transform projects the rows of x onto the principal components.
+func (p *PCA) Transform(x mat.Matrix) *mat.Dense {
+
+	rows, cols := x.Dims()
+	z := mat.NewDense(rows, len(p.Components), nil)
+	row := make([]float64, cols)
+	for i := 0; i < rows; i++ {
+		for j := range row {
+			row[j] = x.At(i, j) - p.Means[j]
+			if p.Scales != nil {
+				row[j] /= p.Scales[j]
+			}
+		}
+		for k, comp := range p.Components {
+			var v float64
+			for j, c := range comp {
+				v += row[j] * c
+			}
+			if p.Whiten {
+				v /= math.Sqrt(p.Variances[k])
+			}
+			z.Set(i, k, v)
+		}
+	}
+
+	return z
+}
+
+// InverseTransform maps projected rows back to the original feature
+// space. Any variance in the dropped components is lost.
+func (p *PCA) InverseTransform(z mat.Matrix) *mat.Dense {
+
+	rows, _ := z.Dims()
+	cols := len(p.Means)
+	x := mat.NewDense(rows, cols, nil)
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			var v float64
+			for k, comp := range p.Components {
+				zk := z.At(i, k)
+				if p.Whiten {
+					zk *= math.Sqrt(p.Variances[k])
+				}
+				v += zk * comp[j]
+			}
+			if p.Scales != nil {
+				v *= p.Scales[j]
+			}
+			x.Set(i, j, v+p.Means[j])
+		}
+	}
+
+	return x
+}
+
+// ScatterPlot2D saves a scatter plot of the first two projected
+// components, colored by the labels if any are given.
+func ScatterPlot2D(z mat.Matrix, labels []string, path string) error {
+
+	rows, cols := z.Dims()
+	if cols < 2 {
+		return errors.New("at least two components are required for a 2D plot")
+	}
+
+	// Group the points by label.
+	groups := make(map[string]plotter.XYs)
+	for i := 0; i < rows; i++ {
+		var label string
+		if labels != nil {
+			label = labels[i]
+		}
+		groups[label] = append(groups[label], plotter.XY{X: z.At(i, 0), Y: z.At(i, 1)})
+	}
+
+	var levels []string
+	for label := range groups {
+		levels = append(levels, label)
+	}
+	sort.Strings(levels)
+
+	p, err := plot.New()
+	if err != nil {
+		return err
+	}
+	p.X.Label.Text = "PC1"
+	p.Y.Label.Text = "PC2"
+	p.Add(plotter.NewGrid())
+
+	for k, label := range levels {
+		s, err := plotter.NewScatter(groups[label])
+		if err != nil {
+			return err
+		}
+		s.GlyphStyle.Color = plotutil.Color(k)
+		s.GlyphStyle.Radius = vg.Points(3)
+		p.Add(s)
+		if label != "" {
+			p.Legend.Add(label, s)
+		}
+	}
+
+	return p.Save(6*vg.Inch, 5*vg.Inch, path)
+}
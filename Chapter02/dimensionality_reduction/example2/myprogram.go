@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"strconv"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// PCA includes the parameters of a fitted principal component
+// analysis, which are saved with a model so that the same
+// projection can be applied at prediction time.
+type PCA struct {
+	Columns    []string    `json:"columns"`
+	Means      []float64   `json:"means"`
+	Scales     []float64   `json:"scales,omitempty"`
+	Components [][]float64 `json:"components"`
+	Variances  []float64   `json:"explained_variance"`
+	Ratios     []float64   `json:"explained_variance_ratio"`
+	Whiten     bool        `json:"whiten"`
+}
+
+func main() {
+
+	// Declare the input and output flags.
+	modelPtr := flag.String("model", "../example1/pca.json", "The fitted projection")
+	inPtr := flag.String("in", "../data/iris.csv", "The CSV file to project")
+	outPtr := flag.String("out", "projected.csv", "The output CSV file for the projected rows")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Load the projection.
+	data, err := ioutil.ReadFile(*modelPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var pca PCA
+	if err := json.Unmarshal(data, &pca); err != nil {
+		log.Fatal(err)
+	}
+
+	// Open the CSV file.
+	f, err := os.Open(*inPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	// Read in all of the CSV records.
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Find the columns the projection was fitted on by name,
+	// so that the column order in the file does not matter.
+	colIdx := make(map[string]int)
+	for i, name := range records[0] {
+		colIdx[name] = i
+	}
+
+	x := mat.NewDense(len(records)-1, len(pca.Columns), nil)
+	for j, name := range pca.Columns {
+		idx, ok := colIdx[name]
+		if !ok {
+			log.Fatalf("Expected a column named %s", name)
+		}
+		for i, record := range records[1:] {
+			val, err := strconv.ParseFloat(record[idx], 64)
+			if err != nil {
+				log.Fatalf("Parsing line %d failed, unexpected type", i+2)
+			}
+			x.Set(i, j, val)
+		}
+	}
+
+	// Apply the projection and map the rows back.
+	z := pca.Transform(x)
+	reconstructed := pca.InverseTransform(z)
+
+	// Calculate the reconstruction error.
+	var diff mat.Dense
+	diff.Sub(x, reconstructed)
+	rows, cols := diff.Dims()
+	rmse := mat.Norm(&diff, 2) / math.Sqrt(float64(rows*cols))
+	fmt.Printf("\nProjected %d rows onto %d components\n", rows, len(pca.Components))
+	fmt.Printf("Reconstruction RMSE: %0.4f\n\n", rmse)
+
+	// Save the projected rows to a CSV file.
+	out, err := os.Create(*outPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer out.Close()
+
+	w := csv.NewWriter(out)
+	header := make([]string, len(pca.Components))
+	for k := range header {
+		header[k] = fmt.Sprintf("PC%d", k+1)
+	}
+	if err := w.Write(header); err != nil {
+		log.Fatal(err)
+	}
+
+	for i := 0; i < rows; i++ {
+		record := make([]string, len(pca.Components))
+		for k := range record {
+			record[k] = strconv.FormatFloat(z.At(i, k), 'f', 6, 64)
+		}
+		if err := w.Write(record); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Transform projects the rows of x onto the principal components.
+func (p *PCA) Transform(x mat.Matrix) *mat.Dense {
+
+	rows, cols := x.Dims()
+	z := mat.NewDense(rows, len(p.Components), nil)
+	row := make([]float64, cols)
+	for i := 0; i < rows; i++ {
+		for j := range row {
+			row[j] = x.At(i, j) - p.Means[j]
+			if p.Scales != nil {
+				row[j] /= p.Scales[j]
+			}
+		}
+		for k, comp := range p.Components {
+			var v float64
+			for j, c := range comp {
+				v += row[j] * c
+			}
+			if p.Whiten {
+				v /= math.Sqrt(p.Variances[k])
+			}
+			z.Set(i, k, v)
+		}
+	}
+
+	return z
+}
+
+// InverseTransform maps projected rows back to the original feature
+// space. Any variance in the dropped components is lost.
+func (p *PCA) InverseTransform(z mat.Matrix) *mat.Dense {
+
+	rows, _ := z.Dims()
+	cols := len(p.Means)
+	x := mat.NewDense(rows, cols, nil)
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			var v float64
+			for k, comp := range p.Components {
+				zk := z.At(i, k)
+				if p.Whiten {
+					zk *= math.Sqrt(p.Variances[k])
+				}
+				v += zk * comp[j]
+			}
+			if p.Scales != nil {
+				v *= p.Scales[j]
+			}
+			x.Set(i, j, v+p.Means[j])
+		}
+	}
+
+	return x
+}
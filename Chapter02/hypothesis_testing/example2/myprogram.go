@@ -41,8 +41,11 @@ func main() {
 		Src: nil,
 	}
 
-	// Calculate the p-value for our specific test statistic.
-	pValue := chiDist.Prob(chiSquare)
+	// Calculate the p-value for our specific test statistic. The
+	// p-value is the probability of a test statistic at least this
+	// extreme, which is the upper tail (survival function) of the
+	// distribution rather than its density at this point.
+	pValue := chiDist.Survival(chiSquare)
 
 	// Output the p-value to standard out.
 	fmt.Printf("p-value: %0.4f\n\n", pValue)
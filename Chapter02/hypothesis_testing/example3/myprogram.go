@@ -0,0 +1,755 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// TestResult includes the outcome of a hypothesis test.
+type TestResult struct {
+	Name       string
+	Statistic  float64
+	DF         float64
+	DF2        float64
+	PValue     float64
+	EffectSize float64
+	EffectName string
+}
+
+// reference includes the result of a test along with the
+// published reference values for the same data.
+type reference struct {
+	result    TestResult
+	statistic float64
+	pValue    float64
+	source    string
+}
+
+func main() {
+
+	// The sleep data of Cushny and Peebles (Student, 1908) giving the
+	// extra hours of sleep for 10 patients under two drugs.
+	sleep1 := []float64{0.7, -1.6, -0.2, -1.2, -0.1, 3.4, 3.7, 0.8, 0.0, 2.0}
+	sleep2 := []float64{1.9, 0.8, 1.1, 0.1, -0.1, 4.4, 5.5, 1.6, 4.6, 3.4}
+
+	// The PlantGrowth data (Dobson, 1983) giving plant weights under a
+	// control and two treatment conditions.
+	ctrl := []float64{4.17, 5.58, 5.18, 6.11, 4.50, 4.61, 5.17, 4.53, 5.33, 5.14}
+	trt1 := []float64{4.81, 4.17, 4.41, 3.59, 5.87, 3.83, 6.03, 4.89, 4.32, 4.69}
+	trt2 := []float64{6.31, 5.12, 5.54, 5.50, 5.37, 5.29, 4.92, 6.15, 5.80, 5.26}
+
+	// Run each of the tests and collect the results alongside the
+	// reference values published for the same data.
+	var refs []reference
+
+	chiGOF, err := ChiSquareGoodnessOfFit(
+		[]float64{260, 135, 105},
+		[]float64{300, 125, 75},
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	refs = append(refs, reference{chiGOF, 18.1333, 1.1545e-04, "exact: p = exp(-x/2) for 2 df"})
+
+	chiInd, err := ChiSquareIndependence([][]float64{
+		{762, 327, 468},
+		{484, 239, 477},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	refs = append(refs, reference{chiInd, 30.07, 2.954e-07, "R chisq.test (Agresti 2007)"})
+
+	oneT, err := OneSampleTTest(sleep1, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	refs = append(refs, reference{oneT, 1.3257, 0.2176, "R t.test(sleep group 1)"})
+
+	twoT, err := TwoSampleTTest(sleep1, sleep2)
+	if err != nil {
+		log.Fatal(err)
+	}
+	refs = append(refs, reference{twoT, -1.8608, 0.07919, "R t.test(var.equal = TRUE)"})
+
+	welchT, err := WelchTTest(sleep1, sleep2)
+	if err != nil {
+		log.Fatal(err)
+	}
+	refs = append(refs, reference{welchT, -1.8608, 0.07939, "R t.test(sleep)"})
+
+	pairedT, err := PairedTTest(sleep1, sleep2)
+	if err != nil {
+		log.Fatal(err)
+	}
+	refs = append(refs, reference{pairedT, -4.0621, 0.002833, "R t.test(paired = TRUE)"})
+
+	mwu, err := MannWhitneyU(
+		[]float64{0.80, 0.83, 1.89, 1.04, 1.45, 1.38, 1.91, 1.64, 0.73, 1.46},
+		[]float64{1.15, 0.88, 0.90, 0.74, 1.21},
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	refs = append(refs, reference{mwu, 35, 0.2544, "R wilcox.test (Hollander & Wolfe)"})
+
+	ks, err := KolmogorovSmirnov(
+		[]float64{0.02, 0.05, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.726},
+		distuv.Uniform{Min: 0, Max: 1}.CDF,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	refs = append(refs, reference{ks, 0.274, 1 - 0.6284796154565043, "K(10, .274) (Marsaglia et al. 2003)"})
+
+	ks2, err := KolmogorovSmirnovTwoSample([]float64{1, 2, 3}, []float64{2.5, 4, 5})
+	if err != nil {
+		log.Fatal(err)
+	}
+	refs = append(refs, reference{ks2, 2.0 / 3.0, 0.6, "exact: 12 of 20 arrangements"})
+
+	anova, err := OneWayANOVA(ctrl, trt1, trt2)
+	if err != nil {
+		log.Fatal(err)
+	}
+	refs = append(refs, reference{anova, 4.846, 0.01591, "R aov(weight ~ group, PlantGrowth)"})
+
+	// Output the results to standard out, checking each
+	// against its reference values.
+	var failed int
+	fmt.Printf("\n%-22s %10s %10s %12s %12s %10s %6s  %s\n", "test", "statistic", "reference", "p-value", "reference", "effect", "check", "source")
+	for _, ref := range refs {
+		r := ref.result
+		check := "ok"
+		if !approxEqual(r.Statistic, ref.statistic) || !approxEqual(r.PValue, ref.pValue) {
+			check = "FAIL"
+			failed++
+		}
+		fmt.Printf("%-22s %10.4f %10.4f %12.4g %12.4g %10.4f %6s  %s (%s)\n",
+			r.Name, r.Statistic, ref.statistic, r.PValue, ref.pValue, r.EffectSize, check, ref.source, r.EffectName)
+	}
+	fmt.Println()
+
+	if failed > 0 {
+		log.Fatalf("%d of %d tests do not match their reference values", failed, len(refs))
+	}
+}
+
+// tolerance is the relative difference allowed between a result and
+// its reference value, which are published to four significant figures.
+const tolerance = 1e-3
+
+// approxEqual reports whether a result matches its reference value.
+func approxEqual(got, want float64) bool {
+	return math.Abs(got-want) <= tolerance*math.Abs(want)
+}
+
+// ChiSquareGoodnessOfFit tests whether the observed frequencies
+// follow the expected frequencies. The effect size is Cohen's w.
+func ChiSquareGoodnessOfFit(observed, expected []float64) (TestResult, error) {
+
+	if len(observed) != len(expected) {
+		return TestResult{}, errors.New("observed and expected must have the same length")
+	}
+	if len(observed) < 2 {
+		return TestResult{}, errors.New("at least two categories are required")
+	}
+
+	chiSquare := stat.ChiSquare(observed, expected)
+	df := float64(len(observed) - 1)
+	n := floats.Sum(observed)
+
+	return TestResult{
+		Name:       "chi-square GOF",
+		Statistic:  chiSquare,
+		DF:         df,
+		PValue:     distuv.ChiSquared{K: df}.Survival(chiSquare),
+		EffectSize: math.Sqrt(chiSquare / n),
+		EffectName: "Cohen's w",
+	}, nil
+}
+
+// ChiSquareIndependence tests whether the rows and columns of a
+// contingency table are independent. The effect size is Cramér's V.
+func ChiSquareIndependence(table [][]float64) (TestResult, error) {
+
+	rows := len(table)
+	if rows < 2 || len(table[0]) < 2 {
+		return TestResult{}, errors.New("contingency table must be at least 2x2")
+	}
+	cols := len(table[0])
+
+	// Calculate the row, column and grand totals.
+	rowTotals := make([]float64, rows)
+	colTotals := make([]float64, cols)
+	var total float64
+	for i, row := range table {
+		if len(row) != cols {
+			return TestResult{}, errors.New("contingency table rows must have the same length")
+		}
+		for j, val := range row {
+			rowTotals[i] += val
+			colTotals[j] += val
+			total += val
+		}
+	}
+
+	// Accumulate the statistic from the expected counts under independence.
+	var chiSquare float64
+	for i, row := range table {
+		for j, val := range row {
+			expected := rowTotals[i] * colTotals[j] / total
+			if expected == 0 {
+				return TestResult{}, errors.New("contingency table has an empty row or column")
+			}
+			chiSquare += (val - expected) * (val - expected) / expected
+		}
+	}
+
+	df := float64((rows - 1) * (cols - 1))
+	k := math.Min(float64(rows), float64(cols)) - 1
+
+	return TestResult{
+		Name:       "chi-square independence",
+		Statistic:  chiSquare,
+		DF:         df,
+		PValue:     distuv.ChiSquared{K: df}.Survival(chiSquare),
+		EffectSize: math.Sqrt(chiSquare / (total * k)),
+		EffectName: "Cramér's V",
+	}, nil
+}
+
+// twoSidedT returns the two-sided p-value of a t statistic.
+func twoSidedT(t, df float64) float64 {
+	return 2 * distuv.StudentsT{Mu: 0, Sigma: 1, Nu: df}.Survival(math.Abs(t))
+}
+
+// OneSampleTTest tests whether the mean of x is equal to mu.
+// The effect size is Cohen's d.
+func OneSampleTTest(x []float64, mu float64) (TestResult, error) {
+
+	if len(x) < 2 {
+		return TestResult{}, errors.New("at least two observations are required")
+	}
+
+	n := float64(len(x))
+	mean, std := stat.MeanStdDev(x, nil)
+	t := (mean - mu) / (std / math.Sqrt(n))
+
+	return TestResult{
+		Name:       "one-sample t",
+		Statistic:  t,
+		DF:         n - 1,
+		PValue:     twoSidedT(t, n-1),
+		EffectSize: (mean - mu) / std,
+		EffectName: "Cohen's d",
+	}, nil
+}
+
+// TwoSampleTTest tests whether the means of x and y are equal,
+// assuming equal variances. The effect size is Cohen's d.
+func TwoSampleTTest(x, y []float64) (TestResult, error) {
+
+	if len(x) < 2 || len(y) < 2 {
+		return TestResult{}, errors.New("at least two observations are required in each sample")
+	}
+
+	nx, ny := float64(len(x)), float64(len(y))
+	mx, vx := stat.MeanVariance(x, nil)
+	my, vy := stat.MeanVariance(y, nil)
+
+	// Calculate the pooled variance.
+	df := nx + ny - 2
+	pooled := ((nx-1)*vx + (ny-1)*vy) / df
+	t := (mx - my) / math.Sqrt(pooled*(1/nx+1/ny))
+
+	return TestResult{
+		Name:       "two-sample t",
+		Statistic:  t,
+		DF:         df,
+		PValue:     twoSidedT(t, df),
+		EffectSize: (mx - my) / math.Sqrt(pooled),
+		EffectName: "Cohen's d",
+	}, nil
+}
+
+// WelchTTest tests whether the means of x and y are equal without
+// assuming equal variances, using the Welch–Satterthwaite degrees
+// of freedom. The effect size is Cohen's d with the average variance.
+func WelchTTest(x, y []float64) (TestResult, error) {
+
+	if len(x) < 2 || len(y) < 2 {
+		return TestResult{}, errors.New("at least two observations are required in each sample")
+	}
+
+	nx, ny := float64(len(x)), float64(len(y))
+	mx, vx := stat.MeanVariance(x, nil)
+	my, vy := stat.MeanVariance(y, nil)
+
+	sx, sy := vx/nx, vy/ny
+	t := (mx - my) / math.Sqrt(sx+sy)
+	df := (sx + sy) * (sx + sy) / (sx*sx/(nx-1) + sy*sy/(ny-1))
+
+	return TestResult{
+		Name:       "Welch t",
+		Statistic:  t,
+		DF:         df,
+		PValue:     twoSidedT(t, df),
+		EffectSize: (mx - my) / math.Sqrt((vx+vy)/2),
+		EffectName: "Cohen's d",
+	}, nil
+}
+
+// PairedTTest tests whether the mean difference between paired
+// observations x and y is zero. The effect size is Cohen's d of
+// the differences.
+func PairedTTest(x, y []float64) (TestResult, error) {
+
+	if len(x) != len(y) {
+		return TestResult{}, errors.New("paired samples must have the same length")
+	}
+
+	diffs := make([]float64, len(x))
+	floats.SubTo(diffs, x, y)
+
+	result, err := OneSampleTTest(diffs, 0)
+	if err != nil {
+		return TestResult{}, err
+	}
+	result.Name = "paired t"
+
+	return result, nil
+}
+
+// rank returns the average ranks of the values,
+// along with the sum of t^3-t over the groups of ties.
+func rank(values []float64) ([]float64, float64) {
+
+	inds := make([]int, len(values))
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	floats.Argsort(sorted, inds)
+
+	ranks := make([]float64, len(values))
+	var tieSum float64
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] == sorted[i] {
+			j++
+		}
+
+		// Assign the average rank to each member of the tie group.
+		avg := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			ranks[inds[k]] = avg
+		}
+
+		t := float64(j - i + 1)
+		tieSum += t*t*t - t
+		i = j + 1
+	}
+
+	return ranks, tieSum
+}
+
+// MannWhitneyU tests whether x and y come from the same distribution
+// using the Mann–Whitney U (Wilcoxon rank-sum) test. The statistic is
+// U for x. The p-value is exact for small samples without ties and
+// otherwise uses the normal approximation with tie and continuity
+// corrections. The effect size is the rank-biserial correlation.
+func MannWhitneyU(x, y []float64) (TestResult, error) {
+
+	if len(x) == 0 || len(y) == 0 {
+		return TestResult{}, errors.New("both samples must be non-empty")
+	}
+
+	m, n := len(x), len(y)
+	combined := append(append([]float64{}, x...), y...)
+	ranks, tieSum := rank(combined)
+
+	// Calculate U for x from the sum of its ranks.
+	rx := floats.Sum(ranks[:m])
+	u := rx - float64(m*(m+1))/2
+	mn := float64(m * n)
+
+	var p float64
+	if tieSum == 0 && m < 50 && n < 50 {
+		p = exactMannWhitney(m, n, u)
+	} else {
+		N := float64(m + n)
+		mu := mn / 2
+		sigma := math.Sqrt(mn / 12 * ((N + 1) - tieSum/(N*(N-1))))
+		z := (math.Abs(u-mu) - 0.5) / sigma
+		p = 2 * distuv.UnitNormal.Survival(z)
+	}
+
+	return TestResult{
+		Name:       "Mann-Whitney U",
+		Statistic:  u,
+		PValue:     math.Min(1, p),
+		EffectSize: 2*u/mn - 1,
+		EffectName: "rank-biserial r",
+	}, nil
+}
+
+// exactMannWhitney returns the exact two-sided p-value of U for sample
+// sizes m and n by counting the arrangements that give each U value.
+func exactMannWhitney(m, n int, u float64) float64 {
+
+	// counts[i][j][k] would be the number of arrangements of i x values
+	// and j y values with U = k. We only need to keep one i at a time.
+	maxU := m * n
+	prev := make([][]float64, n+1)
+	for j := range prev {
+		prev[j] = make([]float64, maxU+1)
+		prev[j][0] = 1
+	}
+
+	for i := 1; i <= m; i++ {
+		cur := make([][]float64, n+1)
+		for j := range cur {
+			cur[j] = make([]float64, maxU+1)
+		}
+		cur[0][0] = 1
+		for j := 1; j <= n; j++ {
+			for k := 0; k <= i*j; k++ {
+
+				// Either the largest value is an x, which is then
+				// greater than all j y values, or it is a y.
+				if k >= j {
+					cur[j][k] += prev[j][k-j]
+				}
+				cur[j][k] += cur[j-1][k]
+			}
+		}
+		prev = cur
+	}
+
+	counts := prev[n]
+	total := floats.Sum(counts)
+
+	var lower, upper float64
+	for k, c := range counts {
+		if float64(k) <= u {
+			lower += c
+		}
+		if float64(k) >= u {
+			upper += c
+		}
+	}
+
+	return 2 * math.Min(lower, upper) / total
+}
+
+// exactLimit is the sample size below which the Kolmogorov-Smirnov
+// p-values are exact, as in R's ks.test.
+const exactLimit = 100
+
+// kolmogorovQ returns the asymptotic upper tail probability of
+// the Kolmogorov distribution.
+func kolmogorovQ(lambda float64) float64 {
+
+	if lambda < 0.2 {
+		return 1
+	}
+
+	var sum float64
+	for j := 1; j <= 100; j++ {
+		term := 2 * math.Pow(-1, float64(j-1)) * math.Exp(-2*float64(j*j)*lambda*lambda)
+		sum += term
+		if math.Abs(term) < 1e-12 {
+			break
+		}
+	}
+
+	return math.Max(0, math.Min(1, sum))
+}
+
+// kolmogorovExact returns the exact probability that D is less than d
+// for a sample of size n, using the method of Marsaglia, Tsang and Wang
+// (2003). It raises an m x m matrix to the nth power, keeping a
+// separate power of 10 so that the elements do not overflow.
+func kolmogorovExact(n int, d float64) float64 {
+
+	k := int(float64(n)*d) + 1
+	m := 2*k - 1
+	h := float64(k) - float64(n)*d
+
+	// Build the matrix H.
+	H := make([]float64, m*m)
+	for i := 0; i < m; i++ {
+		for j := 0; j < m; j++ {
+			if i-j+1 >= 0 {
+				H[i*m+j] = 1
+			}
+		}
+	}
+	for i := 0; i < m; i++ {
+		H[i*m] -= math.Pow(h, float64(i+1))
+		H[(m-1)*m+i] -= math.Pow(h, float64(m-i))
+	}
+	if 2*h-1 > 0 {
+		H[(m-1)*m] += math.Pow(2*h-1, float64(m))
+	}
+	for i := 0; i < m; i++ {
+		for j := 0; j < m; j++ {
+			for g := 2; g <= i-j+1; g++ {
+				H[i*m+j] /= float64(g)
+			}
+		}
+	}
+
+	// Take the middle element of H^n and multiply by n!/n^n.
+	Q, eQ := matrixPower(H, 0, m, n)
+	s := Q[(k-1)*m+k-1]
+	for i := 1; i <= n; i++ {
+		s = s * float64(i) / float64(n)
+		if s < 1e-140 {
+			s *= 1e140
+			eQ -= 140
+		}
+	}
+
+	return s * math.Pow(10, float64(eQ))
+}
+
+// matrixPower returns the nth power of the m x m matrix A, scaled by
+// 10^eA, as a matrix and its power of 10.
+func matrixPower(A []float64, eA, m, n int) ([]float64, int) {
+
+	if n == 1 {
+		return append([]float64(nil), A...), eA
+	}
+
+	V, eV := matrixPower(A, eA, m, n/2)
+	B := matrixMultiply(V, V, m)
+	eB := 2 * eV
+	if n%2 == 0 {
+		V, eV = B, eB
+	} else {
+		V, eV = matrixMultiply(A, B, m), eA+eB
+	}
+
+	if V[(m/2)*m+m/2] > 1e140 {
+		for i := range V {
+			V[i] *= 1e-140
+		}
+		eV += 140
+	}
+
+	return V, eV
+}
+
+// matrixMultiply returns the product of the m x m matrices A and B.
+func matrixMultiply(A, B []float64, m int) []float64 {
+	C := make([]float64, m*m)
+	for i := 0; i < m; i++ {
+		for j := 0; j < m; j++ {
+			var s float64
+			for k := 0; k < m; k++ {
+				s += A[i*m+k] * B[k*m+j]
+			}
+			C[i*m+j] = s
+		}
+	}
+	return C
+}
+
+// smirnovExact returns the exact probability that the two-sample D is
+// at least d for samples of size m and n without ties. It counts the
+// lattice paths from (0, 0) to (m, n), i.e. the orderings of the
+// combined sample, that stay strictly within d of the diagonal.
+func smirnovExact(m, n int, d float64) float64 {
+
+	// Guard against rounding when a path lies exactly at d.
+	q := d - 1e-7
+	inside := func(i, j int) bool {
+		return math.Abs(float64(i)/float64(m)-float64(j)/float64(n)) < q
+	}
+
+	u := make([]float64, n+1)
+	for j := 0; j <= n; j++ {
+		if inside(0, j) {
+			u[j] = 1
+		} else {
+			break
+		}
+	}
+	for i := 1; i <= m; i++ {
+		if !inside(i, 0) {
+			u[0] = 0
+		}
+		for j := 1; j <= n; j++ {
+			if inside(i, j) {
+				u[j] += u[j-1]
+			} else {
+				u[j] = 0
+			}
+		}
+	}
+
+	// Divide by the total number of paths, C(m+n, m).
+	lgTotal, _ := math.Lgamma(float64(m + n + 1))
+	lgM, _ := math.Lgamma(float64(m + 1))
+	lgN, _ := math.Lgamma(float64(n + 1))
+	inPaths := u[n] / math.Exp(lgTotal-lgM-lgN)
+
+	return math.Max(0, math.Min(1, 1-inPaths))
+}
+
+// KolmogorovSmirnov tests whether x follows the distribution with the
+// given CDF. The p-value is exact for samples smaller than exactLimit
+// and otherwise asymptotic. The effect size is the statistic D itself.
+func KolmogorovSmirnov(x []float64, cdf func(float64) float64) (TestResult, error) {
+
+	if len(x) == 0 {
+		return TestResult{}, errors.New("sample must be non-empty")
+	}
+
+	sorted := make([]float64, len(x))
+	copy(sorted, x)
+	sort.Float64s(sorted)
+
+	// Find the largest distance between the empirical and reference CDFs.
+	n := float64(len(sorted))
+	var d float64
+	for i, v := range sorted {
+		f := cdf(v)
+		d = math.Max(d, math.Max(float64(i+1)/n-f, f-float64(i)/n))
+	}
+
+	var p float64
+	if len(sorted) < exactLimit {
+		p = math.Max(0, math.Min(1, 1-kolmogorovExact(len(sorted), d)))
+	} else {
+		en := math.Sqrt(n)
+		p = kolmogorovQ((en + 0.12 + 0.11/en) * d)
+	}
+
+	return TestResult{
+		Name:       "Kolmogorov-Smirnov",
+		Statistic:  d,
+		PValue:     p,
+		EffectSize: d,
+		EffectName: "D",
+	}, nil
+}
+
+// KolmogorovSmirnovTwoSample tests whether x and y come from the
+// same distribution. The p-value is exact when the product of the
+// sample sizes is below exactLimit squared and there are no ties, and
+// otherwise asymptotic. The effect size is the statistic D itself.
+func KolmogorovSmirnovTwoSample(x, y []float64) (TestResult, error) {
+
+	if len(x) == 0 || len(y) == 0 {
+		return TestResult{}, errors.New("both samples must be non-empty")
+	}
+
+	sx := make([]float64, len(x))
+	copy(sx, x)
+	sort.Float64s(sx)
+
+	sy := make([]float64, len(y))
+	copy(sy, y)
+	sort.Float64s(sy)
+
+	// Walk both samples in order, tracking the two empirical CDFs.
+	nx, ny := float64(len(sx)), float64(len(sy))
+	var i, j int
+	var d float64
+	ties := false
+	for i < len(sx) && j < len(sy) {
+		v := math.Min(sx[i], sy[j])
+		start := i + j
+		for i < len(sx) && sx[i] == v {
+			i++
+		}
+		for j < len(sy) && sy[j] == v {
+			j++
+		}
+		if i+j-start > 1 {
+			ties = true
+		}
+		d = math.Max(d, math.Abs(float64(i)/nx-float64(j)/ny))
+	}
+	ties = ties || hasTies(sx[i:]) || hasTies(sy[j:])
+
+	var p float64
+	if !ties && len(sx)*len(sy) < exactLimit*exactLimit {
+		p = smirnovExact(len(sx), len(sy), d)
+	} else {
+		en := math.Sqrt(nx * ny / (nx + ny))
+		p = kolmogorovQ((en + 0.12 + 0.11/en) * d)
+	}
+
+	return TestResult{
+		Name:       "Kolmogorov-Smirnov 2",
+		Statistic:  d,
+		PValue:     p,
+		EffectSize: d,
+		EffectName: "D",
+	}, nil
+}
+
+// hasTies reports whether the sorted values contain a repeated value.
+func hasTies(sorted []float64) bool {
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i] == sorted[i-1] {
+			return true
+		}
+	}
+	return false
+}
+
+// OneWayANOVA tests whether the means of the groups are equal.
+// The effect size is eta squared.
+func OneWayANOVA(groups ...[]float64) (TestResult, error) {
+
+	if len(groups) < 2 {
+		return TestResult{}, errors.New("at least two groups are required")
+	}
+
+	// Calculate the grand mean.
+	var all []float64
+	for _, g := range groups {
+		if len(g) == 0 {
+			return TestResult{}, errors.New("groups must be non-empty")
+		}
+		all = append(all, g...)
+	}
+	grandMean := stat.Mean(all, nil)
+
+	// Split the sum of squares into between and within groups.
+	var ssBetween, ssWithin float64
+	for _, g := range groups {
+		mean := stat.Mean(g, nil)
+		ssBetween += float64(len(g)) * (mean - grandMean) * (mean - grandMean)
+		for _, v := range g {
+			ssWithin += (v - mean) * (v - mean)
+		}
+	}
+
+	df1 := float64(len(groups) - 1)
+	df2 := float64(len(all) - len(groups))
+	if df2 <= 0 {
+		return TestResult{}, errors.New("not enough observations for the number of groups")
+	}
+	f := (ssBetween / df1) / (ssWithin / df2)
+
+	return TestResult{
+		Name:       "one-way ANOVA",
+		Statistic:  f,
+		DF:         df1,
+		DF2:        df2,
+		PValue:     distuv.F{D1: df1, D2: df2}.Survival(f),
+		EffectSize: ssBetween / (ssBetween + ssWithin),
+		EffectName: "eta squared",
+	}, nil
+}
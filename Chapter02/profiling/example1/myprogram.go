@@ -0,0 +1,576 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+)
+
+// Report includes the full statistical profile of a dataset.
+type Report struct {
+	Source       string          `json:"source"`
+	Rows         int             `json:"rows"`
+	Columns      []ColumnProfile `json:"columns"`
+	Correlations []Correlation   `json:"correlations"`
+}
+
+// ColumnProfile includes the summary statistics
+// for a single column of the dataset.
+type ColumnProfile struct {
+	Name      string          `json:"name"`
+	Type      string          `json:"type"`
+	Missing   int             `json:"missing"`
+	Distinct  int             `json:"distinct"`
+	Numeric   *NumericSummary `json:"numeric,omitempty"`
+	TopValues []ValueCount    `json:"top_values"`
+	Histogram []HistogramBin  `json:"histogram,omitempty"`
+}
+
+// NumericSummary includes the measures of central tendency,
+// spread and shape for a numeric column. The measures that are
+// undefined for the column, such as the skewness of a constant
+// column, are null.
+type NumericSummary struct {
+	Mean      float64  `json:"mean"`
+	Mode      float64  `json:"mode"`
+	ModeCount int      `json:"mode_count"`
+	Median    float64  `json:"median"`
+	Min       float64  `json:"min"`
+	Max       float64  `json:"max"`
+	Range     float64  `json:"range"`
+	Variance  *float64 `json:"variance"`
+	StdDev    *float64 `json:"std_dev"`
+	Quant25   float64  `json:"quantile_25"`
+	Quant75   float64  `json:"quantile_75"`
+	IQR       float64  `json:"iqr"`
+	Skewness  *float64 `json:"skewness"`
+	Kurtosis  *float64 `json:"excess_kurtosis"`
+}
+
+// ValueCount includes a value and the number of times
+// that value occurs in a column.
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// HistogramBin includes the bounds and count of
+// one histogram bin.
+type HistogramBin struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+// Correlation includes the Pearson correlation between a pair of
+// numeric columns, which is null when either column is constant.
+type Correlation struct {
+	A           string   `json:"a"`
+	B           string   `json:"b"`
+	Correlation *float64 `json:"correlation"`
+}
+
+// column holds the raw and parsed values of a column.
+type column struct {
+	name    string
+	raw     []string
+	values  []float64
+	numeric bool
+}
+
+func main() {
+
+	// Declare the input and output flags.
+	inPtr := flag.String("in", "../data/iris.csv", "The CSV file to profile")
+	outDirPtr := flag.String("outDir", ".", "The output directory for the reports")
+	binsPtr := flag.Int("bins", 16, "The number of histogram bins")
+	topPtr := flag.Int("top", 5, "The number of top categories to report")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Open the CSV file.
+	f, err := os.Open(*inPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	// Read in all of the CSV records.
+	reader := csv.NewReader(f)
+	records, err := reader.ReadAll()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(records) < 2 {
+		log.Fatal("Expected a header and at least one row of data")
+	}
+
+	// Split the records into columns and infer their types.
+	cols := parseColumns(records)
+
+	// Profile each of the columns.
+	report := Report{
+		Source: *inPtr,
+		Rows:   len(records) - 1,
+	}
+	for _, col := range cols {
+		report.Columns = append(report.Columns, profileColumn(col, *binsPtr, *topPtr))
+	}
+
+	// Calculate the pairwise correlations between the numeric columns.
+	report.Correlations = correlations(cols)
+
+	// Marshal the report and save it to a file.
+	outputData, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(*outDirPtr, "profile.json"), outputData, 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	// Render the HTML report with the plots embedded.
+	htmlData, err := renderHTML(report, cols, *binsPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(*outDirPtr, "profile.html"), htmlData, 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	// Output a short summary to standard out.
+	fmt.Printf("\nProfiled %d rows and %d columns of %s\n", report.Rows, len(report.Columns), *inPtr)
+	for _, cp := range report.Columns {
+		fmt.Printf("%-20s %-12s missing: %-4d distinct: %d\n", cp.Name, cp.Type, cp.Missing, cp.Distinct)
+	}
+	fmt.Println()
+}
+
+// isMissing reports whether a raw CSV value should be
+// treated as a missing value.
+func isMissing(val string) bool {
+	switch strings.ToLower(strings.TrimSpace(val)) {
+	case "", "na", "nan", "null", "none":
+		return true
+	}
+	return false
+}
+
+// parseColumns splits the CSV records into columns. A column is
+// considered numeric if all of its non-missing values parse as floats.
+func parseColumns(records [][]string) []column {
+
+	header := records[0]
+	cols := make([]column, len(header))
+
+	for j, name := range header {
+		cols[j] = column{name: name, numeric: true}
+		for _, record := range records[1:] {
+
+			// Treat short records as missing values.
+			var val string
+			if j < len(record) {
+				val = record[j]
+			}
+			cols[j].raw = append(cols[j].raw, val)
+
+			if isMissing(val) {
+				cols[j].values = append(cols[j].values, math.NaN())
+				continue
+			}
+
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+			if err != nil {
+				cols[j].numeric = false
+				continue
+			}
+			cols[j].values = append(cols[j].values, parsed)
+		}
+	}
+
+	return cols
+}
+
+// nonMissing returns the non-NaN values of a numeric column.
+func nonMissing(values []float64) []float64 {
+	var out []float64
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// profileColumn calculates the summary statistics for a column.
+func profileColumn(col column, bins, top int) ColumnProfile {
+
+	cp := ColumnProfile{
+		Name: col.name,
+		Type: "categorical",
+	}
+
+	// Count the missing and distinct values.
+	counts := make(map[string]int)
+	for _, val := range col.raw {
+		if isMissing(val) {
+			cp.Missing++
+			continue
+		}
+		counts[val]++
+	}
+	cp.Distinct = len(counts)
+
+	// Sort the values by their frequency to get the top categories.
+	for val, count := range counts {
+		cp.TopValues = append(cp.TopValues, ValueCount{Value: val, Count: count})
+	}
+	sort.Slice(cp.TopValues, func(i, j int) bool {
+		if cp.TopValues[i].Count == cp.TopValues[j].Count {
+			return cp.TopValues[i].Value < cp.TopValues[j].Value
+		}
+		return cp.TopValues[i].Count > cp.TopValues[j].Count
+	})
+	if len(cp.TopValues) > top {
+		cp.TopValues = cp.TopValues[:top]
+	}
+
+	// The remaining measures only apply to numeric columns.
+	vals := nonMissing(col.values)
+	if !col.numeric || len(vals) == 0 {
+		return cp
+	}
+	cp.Type = "numeric"
+
+	// Sort a copy of the values for the quantiles.
+	sorted := make([]float64, len(vals))
+	copy(sorted, vals)
+	sort.Float64s(sorted)
+
+	modeVal, modeCount := stat.Mode(vals, nil)
+	minVal := floats.Min(vals)
+	maxVal := floats.Max(vals)
+	quant25 := stat.Quantile(0.25, stat.Empirical, sorted, nil)
+	quant75 := stat.Quantile(0.75, stat.Empirical, sorted, nil)
+
+	cp.Numeric = &NumericSummary{
+		Mean:      stat.Mean(vals, nil),
+		Mode:      modeVal,
+		ModeCount: int(modeCount),
+		Median:    stat.Quantile(0.5, stat.Empirical, sorted, nil),
+		Min:       minVal,
+		Max:       maxVal,
+		Range:     maxVal - minVal,
+		Variance:  defined(stat.Variance(vals, nil)),
+		StdDev:    defined(stat.StdDev(vals, nil)),
+		Quant25:   quant25,
+		Quant75:   quant75,
+		IQR:       quant75 - quant25,
+		Skewness:  defined(stat.Skew(vals, nil)),
+		Kurtosis:  defined(stat.ExKurtosis(vals, nil)),
+	}
+
+	// Calculate the histogram with equally sized bins.
+	cp.Histogram = histogram(sorted, minVal, maxVal, bins)
+
+	return cp
+}
+
+// defined returns a pointer to the value, or nil when the value is
+// not a number, e.g. the variance of a single value.
+func defined(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+// histogram bins the values into equally sized bins
+// between min and max.
+func histogram(vals []float64, min, max float64, bins int) []HistogramBin {
+
+	// Handle columns with a single value.
+	if max == min {
+		return []HistogramBin{{Min: min, Max: max, Count: len(vals)}}
+	}
+
+	width := (max - min) / float64(bins)
+	hist := make([]HistogramBin, bins)
+	for i := range hist {
+		hist[i].Min = min + float64(i)*width
+		hist[i].Max = min + float64(i+1)*width
+	}
+
+	for _, v := range vals {
+		idx := int((v - min) / width)
+		if idx >= bins {
+			idx = bins - 1
+		}
+		hist[idx].Count++
+	}
+
+	return hist
+}
+
+// correlations calculates the Pearson correlation between each pair
+// of numeric columns, using only the rows where both are present.
+// Columns where every value is missing are left out.
+func correlations(cols []column) []Correlation {
+
+	var numeric []column
+	for _, col := range cols {
+		if col.numeric && len(nonMissing(col.values)) > 0 {
+			numeric = append(numeric, col)
+		}
+	}
+
+	var out []Correlation
+	for i := 0; i < len(numeric); i++ {
+		for j := i + 1; j < len(numeric); j++ {
+
+			var x, y []float64
+			for k := range numeric[i].values {
+				if math.IsNaN(numeric[i].values[k]) || math.IsNaN(numeric[j].values[k]) {
+					continue
+				}
+				x = append(x, numeric[i].values[k])
+				y = append(y, numeric[j].values[k])
+			}
+
+			// Pairs that never overlap have no correlation.
+			var corr *float64
+			if len(x) > 1 {
+				corr = defined(stat.Correlation(x, y, nil))
+			}
+
+			out = append(out, Correlation{
+				A:           numeric[i].name,
+				B:           numeric[j].name,
+				Correlation: corr,
+			})
+		}
+	}
+
+	return out
+}
+
+// encodePlot renders a plot to a base64 encoded PNG
+// suitable for embedding in HTML.
+func encodePlot(p *plot.Plot, w, h vg.Length) (template.URL, error) {
+
+	wt, err := p.WriterTo(w, h, "png")
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if _, err := wt.WriteTo(&buf); err != nil {
+		return "", err
+	}
+
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
+
+// htmlColumn includes a column profile and its embedded plot.
+type htmlColumn struct {
+	ColumnProfile
+	Hist template.URL
+}
+
+// renderHTML renders the report as an HTML page with the
+// histograms, box plots and scatter plots embedded.
+func renderHTML(report Report, cols []column, bins int) ([]byte, error) {
+
+	var columns []htmlColumn
+	var numeric []column
+	for i, col := range cols {
+		hc := htmlColumn{ColumnProfile: report.Columns[i]}
+		if report.Columns[i].Numeric != nil {
+			numeric = append(numeric, col)
+
+			// Create a histogram of the values.
+			p, err := plot.New()
+			if err != nil {
+				return nil, err
+			}
+			p.Title.Text = fmt.Sprintf("Histogram of %s", col.name)
+
+			h, err := plotter.NewHist(plotter.Values(nonMissing(col.values)), bins)
+			if err != nil {
+				return nil, err
+			}
+			h.Normalize(1)
+			p.Add(h)
+
+			if hc.Hist, err = encodePlot(p, 4*vg.Inch, 4*vg.Inch); err != nil {
+				return nil, err
+			}
+		}
+		columns = append(columns, hc)
+	}
+
+	// Create the box plots of all the numeric columns.
+	var boxes template.URL
+	if len(numeric) > 0 {
+		p, err := plot.New()
+		if err != nil {
+			return nil, err
+		}
+		p.Title.Text = "Box plots"
+		p.Y.Label.Text = "Values"
+
+		var names []string
+		for idx, col := range numeric {
+			b, err := plotter.NewBoxPlot(vg.Points(40), float64(idx), plotter.Values(nonMissing(col.values)))
+			if err != nil {
+				return nil, err
+			}
+			p.Add(b)
+			names = append(names, col.name)
+		}
+		p.NominalX(names...)
+
+		if boxes, err = encodePlot(p, vg.Length(len(numeric))*1.5*vg.Inch+2*vg.Inch, 6*vg.Inch); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create a scatter plot for each pair of numeric columns.
+	var scatters []template.URL
+	for i := 0; i < len(numeric); i++ {
+		for j := i + 1; j < len(numeric); j++ {
+			pts := make(plotter.XYs, 0, len(numeric[i].values))
+			for k := range numeric[i].values {
+				x, y := numeric[i].values[k], numeric[j].values[k]
+				if math.IsNaN(x) || math.IsNaN(y) {
+					continue
+				}
+				pts = append(pts, plotter.XY{X: x, Y: y})
+			}
+
+			p, err := plot.New()
+			if err != nil {
+				return nil, err
+			}
+			p.X.Label.Text = numeric[i].name
+			p.Y.Label.Text = numeric[j].name
+			p.Add(plotter.NewGrid())
+
+			s, err := plotter.NewScatter(pts)
+			if err != nil {
+				return nil, err
+			}
+			s.GlyphStyle.Radius = vg.Points(2)
+			p.Add(s)
+
+			img, err := encodePlot(p, 3*vg.Inch, 3*vg.Inch)
+			if err != nil {
+				return nil, err
+			}
+			scatters = append(scatters, img)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, map[string]interface{}{
+		"Report":   report,
+		"Columns":  columns,
+		"Boxes":    boxes,
+		"Scatters": scatters,
+	}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// reportTemplate is the HTML template for the profile report.
+var reportTemplate = template.Must(template.New("profile").Funcs(template.FuncMap{
+	"f": func(v float64) string { return strconv.FormatFloat(v, 'f', 4, 64) },
+	"fp": func(v *float64) string {
+		if v == nil {
+			return "-"
+		}
+		return strconv.FormatFloat(*v, 'f', 4, 64)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Profile of {{.Report.Source}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th { background: #eee; }
+.column { border-top: 2px solid #333; padding-top: 1em; margin-top: 2em; }
+</style>
+</head>
+<body>
+<h1>Profile of {{.Report.Source}}</h1>
+<p>{{.Report.Rows}} rows, {{len .Columns}} columns</p>
+{{range .Columns}}
+<div class="column">
+<h2>{{.Name}} ({{.Type}})</h2>
+<table>
+<tr><th>missing</th><td>{{.Missing}}</td></tr>
+<tr><th>distinct</th><td>{{.Distinct}}</td></tr>
+{{with .Numeric}}
+<tr><th>mean</th><td>{{f .Mean}}</td></tr>
+<tr><th>mode</th><td>{{f .Mode}} ({{.ModeCount}})</td></tr>
+<tr><th>median</th><td>{{f .Median}}</td></tr>
+<tr><th>min</th><td>{{f .Min}}</td></tr>
+<tr><th>max</th><td>{{f .Max}}</td></tr>
+<tr><th>range</th><td>{{f .Range}}</td></tr>
+<tr><th>variance</th><td>{{fp .Variance}}</td></tr>
+<tr><th>std dev</th><td>{{fp .StdDev}}</td></tr>
+<tr><th>25% quantile</th><td>{{f .Quant25}}</td></tr>
+<tr><th>75% quantile</th><td>{{f .Quant75}}</td></tr>
+<tr><th>IQR</th><td>{{f .IQR}}</td></tr>
+<tr><th>skewness</th><td>{{fp .Skewness}}</td></tr>
+<tr><th>excess kurtosis</th><td>{{fp .Kurtosis}}</td></tr>
+{{end}}
+</table>
+<table>
+<tr><th>value</th><th>count</th></tr>
+{{range .TopValues}}<tr><td>{{.Value}}</td><td>{{.Count}}</td></tr>
+{{end}}
+</table>
+{{if .Hist}}<img src="{{.Hist}}">{{end}}
+</div>
+{{end}}
+{{if .Report.Correlations}}
+<h2>Correlations</h2>
+<table>
+<tr><th>a</th><th>b</th><th>pearson</th></tr>
+{{range .Report.Correlations}}<tr><td>{{.A}}</td><td>{{.B}}</td><td>{{fp .Correlation}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{if .Boxes}}<h2>Box plots</h2><img src="{{.Boxes}}">{{end}}
+{{if .Scatters}}<h2>Scatter plots</h2>{{range .Scatters}}<img src="{{.}}">{{end}}{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/color"
+	"log"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/go-gota/gota/dataframe"
+	"github.com/go-gota/gota/series"
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/palette/moreland"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+)
+
+// corrGrid implements the plotter.GridXYZ interface
+// for a square correlation matrix.
+type corrGrid [][]float64
+
+func (g corrGrid) Dims() (c, r int)   { return len(g), len(g) }
+func (g corrGrid) Z(c, r int) float64 { return g[r][c] }
+func (g corrGrid) X(c int) float64    { return float64(c) }
+func (g corrGrid) Y(r int) float64    { return float64(r) }
+
+func main() {
+
+	// Declare the input and output flags.
+	inPtr := flag.String("in", "../data/iris.csv", "The CSV file to analyze")
+	classPtr := flag.String("class", "species", "The class column used to color the pair plot")
+	methodPtr := flag.String("method", "pearson", "The correlation method: pearson, spearman or kendall")
+	formatPtr := flag.String("format", "png", "The output image format: png or svg")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Open the CSV file.
+	f, err := os.Open(*inPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	// Create a dataframe from the CSV file.
+	df := dataframe.ReadCSV(f)
+	if df.Err != nil {
+		log.Fatal(df.Err)
+	}
+
+	// Collect the numeric feature columns.
+	var names []string
+	var cols [][]float64
+	for _, name := range df.Names() {
+		col := df.Col(name)
+		if name == *classPtr || (col.Type() != series.Float && col.Type() != series.Int) {
+			continue
+		}
+		names = append(names, name)
+		cols = append(cols, col.Float())
+	}
+
+	if len(cols) < 2 {
+		log.Fatal("At least two numeric columns are required")
+	}
+
+	// Select the correlation method.
+	var corrFn func(x, y []float64) (float64, float64)
+	switch *methodPtr {
+	case "pearson":
+		corrFn = pearson
+	case "spearman":
+		corrFn = spearman
+	case "kendall":
+		corrFn = kendall
+	default:
+		log.Fatalf("Unknown correlation method %s", *methodPtr)
+	}
+
+	// Calculate the correlation and significance matrices, dropping
+	// the rows with a missing value from each pair.
+	n := len(cols)
+	corr := make([][]float64, n)
+	pVals := make([][]float64, n)
+	for i := range corr {
+		corr[i] = make([]float64, n)
+		pVals[i] = make([]float64, n)
+		for j := range corr[i] {
+			if i == j {
+				corr[i][j] = 1
+				continue
+			}
+			x, y := complete(cols[i], cols[j])
+			corr[i][j], pVals[i][j] = corrFn(x, y)
+		}
+	}
+
+	// Output the matrices to standard out.
+	fmt.Printf("\n%s correlation (p-value)\n\n%-14s", *methodPtr, "")
+	for _, name := range names {
+		fmt.Printf("%20s", name)
+	}
+	fmt.Println()
+	for i, name := range names {
+		fmt.Printf("%-14s", name)
+		for j := range names {
+			fmt.Printf("%20s", fmt.Sprintf("%0.3f (%0.1e)", corr[i][j], pVals[i][j]))
+		}
+		fmt.Println()
+	}
+
+	// Output the covariance matrix to standard out.
+	fmt.Printf("\ncovariance\n\n%-14s", "")
+	for _, name := range names {
+		fmt.Printf("%14s", name)
+	}
+	fmt.Println()
+	for i, name := range names {
+		fmt.Printf("%-14s", name)
+		for j := range names {
+			x, y := complete(cols[i], cols[j])
+			fmt.Printf("%14.4f", stat.Covariance(x, y, nil))
+		}
+		fmt.Println()
+	}
+	fmt.Println()
+
+	// Save the annotated heatmap.
+	heatmap, err := heatmapPlot(corr, names, *methodPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := heatmap.Save(6*vg.Inch, 6*vg.Inch, fmt.Sprintf("%s_heatmap.%s", *methodPtr, *formatPtr)); err != nil {
+		log.Fatal(err)
+	}
+
+	// Save the pair plot colored by the class column.
+	var classes []string
+	if contains(df.Names(), *classPtr) {
+		classes = df.Col(*classPtr).Records()
+	}
+
+	if err := savePairPlot(cols, names, classes, *formatPtr); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// contains reports whether the names include name.
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// complete returns the pairs of values where neither x nor y
+// is missing.
+func complete(x, y []float64) ([]float64, []float64) {
+	var cx, cy []float64
+	for i := range x {
+		if math.IsNaN(x[i]) || math.IsNaN(y[i]) {
+			continue
+		}
+		cx = append(cx, x[i])
+		cy = append(cy, y[i])
+	}
+	return cx, cy
+}
+
+// tTestCorr returns the two-sided p-value of a correlation
+// coefficient from n observations using the t distribution.
+func tTestCorr(r float64, n int) float64 {
+	if math.Abs(r) >= 1 {
+		return 0
+	}
+	df := float64(n - 2)
+	t := r * math.Sqrt(df/(1-r*r))
+	return 2 * distuv.StudentsT{Mu: 0, Sigma: 1, Nu: df}.Survival(math.Abs(t))
+}
+
+// pearson returns the Pearson correlation of x and y and its p-value.
+func pearson(x, y []float64) (float64, float64) {
+	r := stat.Correlation(x, y, nil)
+	return r, tTestCorr(r, len(x))
+}
+
+// ranks returns the average ranks of the values, with ties
+// sharing the mean of the ranks they span.
+func ranks(values []float64) []float64 {
+
+	inds := make([]int, len(values))
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	floats.Argsort(sorted, inds)
+
+	out := make([]float64, len(values))
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] == sorted[i] {
+			j++
+		}
+		for k := i; k <= j; k++ {
+			out[inds[k]] = float64(i+j)/2 + 1
+		}
+		i = j + 1
+	}
+
+	return out
+}
+
+// spearman returns the Spearman rank correlation of x and y
+// and its p-value.
+func spearman(x, y []float64) (float64, float64) {
+	r := stat.Correlation(ranks(x), ranks(y), nil)
+	return r, tTestCorr(r, len(x))
+}
+
+// present returns the values that are not missing.
+func present(values []float64) []float64 {
+	var out []float64
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// tieGroups returns the sizes of the groups of tied values.
+func tieGroups(values []float64) []float64 {
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	var groups []float64
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] == sorted[i] {
+			j++
+		}
+		if j > i {
+			groups = append(groups, float64(j-i+1))
+		}
+		i = j + 1
+	}
+
+	return groups
+}
+
+// kendall returns the Kendall tau-b correlation of x and y and the
+// p-value from its normal approximation, with the variance of the
+// score corrected for ties in either variable.
+func kendall(x, y []float64) (float64, float64) {
+
+	var concordant, discordant, tiesX, tiesY float64
+	for i := 0; i < len(x); i++ {
+		for j := i + 1; j < len(x); j++ {
+			dx := x[i] - x[j]
+			dy := y[i] - y[j]
+			switch {
+			case dx == 0 && dy == 0:
+			case dx == 0:
+				tiesX++
+			case dy == 0:
+				tiesY++
+			case dx*dy > 0:
+				concordant++
+			default:
+				discordant++
+			}
+		}
+	}
+
+	tau := (concordant - discordant) / math.Sqrt((concordant+discordant+tiesX)*(concordant+discordant+tiesY))
+
+	n := float64(len(x))
+	if n < 3 {
+		return tau, math.NaN()
+	}
+
+	// Sum the tie terms of the variance for each variable.
+	var vt, vu, t1, u1, t2, u2 float64
+	for _, t := range tieGroups(x) {
+		vt += t * (t - 1) * (2*t + 5)
+		t1 += t * (t - 1)
+		t2 += t * (t - 1) * (t - 2)
+	}
+	for _, u := range tieGroups(y) {
+		vu += u * (u - 1) * (2*u + 5)
+		u1 += u * (u - 1)
+		u2 += u * (u - 1) * (u - 2)
+	}
+
+	variance := (n*(n-1)*(2*n+5)-vt-vu)/18 +
+		t1*u1/(2*n*(n-1)) +
+		t2*u2/(9*n*(n-1)*(n-2))
+	z := (concordant - discordant) / math.Sqrt(variance)
+
+	return tau, 2 * distuv.UnitNormal.Survival(math.Abs(z))
+}
+
+// heatmapPlot creates a heatmap of the correlation matrix
+// annotated with the correlation values.
+func heatmapPlot(corr [][]float64, names []string, method string) (*plot.Plot, error) {
+
+	p, err := plot.New()
+	if err != nil {
+		return nil, err
+	}
+	p.Title.Text = fmt.Sprintf("%s correlation", method)
+
+	// Use a diverging palette centered on zero.
+	colors := moreland.SmoothBlueRed()
+	colors.SetMin(-1)
+	colors.SetMax(1)
+
+	h := plotter.NewHeatMap(corrGrid(corr), colors.Palette(255))
+	h.Min, h.Max = -1, 1
+	p.Add(h)
+
+	// Annotate each cell with its correlation value.
+	var labels plotter.XYLabels
+	for i := range corr {
+		for j := range corr[i] {
+			labels.XYs = append(labels.XYs, plotter.XY{X: float64(j), Y: float64(i)})
+			labels.Labels = append(labels.Labels, fmt.Sprintf("%0.2f", corr[i][j]))
+		}
+	}
+
+	l, err := plotter.NewLabels(labels)
+	if err != nil {
+		return nil, err
+	}
+	for i := range l.TextStyle {
+		l.TextStyle[i].XAlign = draw.XCenter
+		l.TextStyle[i].YAlign = draw.YCenter
+	}
+	p.Add(l)
+
+	p.NominalX(names...)
+	p.NominalY(names...)
+
+	return p, nil
+}
+
+// savePairPlot saves a scatter matrix of the features with each point
+// colored by its class, and histograms along the diagonal.
+func savePairPlot(cols [][]float64, names, classes []string, format string) error {
+
+	// Find the distinct classes in order.
+	var levels []string
+	seen := make(map[string]bool)
+	for _, c := range classes {
+		if !seen[c] {
+			seen[c] = true
+			levels = append(levels, c)
+		}
+	}
+	sort.Strings(levels)
+	if len(levels) == 0 {
+		levels = []string{""}
+	}
+
+	n := len(cols)
+	plots := make([][]*plot.Plot, n)
+	for i := range plots {
+		plots[i] = make([]*plot.Plot, n)
+		for j := range plots[i] {
+
+			p, err := plot.New()
+			if err != nil {
+				return err
+			}
+
+			// Label the outer axes only.
+			if i == n-1 {
+				p.X.Label.Text = names[j]
+			}
+			if j == 0 {
+				p.Y.Label.Text = names[i]
+			}
+
+			if i == j {
+
+				// Draw a histogram of the feature along the diagonal.
+				h, err := plotter.NewHist(plotter.Values(present(cols[i])), 16)
+				if err != nil {
+					return err
+				}
+				p.Add(h)
+				plots[i][j] = p
+				continue
+			}
+
+			// Draw a scatter of the pair of features for each class.
+			for k, level := range levels {
+				var pts plotter.XYs
+				for r := range cols[j] {
+					if classes != nil && classes[r] != level {
+						continue
+					}
+					if math.IsNaN(cols[j][r]) || math.IsNaN(cols[i][r]) {
+						continue
+					}
+					pts = append(pts, plotter.XY{X: cols[j][r], Y: cols[i][r]})
+				}
+
+				s, err := plotter.NewScatter(pts)
+				if err != nil {
+					return err
+				}
+				s.GlyphStyle.Color = plotutil.Color(k)
+				s.GlyphStyle.Radius = vg.Points(1.5)
+				p.Add(s)
+
+				// Add a legend to the top right plot.
+				if i == 0 && j == n-1 && level != "" {
+					p.Legend.Add(level, s)
+					p.Legend.Top = true
+				}
+			}
+
+			plots[i][j] = p
+		}
+	}
+
+	// Lay out the plots on a single canvas.
+	size := vg.Length(n) * 2.5 * vg.Inch
+	img, err := draw.NewFormattedCanvas(size, size, format)
+	if err != nil {
+		return err
+	}
+
+	dc := draw.New(img)
+	dc.SetColor(color.White)
+	dc.Fill(dc.Rectangle.Path())
+
+	t := draw.Tiles{
+		Rows:      n,
+		Cols:      n,
+		PadX:      vg.Millimeter,
+		PadY:      vg.Millimeter,
+		PadTop:    vg.Points(4),
+		PadBottom: vg.Points(4),
+		PadLeft:   vg.Points(4),
+		PadRight:  vg.Points(4),
+	}
+
+	canvases := plot.Align(plots, t, dc)
+	for i := range plots {
+		for j := range plots[i] {
+			plots[i][j].Draw(canvases[i][j])
+		}
+	}
+
+	// Save the canvas to a file.
+	out, err := os.Create("pairplot." + format)
+	if err != nil {
+		return err
+	}
+
+	if _, err := img.WriteTo(out); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
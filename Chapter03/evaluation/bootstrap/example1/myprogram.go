@@ -0,0 +1,441 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// Statistic computes a value from the rows of a sample given
+// by idx. Resampled rows may appear in idx more than once.
+type Statistic func(idx []int) float64
+
+// Config includes the settings for a bootstrap run.
+type Config struct {
+	Resamples int
+	Level     float64
+	Seed      int64
+	Workers   int
+}
+
+// Interval includes a confidence interval.
+type Interval struct {
+	Lower float64
+	Upper float64
+}
+
+// Result includes the point estimate of a statistic along
+// with its bootstrap confidence intervals.
+type Result struct {
+	Estimate   float64
+	StdErr     float64
+	Percentile Interval
+	Basic      Interval
+	BCa        Interval
+}
+
+func main() {
+
+	// Declare the bootstrap flags.
+	resamplesPtr := flag.Int("resamples", 2000, "The number of bootstrap resamples")
+	levelPtr := flag.Float64("level", 0.95, "The confidence level of the intervals")
+	seedPtr := flag.Int64("seed", 42, "The seed for the resampling")
+	workersPtr := flag.Int("workers", runtime.NumCPU(), "The number of goroutines used for resampling")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	cfg := Config{
+		Resamples: *resamplesPtr,
+		Level:     *levelPtr,
+		Seed:      *seedPtr,
+		Workers:   *workersPtr,
+	}
+
+	// Read in the continuous observations and predictions.
+	observed, predicted, err := readPairs("continuous_data.csv")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Define the regression metrics as statistics over row indices.
+	mae := func(idx []int) float64 {
+		var sum float64
+		for _, i := range idx {
+			sum += math.Abs(observed[i] - predicted[i])
+		}
+		return sum / float64(len(idx))
+	}
+
+	mse := func(idx []int) float64 {
+		var sum float64
+		for _, i := range idx {
+			sum += (observed[i] - predicted[i]) * (observed[i] - predicted[i])
+		}
+		return sum / float64(len(idx))
+	}
+
+	rSquared := func(idx []int) float64 {
+		obs := make([]float64, len(idx))
+		pred := make([]float64, len(idx))
+		for j, i := range idx {
+			obs[j] = observed[i]
+			pred[j] = predicted[i]
+		}
+		return stat.RSquaredFrom(pred, obs, nil)
+	}
+
+	// Read in the labeled observations and predictions.
+	labels, classes, err := readPairs("labeled.csv")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	accuracy := func(idx []int) float64 {
+		var correct int
+		for _, i := range idx {
+			if labels[i] == classes[i] {
+				correct++
+			}
+		}
+		return float64(correct) / float64(len(idx))
+	}
+
+	// precision returns the precision of a class as a statistic, which
+	// is NaN for resamples where the class is never predicted.
+	precision := func(class float64) Statistic {
+		return func(idx []int) float64 {
+			var truePos, predictedPos int
+			for _, i := range idx {
+				if classes[i] != class {
+					continue
+				}
+				predictedPos++
+				if labels[i] == class {
+					truePos++
+				}
+			}
+			return float64(truePos) / float64(predictedPos)
+		}
+	}
+
+	// recall returns the recall of a class as a statistic, which
+	// is NaN for resamples where the class is never observed.
+	recall := func(class float64) Statistic {
+		return func(idx []int) float64 {
+			var truePos, observedPos int
+			for _, i := range idx {
+				if labels[i] != class {
+					continue
+				}
+				observedPos++
+				if classes[i] == class {
+					truePos++
+				}
+			}
+			return float64(truePos) / float64(observedPos)
+		}
+	}
+
+	// Read in the binary labels and scores of the positive class.
+	outcomes, scores, err := readPairs("scored.csv")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	auc := func(idx []int) float64 {
+		s := make([]float64, len(idx))
+		positive := make([]bool, len(idx))
+		for j, i := range idx {
+			s[j] = scores[i]
+			positive[j] = outcomes[i] == 1
+		}
+		return AUC(s, positive)
+	}
+
+	// Calculate the bootstrap intervals for each metric.
+	metrics := []struct {
+		name string
+		n    int
+		fn   Statistic
+	}{
+		{"MAE", len(observed), mae},
+		{"MSE", len(observed), mse},
+		{"R^2", len(observed), rSquared},
+		{"Accuracy", len(labels), accuracy},
+		{"Prec (0)", len(labels), precision(0)},
+		{"Prec (1)", len(labels), precision(1)},
+		{"Prec (2)", len(labels), precision(2)},
+		{"Recall (0)", len(labels), recall(0)},
+		{"Recall (1)", len(labels), recall(1)},
+		{"Recall (2)", len(labels), recall(2)},
+		{"AUC", len(outcomes), auc},
+	}
+
+	fmt.Printf("\n%d resamples, %0.0f%% confidence intervals\n\n", cfg.Resamples, 100*cfg.Level)
+	fmt.Printf("%-10s %10s %10s %22s %22s %22s\n", "metric", "estimate", "std err", "percentile", "basic", "BCa")
+	for _, m := range metrics {
+		res, err := Bootstrap(m.n, m.fn, cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%-10s %10.4f %10.4f %22s %22s %22s\n", m.name, res.Estimate, res.StdErr,
+			res.Percentile, res.Basic, res.BCa)
+	}
+	fmt.Println()
+}
+
+// String formats the interval for output.
+func (i Interval) String() string {
+	return fmt.Sprintf("[%0.4f, %0.4f]", i.Lower, i.Upper)
+}
+
+// Bootstrap resamples the n rows of a sample with replacement and
+// calculates the percentile, basic and BCa intervals of the statistic.
+// Each resample uses its own source seeded from cfg.Seed, so the
+// results do not depend on the number of workers.
+func Bootstrap(n int, fn Statistic, cfg Config) (Result, error) {
+
+	if n < 2 {
+		return Result{}, errors.New("at least two rows are required")
+	}
+	if cfg.Resamples < 1 {
+		return Result{}, errors.New("at least one resample is required")
+	}
+	if cfg.Level <= 0 || cfg.Level >= 1 {
+		return Result{}, errors.New("confidence level must be between 0 and 1")
+	}
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+
+	// Calculate the statistic on the full sample.
+	all := make([]int, n)
+	for i := range all {
+		all[i] = i
+	}
+	estimate := fn(all)
+
+	// Calculate the statistic on each of the resamples.
+	replicates := make([]float64, cfg.Resamples)
+	parallel(cfg.Resamples, cfg.Workers, func(b int) {
+		rng := rand.New(rand.NewSource(cfg.Seed + int64(b)))
+		idx := make([]int, n)
+		for i := range idx {
+			idx[i] = rng.Intn(n)
+		}
+		replicates[b] = fn(idx)
+	})
+
+	// Drop the resamples where the statistic is undefined, e.g. the
+	// precision of a class that is never predicted.
+	defined := replicates[:0]
+	for _, r := range replicates {
+		if !math.IsNaN(r) {
+			defined = append(defined, r)
+		}
+	}
+	replicates = defined
+	if len(replicates) == 0 {
+		return Result{}, errors.New("the statistic is undefined in every resample")
+	}
+
+	// Calculate the leave-one-out jackknife values for the BCa acceleration.
+	jack := make([]float64, n)
+	parallel(n, cfg.Workers, func(i int) {
+		idx := make([]int, 0, n-1)
+		idx = append(idx, all[:i]...)
+		idx = append(idx, all[i+1:]...)
+		jack[i] = fn(idx)
+	})
+
+	sort.Float64s(replicates)
+	alpha := (1 - cfg.Level) / 2
+	lower := stat.Quantile(alpha, stat.Empirical, replicates, nil)
+	upper := stat.Quantile(1-alpha, stat.Empirical, replicates, nil)
+
+	return Result{
+		Estimate:   estimate,
+		StdErr:     stat.StdDev(replicates, nil),
+		Percentile: Interval{Lower: lower, Upper: upper},
+		Basic:      Interval{Lower: 2*estimate - upper, Upper: 2*estimate - lower},
+		BCa:        bca(estimate, replicates, jack, alpha),
+	}, nil
+}
+
+// parallel calls fn for each index in [0, n) using the given
+// number of goroutines.
+func parallel(n, workers int, fn func(i int)) {
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// bca calculates the bias-corrected and accelerated interval from the
+// sorted bootstrap replicates and the jackknife values.
+func bca(estimate float64, sorted, jack []float64, alpha float64) Interval {
+
+	// Calculate the bias correction from the proportion of
+	// replicates below the estimate.
+	var below float64
+	for _, r := range sorted {
+		if r < estimate {
+			below++
+		} else if r == estimate {
+			below += 0.5
+		}
+	}
+	z0 := distuv.UnitNormal.Quantile(below / float64(len(sorted)))
+
+	// Calculate the acceleration from the skewness of the jackknife values.
+	jackMean := stat.Mean(jack, nil)
+	var num, den float64
+	for _, j := range jack {
+		d := jackMean - j
+		num += d * d * d
+		den += d * d
+	}
+	var a float64
+	if den > 0 {
+		a = num / (6 * math.Pow(den, 1.5))
+	}
+
+	// Adjust the percentiles, falling back to the percentile interval
+	// when the correction is undefined, e.g. all replicates are equal.
+	adjust := func(p float64) float64 {
+		z := distuv.UnitNormal.Quantile(p)
+		return distuv.UnitNormal.CDF(z0 + (z0+z)/(1-a*(z0+z)))
+	}
+	pLower, pUpper := adjust(alpha), adjust(1-alpha)
+	if math.IsNaN(pLower) || math.IsNaN(pUpper) || math.IsInf(z0, 0) {
+		pLower, pUpper = alpha, 1-alpha
+	}
+
+	return Interval{
+		Lower: stat.Quantile(pLower, stat.Empirical, sorted, nil),
+		Upper: stat.Quantile(pUpper, stat.Empirical, sorted, nil),
+	}
+}
+
+// AUC returns the area under the ROC curve of the scores, which is the
+// probability that a random positive scores above a random negative,
+// counting ties as one half. It is NaN when either class is missing.
+func AUC(scores []float64, positive []bool) float64 {
+
+	// Sort the rows by score, keeping the labels alongside.
+	inds := make([]int, len(scores))
+	for i := range inds {
+		inds[i] = i
+	}
+	sort.Slice(inds, func(a, b int) bool { return scores[inds[a]] < scores[inds[b]] })
+
+	// Sum the average ranks of the positives.
+	var rankSum, nPos float64
+	for i := 0; i < len(inds); {
+		j := i
+		for j+1 < len(inds) && scores[inds[j+1]] == scores[inds[i]] {
+			j++
+		}
+		avg := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			if positive[inds[k]] {
+				rankSum += avg
+				nPos++
+			}
+		}
+		i = j + 1
+	}
+
+	nNeg := float64(len(scores)) - nPos
+	if nPos == 0 || nNeg == 0 {
+		return math.NaN()
+	}
+
+	return (rankSum - nPos*(nPos+1)/2) / (nPos * nNeg)
+}
+
+// readPairs reads a two column CSV file of float values with a header.
+func readPairs(path string) ([]float64, []float64, error) {
+
+	// Open the file.
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	// Create a new CSV reader reading from the opened file.
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = 2
+
+	var first, second []float64
+
+	// line will track row numbers for logging.
+	line := 1
+
+	for {
+
+		// Read in a row. Check if we are at the end of the file.
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Skip the header.
+		if line == 1 {
+			line++
+			continue
+		}
+
+		firstVal, err := strconv.ParseFloat(record[0], 64)
+		if err != nil {
+			log.Printf("Parsing line %d failed, unexpected type\n", line)
+			line++
+			continue
+		}
+
+		secondVal, err := strconv.ParseFloat(record[1], 64)
+		if err != nil {
+			log.Printf("Parsing line %d failed, unexpected type\n", line)
+			line++
+			continue
+		}
+
+		first = append(first, firstVal)
+		second = append(second, secondVal)
+		line++
+	}
+
+	return first, second, nil
+}
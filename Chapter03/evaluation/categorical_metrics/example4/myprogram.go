@@ -0,0 +1,426 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Metric is a ratio that may be undefined, e.g. the precision of
+// a class that is never predicted. Undefined values are NaN.
+type Metric float64
+
+// Undefined is the value of a Metric whose ratio has a zero denominator.
+var Undefined = Metric(math.NaN())
+
+// Defined reports whether the metric has a value.
+func (m Metric) Defined() bool {
+	return !math.IsNaN(float64(m))
+}
+
+// String formats the metric for output.
+func (m Metric) String() string {
+	if !m.Defined() {
+		return "undefined"
+	}
+	return strconv.FormatFloat(float64(m), 'f', 4, 64)
+}
+
+// MarshalJSON encodes undefined metrics as null.
+func (m Metric) MarshalJSON() ([]byte, error) {
+	if !m.Defined() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(float64(m))
+}
+
+// ConfusionMatrix includes the counts of observed (rows) and
+// predicted (columns) labels for the classes found in the data.
+type ConfusionMatrix struct {
+	Classes []interface{}
+	Counts  [][]int
+}
+
+// ClassMetrics includes the metrics for a single class.
+type ClassMetrics struct {
+	Class     string `json:"class"`
+	Precision Metric `json:"precision"`
+	Recall    Metric `json:"recall"`
+	F1        Metric `json:"f1"`
+	Support   int    `json:"support"`
+}
+
+// Averages includes the precision, recall and F1
+// averaged over the classes.
+type Averages struct {
+	Precision Metric `json:"precision"`
+	Recall    Metric `json:"recall"`
+	F1        Metric `json:"f1"`
+}
+
+// Report includes all of the classification metrics.
+type Report struct {
+	Classes          []string       `json:"classes"`
+	Confusion        [][]int        `json:"confusion_matrix"`
+	PerClass         []ClassMetrics `json:"per_class"`
+	Macro            Averages       `json:"macro_average"`
+	Micro            Averages       `json:"micro_average"`
+	Weighted         Averages       `json:"weighted_average"`
+	Accuracy         Metric         `json:"accuracy"`
+	BalancedAccuracy Metric         `json:"balanced_accuracy"`
+	Kappa            Metric         `json:"cohens_kappa"`
+	MCC              Metric         `json:"mcc"`
+}
+
+func main() {
+
+	// Declare the input and output flags.
+	inPtr := flag.String("in", "labeled.csv", "The CSV file of observed and predicted labels")
+	formatPtr := flag.String("format", "text", "The output format: text or json")
+	zeroDivPtr := flag.String("zeroDivision", "undefined", "The value of undefined ratios: undefined, 0 or 1")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Parse the value used in place of undefined ratios.
+	zeroDivision := Undefined
+	if *zeroDivPtr != "undefined" {
+		v, err := strconv.ParseFloat(*zeroDivPtr, 64)
+		if err != nil {
+			log.Fatalf("Invalid zeroDivision value %s", *zeroDivPtr)
+		}
+		zeroDivision = Metric(v)
+	}
+
+	// Read in the observed and predicted labels.
+	observed, predicted, err := readLabels(*inPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Build the confusion matrix and calculate the metrics.
+	cm, err := NewConfusionMatrix(observed, predicted)
+	if err != nil {
+		log.Fatal(err)
+	}
+	report := cm.Report(zeroDivision)
+
+	// Output the report in the requested format.
+	switch *formatPtr {
+	case "json":
+		outputData, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(outputData))
+	case "text":
+		if err := report.WriteText(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("Unknown format %s", *formatPtr)
+	}
+}
+
+// readLabels reads the observed and predicted labels from the first
+// two columns of a CSV file. Integer labels are parsed as ints and
+// any other labels are kept as strings.
+func readLabels(path string) ([]interface{}, []interface{}, error) {
+
+	// Open the labeled observations and predictions.
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	// Create a new CSV reader reading from the opened file.
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = 2
+
+	parse := func(val string) interface{} {
+		if i, err := strconv.Atoi(val); err == nil {
+			return i
+		}
+		return val
+	}
+
+	var observed, predicted []interface{}
+	line := 1
+	for {
+
+		// Read in a row. Check if we are at the end of the file.
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Skip the header.
+		if line == 1 {
+			line++
+			continue
+		}
+
+		observed = append(observed, parse(record[0]))
+		predicted = append(predicted, parse(record[1]))
+		line++
+	}
+
+	return observed, predicted, nil
+}
+
+// NewConfusionMatrix builds a confusion matrix from observed and
+// predicted labels of any comparable type. The classes are discovered
+// from both the observed and predicted labels.
+func NewConfusionMatrix(observed, predicted []interface{}) (*ConfusionMatrix, error) {
+
+	if len(observed) != len(predicted) {
+		return nil, errors.New("observed and predicted must have the same length")
+	}
+	if len(observed) == 0 {
+		return nil, errors.New("at least one label is required")
+	}
+
+	// Discover the classes.
+	seen := make(map[interface{}]bool)
+	var classes []interface{}
+	for _, labels := range [][]interface{}{observed, predicted} {
+		for _, label := range labels {
+			if label == nil || !reflect.TypeOf(label).Comparable() {
+				return nil, fmt.Errorf("label %v is not comparable", label)
+			}
+			if !seen[label] {
+				seen[label] = true
+				classes = append(classes, label)
+			}
+		}
+	}
+	sortLabels(classes)
+
+	index := make(map[interface{}]int)
+	for i, class := range classes {
+		index[class] = i
+	}
+
+	// Count the observed and predicted pairs.
+	counts := make([][]int, len(classes))
+	for i := range counts {
+		counts[i] = make([]int, len(classes))
+	}
+	for i := range observed {
+		counts[index[observed[i]]][index[predicted[i]]]++
+	}
+
+	return &ConfusionMatrix{Classes: classes, Counts: counts}, nil
+}
+
+// sortLabels sorts labels numerically if they are all numbers,
+// and by their string representation otherwise.
+func sortLabels(labels []interface{}) {
+
+	numeric := true
+	values := make(map[interface{}]float64)
+	for _, label := range labels {
+		v := reflect.ValueOf(label)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			values[label] = float64(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			values[label] = float64(v.Uint())
+		case reflect.Float32, reflect.Float64:
+			values[label] = v.Float()
+		default:
+			numeric = false
+		}
+	}
+
+	sort.SliceStable(labels, func(i, j int) bool {
+		if numeric {
+			return values[labels[i]] < values[labels[j]]
+		}
+		return fmt.Sprint(labels[i]) < fmt.Sprint(labels[j])
+	})
+}
+
+// ratio divides num by den, returning zeroDivision if den is zero.
+func ratio(num, den float64, zeroDivision Metric) Metric {
+	if den == 0 {
+		return zeroDivision
+	}
+	return Metric(num / den)
+}
+
+// average returns the weighted average of the defined metrics,
+// or Undefined if none of them are defined.
+func average(metrics []Metric, weights []float64) Metric {
+	var sum, total float64
+	for i, m := range metrics {
+		if !m.Defined() {
+			continue
+		}
+		sum += float64(m) * weights[i]
+		total += weights[i]
+	}
+	return ratio(sum, total, Undefined)
+}
+
+// Report calculates the classification metrics from the confusion
+// matrix. Ratios with a zero denominator take the zeroDivision value,
+// and undefined values are left out of the macro and weighted averages.
+func (cm *ConfusionMatrix) Report(zeroDivision Metric) Report {
+
+	k := len(cm.Classes)
+	report := Report{Confusion: cm.Counts}
+
+	// Calculate the row (observed) and column (predicted) totals.
+	observedTotals := make([]float64, k)
+	predictedTotals := make([]float64, k)
+	var total, correct float64
+	for i := 0; i < k; i++ {
+		for j := 0; j < k; j++ {
+			c := float64(cm.Counts[i][j])
+			observedTotals[i] += c
+			predictedTotals[j] += c
+			total += c
+		}
+		correct += float64(cm.Counts[i][i])
+	}
+
+	// Calculate the per class metrics.
+	var precisions, recalls, f1s []Metric
+	var ones, supports, presentRecalls []float64
+	for i, class := range cm.Classes {
+		tp := float64(cm.Counts[i][i])
+		precision := ratio(tp, predictedTotals[i], zeroDivision)
+		recall := ratio(tp, observedTotals[i], zeroDivision)
+
+		// Calculate F1 from the counts, so that it is still defined
+		// when only one of the precision and recall is.
+		fp := predictedTotals[i] - tp
+		fn := observedTotals[i] - tp
+		f1 := ratio(2*tp, 2*tp+fp+fn, zeroDivision)
+
+		report.Classes = append(report.Classes, fmt.Sprint(class))
+		report.PerClass = append(report.PerClass, ClassMetrics{
+			Class:     fmt.Sprint(class),
+			Precision: precision,
+			Recall:    recall,
+			F1:        f1,
+			Support:   int(observedTotals[i]),
+		})
+
+		precisions = append(precisions, precision)
+		recalls = append(recalls, recall)
+		f1s = append(f1s, f1)
+		ones = append(ones, 1)
+		supports = append(supports, observedTotals[i])
+
+		// Balanced accuracy only averages over classes that are observed.
+		if observedTotals[i] > 0 {
+			presentRecalls = append(presentRecalls, tp/observedTotals[i])
+		}
+	}
+
+	report.Macro = Averages{
+		Precision: average(precisions, ones),
+		Recall:    average(recalls, ones),
+		F1:        average(f1s, ones),
+	}
+	report.Weighted = Averages{
+		Precision: average(precisions, supports),
+		Recall:    average(recalls, supports),
+		F1:        average(f1s, supports),
+	}
+
+	// For single label data the micro averages all equal the accuracy.
+	report.Accuracy = ratio(correct, total, zeroDivision)
+	report.Micro = Averages{
+		Precision: report.Accuracy,
+		Recall:    report.Accuracy,
+		F1:        report.Accuracy,
+	}
+
+	var sumRecalls float64
+	for _, r := range presentRecalls {
+		sumRecalls += r
+	}
+	report.BalancedAccuracy = ratio(sumRecalls, float64(len(presentRecalls)), zeroDivision)
+
+	// Calculate Cohen's kappa from the observed and chance agreement.
+	var chance, sumSqObserved, sumSqPredicted, crossTotals float64
+	for i := 0; i < k; i++ {
+		chance += observedTotals[i] * predictedTotals[i] / (total * total)
+		sumSqObserved += observedTotals[i] * observedTotals[i]
+		sumSqPredicted += predictedTotals[i] * predictedTotals[i]
+		crossTotals += observedTotals[i] * predictedTotals[i]
+	}
+	report.Kappa = ratio(correct/total-chance, 1-chance, zeroDivision)
+
+	// Calculate the multiclass Matthews correlation coefficient.
+	den := math.Sqrt((total*total - sumSqPredicted) * (total*total - sumSqObserved))
+	report.MCC = ratio(correct*total-crossTotals, den, zeroDivision)
+
+	return report
+}
+
+// WriteText writes the report as text tables.
+func (r Report) WriteText(out io.Writer) error {
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	// Write the confusion matrix.
+	fmt.Fprintf(w, "\nobserved \\ predicted\t")
+	for _, class := range r.Classes {
+		fmt.Fprintf(w, "%s\t", class)
+	}
+	fmt.Fprintln(w)
+	for i, row := range r.Confusion {
+		fmt.Fprintf(w, "%s\t", r.Classes[i])
+		for _, c := range row {
+			fmt.Fprintf(w, "%d\t", c)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w)
+
+	// Write the per class metrics and averages.
+	fmt.Fprintf(w, "class\tprecision\trecall\tf1\tsupport\t\n")
+	var support int
+	for _, c := range r.PerClass {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t\n", c.Class, c.Precision, c.Recall, c.F1, c.Support)
+		support += c.Support
+	}
+	fmt.Fprintln(w)
+	for _, avg := range []struct {
+		name string
+		a    Averages
+	}{
+		{"micro avg", r.Micro},
+		{"macro avg", r.Macro},
+		{"weighted avg", r.Weighted},
+	} {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t\n", avg.name, avg.a.Precision, avg.a.Recall, avg.a.F1, support)
+	}
+	fmt.Fprintln(w)
+
+	// Write the summary metrics.
+	fmt.Fprintf(w, "accuracy\t%s\t\n", r.Accuracy)
+	fmt.Fprintf(w, "balanced accuracy\t%s\t\n", r.BalancedAccuracy)
+	fmt.Fprintf(w, "Cohen's kappa\t%s\t\n", r.Kappa)
+	fmt.Fprintf(w, "MCC\t%s\t\n\n", r.MCC)
+
+	return w.Flush()
+}
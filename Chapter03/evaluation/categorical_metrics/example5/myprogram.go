@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+)
+
+// Curve includes the ROC and precision-recall curves for one class,
+// along with the summary metrics and optimal thresholds.
+type Curve struct {
+	Class            string
+	Thresholds       []float64
+	TPR              []float64
+	FPR              []float64
+	Precision        []float64
+	AUC              float64
+	AveragePrecision float64
+	YoudenThreshold  float64
+	YoudenJ          float64
+	F1Threshold      float64
+	F1               float64
+}
+
+// ThresholdInfo includes the decision threshold that is written
+// out for use by a classifier at prediction time.
+type ThresholdInfo struct {
+	PositiveClass string  `json:"positive_class"`
+	Criterion     string  `json:"criterion"`
+	Threshold     float64 `json:"threshold"`
+}
+
+func main() {
+
+	// Declare the input and output flags.
+	inPtr := flag.String("in", "scored.csv", "The CSV file with a label column followed by score columns")
+	positivePtr := flag.String("positive", "1", "The positive class when there is a single score column")
+	criterionPtr := flag.String("criterion", "youden", "The threshold written out: youden or f1")
+	outPtr := flag.String("out", "threshold.json", "The output file for the chosen threshold")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Read in the labels and scores.
+	header, labels, scores, err := readScores(*inPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// With a single score column, the score is for the positive class.
+	// Otherwise each score column is named after the class it scores
+	// and we calculate one-vs-rest curves.
+	classes := header
+	if len(header) == 1 {
+		classes = []string{*positivePtr}
+	}
+
+	var curves []Curve
+	for j, class := range classes {
+		positives := make([]bool, len(labels))
+		for i, label := range labels {
+			positives[i] = label == class
+		}
+
+		curve, err := NewCurve(class, scores[j], positives)
+		if err != nil {
+			log.Fatal(err)
+		}
+		curves = append(curves, curve)
+	}
+
+	// Output the metrics to standard out.
+	fmt.Printf("\n%-10s %8s %8s %18s %18s\n", "class", "ROC-AUC", "AP", "Youden (J)", "F1-optimal (F1)")
+	for _, c := range curves {
+		fmt.Printf("%-10s %8.4f %8.4f %18s %18s\n", c.Class, c.AUC, c.AveragePrecision,
+			fmt.Sprintf("%0.4f (%0.3f)", c.YoudenThreshold, c.YoudenJ),
+			fmt.Sprintf("%0.4f (%0.3f)", c.F1Threshold, c.F1))
+	}
+	fmt.Println()
+
+	// Save the ROC and precision-recall plots.
+	if err := plotCurves(curves, "roc.png", "False positive rate", "True positive rate", func(c Curve) ([]float64, []float64) {
+		return c.FPR, c.TPR
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := plotCurves(curves, "pr.png", "Recall", "Precision", func(c Curve) ([]float64, []float64) {
+		return c.TPR[1:], c.Precision[1:]
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	// Write out the chosen threshold for binary scores.
+	if len(curves) != 1 {
+		return
+	}
+
+	info := ThresholdInfo{
+		PositiveClass: curves[0].Class,
+		Criterion:     *criterionPtr,
+	}
+	switch *criterionPtr {
+	case "youden":
+		info.Threshold = curves[0].YoudenThreshold
+	case "f1":
+		info.Threshold = curves[0].F1Threshold
+	default:
+		log.Fatalf("Unknown criterion %s", *criterionPtr)
+	}
+
+	outputData, err := json.MarshalIndent(info, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(*outPtr, outputData, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// readScores reads a CSV file with the label in the first column and
+// one or more score columns. It returns the score column names, the
+// labels and the scores by column.
+func readScores(path string) ([]string, []string, [][]float64, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(records) < 2 || len(records[0]) < 2 {
+		return nil, nil, nil, errors.New("expected a header, a label column and at least one score column")
+	}
+
+	header := records[0][1:]
+	labels := make([]string, 0, len(records)-1)
+	scores := make([][]float64, len(header))
+	for i, record := range records[1:] {
+		labels = append(labels, strings.TrimSpace(record[0]))
+		for j := range header {
+			val, err := strconv.ParseFloat(record[j+1], 64)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+			}
+			scores[j] = append(scores[j], val)
+		}
+	}
+
+	return header, labels, scores, nil
+}
+
+// NewCurve calculates the ROC and precision-recall curves of the scores
+// for the positive observations. Observations with tied scores are
+// added to the curves together, so a tie between a positive and a
+// negative gives a diagonal ROC segment rather than an arbitrary step.
+func NewCurve(class string, scores []float64, positives []bool) (Curve, error) {
+
+	// Count the positive and negative observations.
+	var nPos, nNeg float64
+	for _, p := range positives {
+		if p {
+			nPos++
+		} else {
+			nNeg++
+		}
+	}
+	if nPos == 0 || nNeg == 0 {
+		return Curve{}, fmt.Errorf("class %s needs both positive and negative observations", class)
+	}
+
+	// Order the observations by decreasing score.
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+
+	// Start the curves at the threshold above all scores.
+	c := Curve{
+		Class:      class,
+		Thresholds: []float64{math.Inf(1)},
+		TPR:        []float64{0},
+		FPR:        []float64{0},
+		Precision:  []float64{1},
+		YoudenJ:    math.Inf(-1),
+		F1:         math.Inf(-1),
+	}
+
+	var tp, fp float64
+	for i := 0; i < len(order); {
+
+		// Add all observations tied at this score.
+		threshold := scores[order[i]]
+		for i < len(order) && scores[order[i]] == threshold {
+			if positives[order[i]] {
+				tp++
+			} else {
+				fp++
+			}
+			i++
+		}
+
+		tpr := tp / nPos
+		fpr := fp / nNeg
+		precision := tp / (tp + fp)
+
+		// Accumulate the trapezoidal ROC area and the step-wise
+		// average precision.
+		prevTPR := c.TPR[len(c.TPR)-1]
+		prevFPR := c.FPR[len(c.FPR)-1]
+		c.AUC += (fpr - prevFPR) * (tpr + prevTPR) / 2
+		c.AveragePrecision += (tpr - prevTPR) * precision
+
+		c.Thresholds = append(c.Thresholds, threshold)
+		c.TPR = append(c.TPR, tpr)
+		c.FPR = append(c.FPR, fpr)
+		c.Precision = append(c.Precision, precision)
+
+		// Track the thresholds maximizing Youden's J and F1.
+		if j := tpr - fpr; j > c.YoudenJ {
+			c.YoudenJ = j
+			c.YoudenThreshold = threshold
+		}
+		if f1 := 2 * tp / (2*tp + fp + (nPos - tp)); f1 > c.F1 {
+			c.F1 = f1
+			c.F1Threshold = threshold
+		}
+	}
+
+	return c, nil
+}
+
+// plotCurves saves a plot with one line per curve, using xy
+// to select the values plotted from each curve.
+func plotCurves(curves []Curve, path, xLabel, yLabel string, xy func(Curve) ([]float64, []float64)) error {
+
+	p, err := plot.New()
+	if err != nil {
+		return err
+	}
+	p.X.Label.Text = xLabel
+	p.Y.Label.Text = yLabel
+	p.X.Min, p.X.Max = 0, 1
+	p.Y.Min, p.Y.Max = 0, 1
+	p.Add(plotter.NewGrid())
+	p.Legend.XOffs = -vg.Points(10)
+	p.Legend.YOffs = vg.Points(10)
+
+	for k, c := range curves {
+		xs, ys := xy(c)
+		pts := make(plotter.XYs, len(xs))
+		for i := range xs {
+			pts[i].X = xs[i]
+			pts[i].Y = ys[i]
+		}
+
+		l, err := plotter.NewLine(pts)
+		if err != nil {
+			return err
+		}
+		l.LineStyle.Color = plotutil.Color(k)
+		l.LineStyle.Width = vg.Points(1.5)
+		p.Add(l)
+		p.Legend.Add(c.Class, l)
+	}
+
+	return p.Save(5*vg.Inch, 5*vg.Inch, path)
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+)
+
+// Metrics includes the regression evaluation metrics.
+type Metrics struct {
+	MAE               float64
+	MSE               float64
+	RMSE              float64
+	MAPE              float64
+	MAPESkipped       int
+	SMAPE             float64
+	MedianAE          float64
+	MaxError          float64
+	ExplainedVariance float64
+	RSquared          float64
+	AdjRSquared       float64
+}
+
+// Diagnostics includes the residual diagnostics.
+type Diagnostics struct {
+	DurbinWatson   float64
+	BreuschPagan   float64
+	BreuschPaganDF int
+	BreuschPaganP  float64
+}
+
+func main() {
+
+	// Declare the input flags.
+	inPtr := flag.String("in", "continuous_data.csv", "The CSV file of observed values, predictions and optional features")
+	predictorsPtr := flag.Int("predictors", 1, "The number of predictors in the model, for the adjusted R^2")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Read in the observed values, predictions and any feature columns.
+	observed, predicted, features, err := readData(*inPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Calculate the metrics.
+	m, err := Evaluate(observed, predicted, *predictorsPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Calculate the residuals.
+	residuals := make([]float64, len(observed))
+	for i := range observed {
+		residuals[i] = observed[i] - predicted[i]
+	}
+
+	// Without feature columns, test for heteroscedasticity
+	// against the fitted values.
+	if features == nil {
+		features = [][]float64{predicted}
+	}
+
+	d, err := Diagnose(residuals, features)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Output the results to standard out.
+	fmt.Printf("\nMAE = %0.4f\n", m.MAE)
+	fmt.Printf("MSE = %0.4f\n", m.MSE)
+	fmt.Printf("RMSE = %0.4f\n", m.RMSE)
+	fmt.Printf("MAPE = %0.2f%% (%d zero observations skipped)\n", 100*m.MAPE, m.MAPESkipped)
+	fmt.Printf("sMAPE = %0.2f%%\n", 100*m.SMAPE)
+	fmt.Printf("Median AE = %0.4f\n", m.MedianAE)
+	fmt.Printf("Max error = %0.4f\n", m.MaxError)
+	fmt.Printf("Explained variance = %0.4f\n", m.ExplainedVariance)
+	fmt.Printf("R^2 = %0.4f\n", m.RSquared)
+	fmt.Printf("Adjusted R^2 = %0.4f\n\n", m.AdjRSquared)
+
+	fmt.Printf("Durbin-Watson = %0.4f (values near 2 indicate no autocorrelation)\n", d.DurbinWatson)
+	fmt.Printf("Breusch-Pagan LM = %0.4f, df = %d, p-value = %0.4g\n\n", d.BreuschPagan, d.BreuschPaganDF, d.BreuschPaganP)
+
+	// Save the residual plots.
+	if err := residualsVsFitted(predicted, residuals, "residuals_vs_fitted.png"); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := qqPlot(residuals, "residuals_qq.png"); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := residualHist(residuals, "residuals_hist.png"); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// readData reads a CSV file with observed values in the first column,
+// predictions in the second and any feature columns after those.
+func readData(path string) ([]float64, []float64, [][]float64, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(records) < 2 || len(records[0]) < 2 {
+		return nil, nil, nil, errors.New("expected a header and observed and predicted columns")
+	}
+
+	nFeatures := len(records[0]) - 2
+	var observed, predicted []float64
+	var features [][]float64
+	if nFeatures > 0 {
+		features = make([][]float64, nFeatures)
+	}
+
+	for i, record := range records[1:] {
+		vals := make([]float64, len(record))
+		for j, raw := range record {
+			vals[j], err = strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+			}
+		}
+
+		observed = append(observed, vals[0])
+		predicted = append(predicted, vals[1])
+		for j := 0; j < nFeatures; j++ {
+			features[j] = append(features[j], vals[j+2])
+		}
+	}
+
+	return observed, predicted, features, nil
+}
+
+// Evaluate calculates the regression metrics for a model with the
+// given number of predictors. Observations equal to zero are
+// skipped in the MAPE, where the ratio is undefined.
+func Evaluate(observed, predicted []float64, predictors int) (Metrics, error) {
+
+	n := len(observed)
+	if n == 0 || n != len(predicted) {
+		return Metrics{}, errors.New("observed and predicted must be non-empty and the same length")
+	}
+	if predictors < 0 || n-predictors-1 <= 0 {
+		return Metrics{}, errors.New("not enough observations for the number of predictors")
+	}
+
+	var m Metrics
+	var mapeCount int
+	errs := make([]float64, n)
+	absErrs := make([]float64, n)
+	for i, o := range observed {
+		e := o - predicted[i]
+		errs[i] = e
+		absErrs[i] = math.Abs(e)
+
+		m.MAE += absErrs[i]
+		m.MSE += e * e
+		m.MaxError = math.Max(m.MaxError, absErrs[i])
+
+		if o != 0 {
+			m.MAPE += absErrs[i] / math.Abs(o)
+			mapeCount++
+		} else {
+			m.MAPESkipped++
+		}
+
+		if den := math.Abs(o) + math.Abs(predicted[i]); den != 0 {
+			m.SMAPE += 2 * absErrs[i] / den
+		}
+	}
+
+	m.MAE /= float64(n)
+	m.MSE /= float64(n)
+	m.RMSE = math.Sqrt(m.MSE)
+	m.SMAPE /= float64(n)
+	if mapeCount > 0 {
+		m.MAPE /= float64(mapeCount)
+	} else {
+		m.MAPE = math.NaN()
+	}
+
+	sort.Float64s(absErrs)
+	m.MedianAE = stat.Quantile(0.5, stat.Empirical, absErrs, nil)
+
+	// Calculate the variance based metrics.
+	varObserved := stat.Variance(observed, nil)
+	m.ExplainedVariance = 1 - stat.Variance(errs, nil)/varObserved
+	m.RSquared = stat.RSquaredFrom(predicted, observed, nil)
+	m.AdjRSquared = 1 - (1-m.RSquared)*float64(n-1)/float64(n-predictors-1)
+
+	return m, nil
+}
+
+// Diagnose calculates the Durbin–Watson statistic of the residuals and
+// Koenker's studentized Breusch–Pagan test, regressing the squared
+// residuals on the given regressors.
+func Diagnose(residuals []float64, regressors [][]float64) (Diagnostics, error) {
+
+	n := len(residuals)
+	k := len(regressors)
+	if n <= k+1 {
+		return Diagnostics{}, errors.New("not enough observations for the Breusch-Pagan test")
+	}
+
+	var d Diagnostics
+
+	// Calculate the Durbin–Watson statistic.
+	var num, den float64
+	for i, e := range residuals {
+		den += e * e
+		if i > 0 {
+			diff := e - residuals[i-1]
+			num += diff * diff
+		}
+	}
+	d.DurbinWatson = num / den
+
+	// Regress the squared residuals on the regressors plus an intercept.
+	x := mat.NewDense(n, k+1, nil)
+	y := mat.NewVecDense(n, nil)
+	for i, e := range residuals {
+		x.Set(i, 0, 1)
+		for j, reg := range regressors {
+			x.Set(i, j+1, reg[i])
+		}
+		y.SetVec(i, e*e)
+	}
+
+	var beta mat.VecDense
+	if err := beta.SolveVec(x, y); err != nil {
+		return Diagnostics{}, err
+	}
+
+	var fitted mat.VecDense
+	fitted.MulVec(x, &beta)
+
+	// The LM statistic is n times the R^2 of the auxiliary regression.
+	rSquared := stat.RSquaredFrom(fitted.RawVector().Data, y.RawVector().Data, nil)
+	d.BreuschPagan = float64(n) * rSquared
+	d.BreuschPaganDF = k
+	d.BreuschPaganP = distuv.ChiSquared{K: float64(k)}.Survival(d.BreuschPagan)
+
+	return d, nil
+}
+
+// residualsVsFitted saves a scatter plot of the residuals against
+// the fitted values with a reference line at zero.
+func residualsVsFitted(fitted, residuals []float64, path string) error {
+
+	p, err := plot.New()
+	if err != nil {
+		return err
+	}
+	p.Title.Text = "Residuals vs fitted"
+	p.X.Label.Text = "Fitted"
+	p.Y.Label.Text = "Residual"
+	p.Add(plotter.NewGrid())
+
+	pts := make(plotter.XYs, len(fitted))
+	for i := range fitted {
+		pts[i].X = fitted[i]
+		pts[i].Y = residuals[i]
+	}
+
+	s, err := plotter.NewScatter(pts)
+	if err != nil {
+		return err
+	}
+	s.GlyphStyle.Radius = vg.Points(2)
+	p.Add(s)
+
+	zero := plotter.NewFunction(func(float64) float64 { return 0 })
+	zero.Dashes = []vg.Length{vg.Points(4), vg.Points(4)}
+	p.Add(zero)
+
+	return p.Save(5*vg.Inch, 4*vg.Inch, path)
+}
+
+// qqPlot saves a normal Q-Q plot of the standardized residuals.
+func qqPlot(residuals []float64, path string) error {
+
+	mean, std := stat.MeanStdDev(residuals, nil)
+	sorted := make([]float64, len(residuals))
+	for i, e := range residuals {
+		sorted[i] = (e - mean) / std
+	}
+	sort.Float64s(sorted)
+
+	// Plot each ordered residual against the normal quantile
+	// of its plotting position.
+	n := float64(len(sorted))
+	pts := make(plotter.XYs, len(sorted))
+	for i, v := range sorted {
+		pts[i].X = distuv.UnitNormal.Quantile((float64(i) + 0.5) / n)
+		pts[i].Y = v
+	}
+
+	p, err := plot.New()
+	if err != nil {
+		return err
+	}
+	p.Title.Text = "Normal Q-Q"
+	p.X.Label.Text = "Theoretical quantiles"
+	p.Y.Label.Text = "Standardized residuals"
+	p.Add(plotter.NewGrid())
+
+	s, err := plotter.NewScatter(pts)
+	if err != nil {
+		return err
+	}
+	s.GlyphStyle.Radius = vg.Points(2)
+	p.Add(s)
+
+	line := plotter.NewFunction(func(x float64) float64 { return x })
+	line.Dashes = []vg.Length{vg.Points(4), vg.Points(4)}
+	p.Add(line)
+
+	return p.Save(4*vg.Inch, 4*vg.Inch, path)
+}
+
+// residualHist saves a normalized histogram of the residuals.
+func residualHist(residuals []float64, path string) error {
+
+	p, err := plot.New()
+	if err != nil {
+		return err
+	}
+	p.Title.Text = "Histogram of residuals"
+
+	h, err := plotter.NewHist(plotter.Values(residuals), 16)
+	if err != nil {
+		return err
+	}
+	h.Normalize(1)
+	p.Add(h)
+
+	return p.Save(4*vg.Inch, 4*vg.Inch, path)
+}
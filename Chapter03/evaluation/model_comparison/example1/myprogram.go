@@ -0,0 +1,520 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+)
+
+// McNemarResult includes the outcome of McNemar's test on the paired
+// predictions of two models.
+type McNemarResult struct {
+	OnlyA     int
+	OnlyB     int
+	Statistic float64
+	PValue    float64
+	Exact     bool
+}
+
+// TTestResult includes the outcome of the corrected resampled t-test
+// on the paired fold scores of two models.
+type TTestResult struct {
+	MeanDiff float64
+	T        float64
+	DF       int
+	PValue   float64
+}
+
+// FriedmanResult includes the outcome of the Friedman test and the
+// Nemenyi critical difference for models scored on several datasets.
+type FriedmanResult struct {
+	AvgRanks  []float64
+	ChiSquare float64
+	PValue    float64
+	FF        float64
+	FFPValue  float64
+	CD        float64
+}
+
+// nemenyiQ holds the critical values of the studentized range statistic
+// divided by sqrt(2) for 2 to 10 models, from Demšar (2006).
+var nemenyiQ = map[float64][]float64{
+	0.05: {1.960, 2.343, 2.569, 2.728, 2.850, 2.949, 3.031, 3.102, 3.164},
+	0.10: {1.645, 2.052, 2.291, 2.459, 2.589, 2.693, 2.780, 2.855, 2.920},
+}
+
+func main() {
+
+	// Declare the input flags. The default files are written by
+	// ../example2, which cross validates kNN, a decision tree, naive
+	// Bayes and a nearest centroid model on the book's classification
+	// datasets: the out-of-fold predictions on iris, the accuracy in
+	// each of 10 repetitions of 5-fold cross validation on the loans
+	// data, and the mean 5-fold accuracy on each dataset.
+	predictionsPtr := flag.String("predictions", "predictions.csv", "The CSV file of observed labels followed by one column of predictions per model")
+	foldsPtr := flag.String("folds", "fold_scores.csv", "The CSV file of per-fold scores, one column per model")
+	testRatioPtr := flag.Float64("testRatio", 0.25, "The ratio of test to training rows in each fold")
+	scoresPtr := flag.String("scores", "scores.csv", "The CSV file of a dataset column followed by one score column per model")
+	lowerPtr := flag.Bool("lowerIsBetter", false, "Whether lower scores are better, e.g. for error metrics")
+	alphaPtr := flag.Float64("alpha", 0.05, "The significance level, 0.05 or 0.10")
+	plotPtr := flag.String("plot", "cd.png", "The output file for the critical difference plot")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Compare each pair of models on the same predictions
+	// with McNemar's test.
+	if *predictionsPtr != "" {
+		header, cols, err := readColumns(*predictionsPtr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(cols) < 3 {
+			log.Fatal("expected an observed column and at least two models")
+		}
+
+		fmt.Printf("\nMcNemar's test (%d paired predictions)\n\n", len(cols[0]))
+		fmt.Printf("%-36s %8s %8s %10s %10s\n", "models", "only A", "only B", "statistic", "p-value")
+		for a := 1; a < len(cols); a++ {
+			for b := a + 1; b < len(cols); b++ {
+				res, err := McNemar(cols[0], cols[a], cols[b])
+				if err != nil {
+					log.Fatal(err)
+				}
+				statistic := fmt.Sprintf("%0.4f", res.Statistic)
+				if res.Exact {
+					statistic = "exact"
+				}
+				fmt.Printf("%-36s %8d %8d %10s %10.4f%s\n", header[a]+" vs "+header[b], res.OnlyA, res.OnlyB,
+					statistic, res.PValue, significance(res.PValue, *alphaPtr))
+			}
+		}
+	}
+
+	// Compare each pair of models on their cross validation
+	// fold scores with the corrected resampled t-test.
+	if *foldsPtr != "" {
+		header, cols, err := readColumns(*foldsPtr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		scores, err := parseColumns(cols)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("\nCorrected resampled t-test (%d folds, test/train = %0.3f)\n\n", len(scores[0]), *testRatioPtr)
+		fmt.Printf("%-36s %10s %8s %10s\n", "models", "mean diff", "t", "p-value")
+		for a := range scores {
+			for b := a + 1; b < len(scores); b++ {
+				res, err := CorrectedTTest(scores[a], scores[b], *testRatioPtr)
+				if err != nil {
+					log.Fatal(err)
+				}
+				fmt.Printf("%-36s %10.4f %8.4f %10.4f%s\n", header[a]+" vs "+header[b], res.MeanDiff, res.T,
+					res.PValue, significance(res.PValue, *alphaPtr))
+			}
+		}
+	}
+
+	// Rank the models across datasets with the Friedman test
+	// and the Nemenyi post-hoc test.
+	if *scoresPtr != "" {
+		header, cols, err := readColumns(*scoresPtr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		models := header[1:]
+		byModel, err := parseColumns(cols[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Arrange the scores with one row per dataset.
+		scores := make([][]float64, len(cols[0]))
+		for i := range scores {
+			scores[i] = make([]float64, len(models))
+			for j := range models {
+				scores[i][j] = byModel[j][i]
+			}
+		}
+
+		res, err := Friedman(scores, !*lowerPtr, *alphaPtr)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("\nFriedman test (%d models, %d datasets)\n\n", len(models), len(scores))
+		fmt.Printf("Chi-square = %0.4f, p-value = %0.4f\n", res.ChiSquare, res.PValue)
+		fmt.Printf("Iman-Davenport F = %0.4f, p-value = %0.4f\n", res.FF, res.FFPValue)
+
+		fmt.Print(cdSummary(models, res, *alphaPtr))
+
+		if *plotPtr != "" {
+			if err := cdPlot(models, res, *plotPtr); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	fmt.Println()
+}
+
+// McNemar tests whether two models make errors on different
+// proportions of the observations. It uses the exact binomial test
+// when fewer than 25 observations are classified correctly by only
+// one of the models, and the continuity corrected chi-square
+// statistic otherwise.
+func McNemar(observed, a, b []string) (McNemarResult, error) {
+
+	if len(observed) != len(a) || len(observed) != len(b) {
+		return McNemarResult{}, errors.New("the predictions must be paired with the observations")
+	}
+
+	var res McNemarResult
+	for i, o := range observed {
+		switch {
+		case a[i] == o && b[i] != o:
+			res.OnlyA++
+		case a[i] != o && b[i] == o:
+			res.OnlyB++
+		}
+	}
+
+	discordant := res.OnlyA + res.OnlyB
+	switch {
+	case discordant == 0:
+		res.PValue = 1
+
+	case discordant < 25:
+		res.Exact = true
+		k := float64(res.OnlyA)
+		if res.OnlyB < res.OnlyA {
+			k = float64(res.OnlyB)
+		}
+		binom := distuv.Binomial{N: float64(discordant), P: 0.5}
+		res.PValue = math.Min(1, 2*binom.CDF(k))
+
+	default:
+		d := math.Abs(float64(res.OnlyA-res.OnlyB)) - 1
+		res.Statistic = d * d / float64(discordant)
+		res.PValue = distuv.ChiSquared{K: 1}.Survival(res.Statistic)
+	}
+
+	return res, nil
+}
+
+// CorrectedTTest compares the scores of two models on the same folds
+// with the Nadeau and Bengio corrected resampled t-test. The variance
+// of the differences is inflated by the ratio of test to training rows
+// to account for the overlap between the training sets of the folds.
+func CorrectedTTest(a, b []float64, testRatio float64) (TTestResult, error) {
+
+	k := len(a)
+	if k < 2 || k != len(b) {
+		return TTestResult{}, errors.New("at least two paired fold scores are required")
+	}
+
+	diffs := make([]float64, k)
+	for i := range a {
+		diffs[i] = a[i] - b[i]
+	}
+	mean, variance := stat.MeanVariance(diffs, nil)
+
+	res := TTestResult{MeanDiff: mean, DF: k - 1}
+	if variance == 0 {
+		if mean == 0 {
+			res.PValue = 1
+			return res, nil
+		}
+		return TTestResult{}, errors.New("the fold differences have zero variance")
+	}
+
+	res.T = mean / math.Sqrt((1/float64(k)+testRatio)*variance)
+	t := distuv.StudentsT{Mu: 0, Sigma: 1, Nu: float64(res.DF)}
+	res.PValue = 2 * t.Survival(math.Abs(res.T))
+
+	return res, nil
+}
+
+// Friedman ranks the models on each dataset, with rank 1 the best and
+// ties given their average rank, and tests whether the average ranks
+// differ. It also calculates the Nemenyi critical difference, the
+// difference in average rank needed for two models to be
+// significantly different at the given level.
+func Friedman(scores [][]float64, higherIsBetter bool, alpha float64) (FriedmanResult, error) {
+
+	n := len(scores)
+	if n < 2 {
+		return FriedmanResult{}, errors.New("at least two datasets are required")
+	}
+	k := len(scores[0])
+	q, ok := nemenyiQ[alpha]
+	if !ok {
+		return FriedmanResult{}, errors.New("alpha must be 0.05 or 0.10")
+	}
+	if k < 2 || k-2 >= len(q) {
+		return FriedmanResult{}, fmt.Errorf("the Nemenyi test supports 2 to %d models", len(q)+1)
+	}
+
+	res := FriedmanResult{AvgRanks: make([]float64, k)}
+	for _, row := range scores {
+		for j, r := range rank(row, higherIsBetter) {
+			res.AvgRanks[j] += r / float64(n)
+		}
+	}
+
+	var sumSq float64
+	for _, r := range res.AvgRanks {
+		sumSq += r * r
+	}
+	kf, nf := float64(k), float64(n)
+	res.ChiSquare = 12 * nf / (kf * (kf + 1)) * (sumSq - kf*(kf+1)*(kf+1)/4)
+	res.PValue = distuv.ChiSquared{K: kf - 1}.Survival(res.ChiSquare)
+
+	// Iman and Davenport's F statistic is less conservative
+	// than the chi-square statistic.
+	if den := nf*(kf-1) - res.ChiSquare; den > 0 {
+		res.FF = (nf - 1) * res.ChiSquare / den
+		res.FFPValue = distuv.F{D1: kf - 1, D2: (kf - 1) * (nf - 1)}.Survival(res.FF)
+	}
+
+	res.CD = q[k-2] * math.Sqrt(kf*(kf+1)/(6*nf))
+
+	return res, nil
+}
+
+// rank ranks the scores from best to worst starting at 1,
+// giving tied scores their average rank.
+func rank(scores []float64, higherIsBetter bool) []float64 {
+
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		if higherIsBetter {
+			return scores[order[a]] > scores[order[b]]
+		}
+		return scores[order[a]] < scores[order[b]]
+	})
+
+	ranks := make([]float64, len(scores))
+	for i := 0; i < len(order); {
+		j := i
+		for j < len(order) && scores[order[j]] == scores[order[i]] {
+			j++
+		}
+		for m := i; m < j; m++ {
+			ranks[order[m]] = float64(i+j+1) / 2
+		}
+		i = j
+	}
+
+	return ranks
+}
+
+// cdSummary formats the models by average rank along with the groups
+// of models whose average ranks are within the critical difference.
+func cdSummary(models []string, res FriedmanResult, alpha float64) string {
+
+	order := byRank(res.AvgRanks)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\nNemenyi critical difference = %0.4f (alpha = %0.2f)\n\n", res.CD, alpha)
+	fmt.Fprintf(&b, "%-20s %10s\n", "model", "avg rank")
+	for _, j := range order {
+		fmt.Fprintf(&b, "%-20s %10.4f\n", models[j], res.AvgRanks[j])
+	}
+
+	fmt.Fprintf(&b, "\nNot significantly different:\n")
+	for _, group := range cdGroups(res.AvgRanks, res.CD) {
+		var names []string
+		for _, j := range group {
+			names = append(names, models[j])
+		}
+		fmt.Fprintf(&b, "  [%s]\n", strings.Join(names, ", "))
+	}
+
+	return b.String()
+}
+
+// cdGroups returns the maximal groups of models, in order of average
+// rank, whose average ranks all lie within the critical difference.
+// Models in separate groups are significantly different.
+func cdGroups(avgRanks []float64, cd float64) [][]int {
+
+	order := byRank(avgRanks)
+
+	var groups [][]int
+	lastEnd := -1
+	for i := range order {
+		end := i
+		for end+1 < len(order) && avgRanks[order[end+1]]-avgRanks[order[i]] <= cd {
+			end++
+		}
+
+		// Skip groups contained in the previous one.
+		if end <= lastEnd {
+			continue
+		}
+		groups = append(groups, order[i:end+1])
+		lastEnd = end
+	}
+
+	return groups
+}
+
+// byRank returns the model indices ordered by average rank.
+func byRank(avgRanks []float64) []int {
+	order := make([]int, len(avgRanks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return avgRanks[order[a]] < avgRanks[order[b]]
+	})
+	return order
+}
+
+// cdPlot saves a critical difference diagram, with the models placed
+// by average rank, a bar the length of the critical difference, and
+// a line joining each group of models that are not significantly
+// different.
+func cdPlot(models []string, res FriedmanResult, path string) error {
+
+	p, err := plot.New()
+	if err != nil {
+		return err
+	}
+	p.Title.Text = "Critical difference diagram"
+	p.X.Label.Text = "Average rank"
+	p.X.Min = 1
+	p.X.Max = float64(len(models))
+	p.Y.Min = -1
+	p.Y.Max = float64(len(models)) + 1
+	p.HideY()
+	p.Legend.Top = true
+	p.Add(plotter.NewGrid())
+
+	order := byRank(res.AvgRanks)
+
+	// Place the models one above the other in order of rank.
+	pts := make(plotter.XYs, len(order))
+	var labels []string
+	for i, j := range order {
+		pts[i].X = res.AvgRanks[j]
+		pts[i].Y = float64(len(order) - i)
+		labels = append(labels, fmt.Sprintf("%s (%0.2f)", models[j], res.AvgRanks[j]))
+	}
+
+	s, err := plotter.NewScatter(pts)
+	if err != nil {
+		return err
+	}
+	p.Add(s)
+
+	l, err := plotter.NewLabels(plotter.XYLabels{XYs: pts, Labels: labels})
+	if err != nil {
+		return err
+	}
+	for i := range l.TextStyle {
+		l.TextStyle[i].XAlign = -0.5
+		l.TextStyle[i].YAlign = 0.3
+	}
+	p.Add(l)
+
+	// Draw the critical difference bar.
+	cd, err := plotter.NewLine(plotter.XYs{{X: 1, Y: 0}, {X: 1 + res.CD, Y: 0}})
+	if err != nil {
+		return err
+	}
+	cd.LineStyle.Width = vg.Points(3)
+	p.Add(cd)
+	p.Legend.Add(fmt.Sprintf("CD = %0.2f", res.CD), cd)
+
+	// Join the models of each group.
+	for g, group := range cdGroups(res.AvgRanks, res.CD) {
+		if len(group) < 2 {
+			continue
+		}
+		y := -0.5 - 0.15*float64(g)
+		line, err := plotter.NewLine(plotter.XYs{
+			{X: res.AvgRanks[group[0]], Y: y},
+			{X: res.AvgRanks[group[len(group)-1]], Y: y},
+		})
+		if err != nil {
+			return err
+		}
+		line.LineStyle.Width = vg.Points(2)
+		p.Add(line)
+	}
+
+	return p.Save(6*vg.Inch, 4*vg.Inch, path)
+}
+
+// significance marks p-values below the significance level.
+func significance(p, alpha float64) string {
+	if p < alpha {
+		return " *"
+	}
+	return ""
+}
+
+// readColumns reads a CSV file with a header, returning the
+// column names and the values of each column.
+func readColumns(path string) ([]string, [][]string, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) < 2 {
+		return nil, nil, errors.New("expected a header and at least one row")
+	}
+
+	cols := make([][]string, len(records[0]))
+	for _, record := range records[1:] {
+		for j, v := range record {
+			cols[j] = append(cols[j], strings.TrimSpace(v))
+		}
+	}
+
+	return records[0], cols, nil
+}
+
+// parseColumns parses columns of float values.
+func parseColumns(cols [][]string) ([][]float64, error) {
+
+	out := make([][]float64, len(cols))
+	for j, col := range cols {
+		out[j] = make([]float64, len(col))
+		for i, v := range col {
+			var err error
+			out[j][i], err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+			}
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Dataset is a classification dataset with numeric features.
+type Dataset struct {
+	Name     string
+	Features [][]float64
+	Labels   []string
+}
+
+// Model is a classifier that can be fit to training data and then
+// predict the label of a new observation.
+type Model interface {
+	Fit(features [][]float64, labels []string)
+	Predict(features []float64) string
+}
+
+// models lists the compared models in the column order of the output
+// files, with a constructor for an untrained model of each.
+var models = []struct {
+	Name string
+	New  func() Model
+}{
+	{"knn", func() Model { return &knnModel{k: 2} }},
+	{"decision_tree", func() Model { return &treeModel{minLeaf: 1} }},
+	{"naive_bayes", func() Model { return &naiveBayesModel{} }},
+	{"nearest_centroid", func() Model { return &centroidModel{} }},
+}
+
+// datasets lists the classification datasets used in the book, copied
+// into this directory, with the name of their target column.
+var datasets = []struct {
+	Name   string
+	Path   string
+	Target string
+}{
+	{"iris", "iris.csv", "species"},
+	{"loans", "clean_loan_data.csv", "class"},
+	{"exams", "exams.csv", "admitted"},
+	{"topics", "word_counts.csv", "topic"},
+}
+
+func main() {
+
+	// Declare the cross validation flags.
+	foldsPtr := flag.Int("folds", 5, "The number of cross validation folds")
+	repeatsPtr := flag.Int("repeats", 10, "The number of times the cross validation is repeated for the fold scores")
+	seedPtr := flag.Int64("seed", 42, "The seed used to shuffle the rows into folds")
+
+	// Declare the output flags.
+	scoresPtr := flag.String("scores", "../example1/scores.csv", "The output file for the mean accuracy of each model on each dataset")
+	foldScoresPtr := flag.String("foldScores", "../example1/fold_scores.csv", "The output file for the accuracy of each model in each fold")
+	foldDataPtr := flag.String("foldData", "loans", "The dataset whose fold scores are written")
+	predictionsPtr := flag.String("predictions", "../example1/predictions.csv", "The output file for the out-of-fold predictions of each model")
+	predictionDataPtr := flag.String("predictionData", "iris", "The dataset whose out-of-fold predictions are written")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	rng := rand.New(rand.NewSource(*seedPtr))
+
+	scores := [][]string{{"dataset"}}
+	for _, m := range models {
+		scores[0] = append(scores[0], m.Name)
+	}
+
+	for _, d := range datasets {
+		data, err := readDataset(d.Name, d.Path, d.Target)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Score each model with repeated cross validation. Every model
+		// sees the same folds, so their scores are paired.
+		repeats := 1
+		if d.Name == *foldDataPtr {
+			repeats = *repeatsPtr
+		}
+		foldScores := make([][]float64, len(models))
+		var predictions [][]string
+		for r := 0; r < repeats; r++ {
+			folds := makeFolds(len(data.Labels), *foldsPtr, rng)
+			for j, m := range models {
+				accuracies, predicted := crossValidate(m.New, data, folds)
+				foldScores[j] = append(foldScores[j], accuracies...)
+				if r == 0 {
+					predictions = append(predictions, predicted)
+				}
+			}
+		}
+
+		// Summarize each model by its mean accuracy over the folds of
+		// the first repetition, so every dataset is scored alike.
+		record := []string{d.Name}
+		fmt.Printf("\n%s (%d rows, %d folds x %d repeats)\n", d.Name, len(data.Labels), *foldsPtr, repeats)
+		for j, m := range models {
+			var sum float64
+			for _, a := range foldScores[j][:*foldsPtr] {
+				sum += a
+			}
+			mean := sum / float64(*foldsPtr)
+			record = append(record, strconv.FormatFloat(mean, 'f', 4, 64))
+			fmt.Printf("  %-18s accuracy = %0.4f\n", m.Name, mean)
+		}
+		scores = append(scores, record)
+
+		if d.Name == *foldDataPtr {
+			out := [][]string{scores[0][1:]}
+			for f := range foldScores[0] {
+				var row []string
+				for j := range models {
+					row = append(row, strconv.FormatFloat(foldScores[j][f], 'f', 4, 64))
+				}
+				out = append(out, row)
+			}
+			if err := writeCSV(*foldScoresPtr, out); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if d.Name == *predictionDataPtr {
+			out := [][]string{append([]string{"observed"}, scores[0][1:]...)}
+			for i, label := range data.Labels {
+				row := []string{label}
+				for j := range models {
+					row = append(row, predictions[j][i])
+				}
+				out = append(out, row)
+			}
+			if err := writeCSV(*predictionsPtr, out); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	if err := writeCSV(*scoresPtr, scores); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println()
+}
+
+// makeFolds shuffles the row indices and deals them into k folds.
+func makeFolds(n, k int, rng *rand.Rand) [][]int {
+	folds := make([][]int, k)
+	for i, idx := range rng.Perm(n) {
+		folds[i%k] = append(folds[i%k], idx)
+	}
+	return folds
+}
+
+// crossValidate fits a new model on all but one fold and scores it on
+// that fold, for each fold. It returns the accuracy in each fold and
+// the out-of-fold prediction for each row.
+func crossValidate(newModel func() Model, data *Dataset, folds [][]int) ([]float64, []string) {
+
+	accuracies := make([]float64, len(folds))
+	predictions := make([]string, len(data.Labels))
+	for f, test := range folds {
+		var trainX [][]float64
+		var trainY []string
+		for g, fold := range folds {
+			if g == f {
+				continue
+			}
+			for _, i := range fold {
+				trainX = append(trainX, data.Features[i])
+				trainY = append(trainY, data.Labels[i])
+			}
+		}
+
+		model := newModel()
+		model.Fit(trainX, trainY)
+
+		var correct float64
+		for _, i := range test {
+			predictions[i] = model.Predict(data.Features[i])
+			if predictions[i] == data.Labels[i] {
+				correct++
+			}
+		}
+		accuracies[f] = correct / float64(len(test))
+	}
+
+	return accuracies, predictions
+}
+
+// knnModel is a k-nearest neighbors classifier with Euclidean
+// distances, like the one in Chapter 5. Ties in the vote go to the
+// tied label of the nearest neighbor.
+type knnModel struct {
+	k        int
+	features [][]float64
+	labels   []string
+}
+
+// Fit stores the training data.
+func (m *knnModel) Fit(features [][]float64, labels []string) {
+	m.features = features
+	m.labels = labels
+}
+
+// Predict returns the most common label of the k nearest rows.
+func (m *knnModel) Predict(features []float64) string {
+
+	dists := make([]float64, len(m.features))
+	order := make([]int, len(m.features))
+	for i, row := range m.features {
+		dists[i] = distance(row, features)
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return dists[order[a]] < dists[order[b]] })
+
+	votes := make(map[string]int)
+	var most int
+	for _, i := range order[:m.k] {
+		votes[m.labels[i]]++
+		if votes[m.labels[i]] > most {
+			most = votes[m.labels[i]]
+		}
+	}
+	for _, i := range order[:m.k] {
+		if votes[m.labels[i]] == most {
+			return m.labels[i]
+		}
+	}
+
+	return ""
+}
+
+// treeModel is a classification tree grown by choosing the split that
+// most reduces the Gini impurity, until the leaves are pure or have
+// fewer than 2*minLeaf rows.
+type treeModel struct {
+	minLeaf int
+	root    *treeNode
+}
+
+// treeNode is a node of a tree. Leaves have no children.
+type treeNode struct {
+	feature     int
+	threshold   float64
+	left, right *treeNode
+	label       string
+}
+
+// Fit grows the tree on all of the rows.
+func (m *treeModel) Fit(features [][]float64, labels []string) {
+	idx := make([]int, len(labels))
+	for i := range idx {
+		idx[i] = i
+	}
+	m.root = m.grow(features, labels, idx)
+}
+
+// grow builds the subtree for the rows idx.
+func (m *treeModel) grow(features [][]float64, labels []string, idx []int) *treeNode {
+
+	node := &treeNode{label: majority(labels, idx)}
+	impurity := gini(labels, idx)
+	if len(idx) < 2*m.minLeaf || impurity == 0 {
+		return node
+	}
+
+	bestScore, bestFeature, bestThreshold := impurity*float64(len(idx)), -1, 0.0
+	sorted := append([]int(nil), idx...)
+	for j := range features[0] {
+		sort.SliceStable(sorted, func(a, b int) bool { return features[sorted[a]][j] < features[sorted[b]][j] })
+
+		// Score each split between distinct values, keeping at
+		// least minLeaf rows on either side.
+		for i := m.minLeaf; i <= len(sorted)-m.minLeaf; i++ {
+			lo, hi := features[sorted[i-1]][j], features[sorted[i]][j]
+			if lo == hi {
+				continue
+			}
+			score := gini(labels, sorted[:i])*float64(i) + gini(labels, sorted[i:])*float64(len(sorted)-i)
+			if score < bestScore-1e-12 {
+				bestScore, bestFeature, bestThreshold = score, j, (lo+hi)/2
+			}
+		}
+	}
+	if bestFeature < 0 {
+		return node
+	}
+
+	var left, right []int
+	for _, i := range idx {
+		if features[i][bestFeature] <= bestThreshold {
+			left = append(left, i)
+		} else {
+			right = append(right, i)
+		}
+	}
+
+	node.feature, node.threshold = bestFeature, bestThreshold
+	node.left = m.grow(features, labels, left)
+	node.right = m.grow(features, labels, right)
+
+	return node
+}
+
+// Predict follows the splits from the root to a leaf.
+func (m *treeModel) Predict(features []float64) string {
+	node := m.root
+	for node.left != nil {
+		if features[node.feature] <= node.threshold {
+			node = node.left
+		} else {
+			node = node.right
+		}
+	}
+	return node.label
+}
+
+// gini returns the Gini impurity of the labels of the rows idx.
+func gini(labels []string, idx []int) float64 {
+	counts := make(map[string]float64)
+	for _, i := range idx {
+		counts[labels[i]]++
+	}
+	impurity := 1.0
+	for _, c := range counts {
+		impurity -= (c / float64(len(idx))) * (c / float64(len(idx)))
+	}
+	return impurity
+}
+
+// majority returns the most common label of the rows idx, preferring
+// the first in sorted order in a tie.
+func majority(labels []string, idx []int) string {
+	counts := make(map[string]int)
+	for _, i := range idx {
+		counts[labels[i]]++
+	}
+	var best string
+	for label, c := range counts {
+		if c > counts[best] || (c == counts[best] && label < best) {
+			best = label
+		}
+	}
+	return best
+}
+
+// naiveBayesModel is a Gaussian naive Bayes classifier. A small
+// fraction of the largest feature variance is added to every variance,
+// so constant features do not divide by zero.
+type naiveBayesModel struct {
+	classes   []string
+	logPriors []float64
+	means     [][]float64
+	variances [][]float64
+}
+
+// Fit estimates the class priors and the per-class feature means
+// and variances.
+func (m *naiveBayesModel) Fit(features [][]float64, labels []string) {
+
+	byClass := groupByClass(features, labels)
+	m.classes = sortedKeys(byClass)
+
+	var maxVar float64
+	m.logPriors = make([]float64, len(m.classes))
+	m.means = make([][]float64, len(m.classes))
+	m.variances = make([][]float64, len(m.classes))
+	for c, class := range m.classes {
+		rows := byClass[class]
+		m.logPriors[c] = math.Log(float64(len(rows)) / float64(len(labels)))
+		m.means[c] = mean(rows)
+		m.variances[c] = make([]float64, len(rows[0]))
+		for _, row := range rows {
+			for j, v := range row {
+				m.variances[c][j] += (v - m.means[c][j]) * (v - m.means[c][j]) / float64(len(rows))
+			}
+		}
+		for _, v := range m.variances[c] {
+			maxVar = math.Max(maxVar, v)
+		}
+	}
+
+	for c := range m.variances {
+		for j := range m.variances[c] {
+			m.variances[c][j] += 1e-9 * maxVar
+		}
+	}
+}
+
+// Predict returns the class with the largest log posterior.
+func (m *naiveBayesModel) Predict(features []float64) string {
+	best, bestScore := "", math.Inf(-1)
+	for c, class := range m.classes {
+		score := m.logPriors[c]
+		for j, v := range features {
+			d := v - m.means[c][j]
+			score -= 0.5*math.Log(2*math.Pi*m.variances[c][j]) + d*d/(2*m.variances[c][j])
+		}
+		if score > bestScore {
+			best, bestScore = class, score
+		}
+	}
+	return best
+}
+
+// centroidModel is a nearest centroid classifier, which predicts the
+// class whose mean feature vector is closest in Euclidean distance.
+type centroidModel struct {
+	classes   []string
+	centroids [][]float64
+}
+
+// Fit computes the centroid of each class.
+func (m *centroidModel) Fit(features [][]float64, labels []string) {
+	byClass := groupByClass(features, labels)
+	m.classes = sortedKeys(byClass)
+	m.centroids = make([][]float64, len(m.classes))
+	for c, class := range m.classes {
+		m.centroids[c] = mean(byClass[class])
+	}
+}
+
+// Predict returns the class of the nearest centroid.
+func (m *centroidModel) Predict(features []float64) string {
+	best, bestDist := "", math.Inf(1)
+	for c, centroid := range m.centroids {
+		if d := distance(centroid, features); d < bestDist {
+			best, bestDist = m.classes[c], d
+		}
+	}
+	return best
+}
+
+// distance returns the Euclidean distance between two rows.
+func distance(a, b []float64) float64 {
+	var sum float64
+	for j := range a {
+		sum += (a[j] - b[j]) * (a[j] - b[j])
+	}
+	return math.Sqrt(sum)
+}
+
+// groupByClass collects the rows of each class.
+func groupByClass(features [][]float64, labels []string) map[string][][]float64 {
+	byClass := make(map[string][][]float64)
+	for i, row := range features {
+		byClass[labels[i]] = append(byClass[labels[i]], row)
+	}
+	return byClass
+}
+
+// sortedKeys returns the classes in sorted order.
+func sortedKeys(byClass map[string][][]float64) []string {
+	var keys []string
+	for k := range byClass {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// mean returns the mean of each column of the rows.
+func mean(rows [][]float64) []float64 {
+	out := make([]float64, len(rows[0]))
+	for _, row := range rows {
+		for j, v := range row {
+			out[j] += v / float64(len(rows))
+		}
+	}
+	return out
+}
+
+// readDataset reads a CSV file with a header, using the target column
+// as the labels and every other column as a numeric feature. Numeric
+// labels such as 1.0 and 1 are written the same way.
+func readDataset(name, path, target string) (*Dataset, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, errors.New("expected a header and at least one row")
+	}
+
+	targetPos := -1
+	for p, h := range records[0] {
+		if h == target {
+			targetPos = p
+		}
+	}
+	if targetPos < 0 {
+		return nil, fmt.Errorf("target column %s not found in %s", target, path)
+	}
+
+	data := &Dataset{Name: name}
+	for i, record := range records[1:] {
+		label := record[targetPos]
+		if v, err := strconv.ParseFloat(label, 64); err == nil {
+			label = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+
+		var row []float64
+		for p, value := range record {
+			if p == targetPos {
+				continue
+			}
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parsing line %d of %s failed: %v", i+2, path, err)
+			}
+			row = append(row, v)
+		}
+
+		data.Features = append(data.Features, row)
+		data.Labels = append(data.Labels, label)
+	}
+
+	return data, nil
+}
+
+// writeCSV writes the records to a CSV file.
+func writeCSV(path string, records [][]string) error {
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(records); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,585 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/sajari/regression"
+	"gonum.org/v1/gonum/stat"
+)
+
+// Model is a model that can be fit to training data and then
+// make a prediction for a new observation.
+type Model interface {
+	Fit(features [][]float64, labels []float64) error
+	Predict(features []float64) (float64, error)
+}
+
+// Fold includes the training and test row indices of one fold.
+type Fold struct {
+	Train []int
+	Test  []int
+}
+
+// Metric scores the predictions of a model against the observed values.
+type Metric struct {
+	Name string
+	Fn   func(observed, predicted []float64) float64
+}
+
+// Score includes the value of a metric on each fold along with
+// its mean and standard deviation over the folds.
+type Score struct {
+	Name   string
+	Folds  []float64
+	Mean   float64
+	StdDev float64
+}
+
+func main() {
+
+	// Declare the cross validation flags.
+	foldsPtr := flag.Int("folds", 5, "The number of folds")
+	seedPtr := flag.Int64("seed", 42, "The seed for shuffling the folds")
+	workersPtr := flag.Int("workers", runtime.NumCPU(), "The number of folds evaluated in parallel")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	k := *foldsPtr
+	seed := *seedPtr
+	workers := *workersPtr
+
+	regressionMetrics := []Metric{{"MAE", mae}, {"RMSE", rmse}, {"R^2", rSquared}}
+	errorMetrics := []Metric{{"MAE", mae}, {"RMSE", rmse}}
+
+	// Read in the diabetes data, modeling the disease progression
+	// from the bmi and ltg features.
+	cols, err := readColumns("diabetes.csv", "bmi", "ltg", "y", "age")
+	if err != nil {
+		log.Fatal(err)
+	}
+	diabetesX := rows(cols[0], cols[1])
+	diabetesY := cols[2]
+
+	newRegression := func() Model { return &linearModel{} }
+
+	// Run k-fold cross validation on the regression.
+	folds, err := KFold(len(diabetesY), k, seed)
+	if err != nil {
+		log.Fatal(err)
+	}
+	report(fmt.Sprintf("Linear regression, %d-fold", k), newRegression, diabetesX, diabetesY, folds, regressionMetrics, workers)
+
+	// Run leave-one-out cross validation on the regression. Each test
+	// fold is a single observation, so only the MAE is meaningful.
+	report("Linear regression, leave-one-out", newRegression, diabetesX, diabetesY, LeaveOneOut(len(diabetesY)), []Metric{{"MAE", mae}}, workers)
+
+	// Run group k-fold cross validation on the regression, holding
+	// out whole age cohorts so that the model is always evaluated on
+	// ages it has not seen.
+	folds, err = GroupKFold(labelsOf(cols[3]), k)
+	if err != nil {
+		log.Fatal(err)
+	}
+	report(fmt.Sprintf("Linear regression, %d-fold grouped by age", k), newRegression, diabetesX, diabetesY, folds, regressionMetrics, workers)
+
+	// Read in the loan data and run stratified k-fold cross
+	// validation on a logistic regression of the loan class.
+	cols, err = readColumns("clean_loan_data.csv", "FICO_score", "class")
+	if err != nil {
+		log.Fatal(err)
+	}
+	loanX := rows(cols[0])
+	loanY := cols[1]
+
+	folds, err = StratifiedKFold(labelsOf(loanY), k, seed)
+	if err != nil {
+		log.Fatal(err)
+	}
+	newLogistic := func() Model { return &logisticModel{steps: 100, learningRate: 0.3, seed: seed} }
+	report(fmt.Sprintf("Logistic regression, stratified %d-fold", k), newLogistic, loanX, loanY, folds, []Metric{{"Accuracy", accuracy}}, workers)
+
+	// Read in the log differenced passenger series and run expanding
+	// window cross validation on an AR(2) model, so that each fold
+	// only forecasts observations after its training window.
+	cols, err = readColumns("log_diff_series.csv", "log_differenced_passengers")
+	if err != nil {
+		log.Fatal(err)
+	}
+	arX, arY := lagged(cols[0], 2)
+
+	folds, err = TimeSeriesSplit(len(arY), k)
+	if err != nil {
+		log.Fatal(err)
+	}
+	report(fmt.Sprintf("AR(2), %d expanding windows", k), newRegression, arX, arY, folds, errorMetrics, workers)
+}
+
+// report cross validates a model and outputs the scores to standard out.
+func report(title string, newModel func() Model, features [][]float64, labels []float64, folds []Fold, metrics []Metric, workers int) {
+
+	scores, err := CrossValidate(newModel, features, labels, folds, metrics, workers)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("\n%s (%d folds)\n", title, len(folds))
+	for _, s := range scores {
+		fmt.Printf("  %-8s %10.4f (+/- %0.4f)\n", s.Name, s.Mean, s.StdDev)
+	}
+}
+
+// CrossValidate fits a new model on the training rows of each fold and
+// scores its predictions for the test rows with each of the metrics.
+// The folds are evaluated in parallel using the given number of
+// goroutines.
+func CrossValidate(newModel func() Model, features [][]float64, labels []float64, folds []Fold, metrics []Metric, workers int) ([]Score, error) {
+
+	if len(features) != len(labels) {
+		return nil, errors.New("there must be one label per row of features")
+	}
+	if len(folds) == 0 {
+		return nil, errors.New("at least one fold is required")
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	values := make([][]float64, len(folds))
+	errs := make([]error, len(folds))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				values[f], errs[f] = evaluateFold(newModel(), features, labels, folds[f], metrics)
+			}
+		}()
+	}
+
+	for f := range folds {
+		jobs <- f
+	}
+	close(jobs)
+	wg.Wait()
+
+	for f, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("fold %d: %v", f+1, err)
+		}
+	}
+
+	// Aggregate each metric over the folds.
+	scores := make([]Score, len(metrics))
+	for m, metric := range metrics {
+		s := Score{Name: metric.Name, Folds: make([]float64, len(folds))}
+		for f := range folds {
+			s.Folds[f] = values[f][m]
+		}
+		s.Mean = stat.Mean(s.Folds, nil)
+		if len(folds) > 1 {
+			s.StdDev = stat.StdDev(s.Folds, nil)
+		}
+		scores[m] = s
+	}
+
+	return scores, nil
+}
+
+// evaluateFold fits the model on the training rows of the fold and
+// returns the value of each metric on the test rows.
+func evaluateFold(model Model, features [][]float64, labels []float64, fold Fold, metrics []Metric) ([]float64, error) {
+
+	trainX := make([][]float64, len(fold.Train))
+	trainY := make([]float64, len(fold.Train))
+	for i, idx := range fold.Train {
+		trainX[i] = features[idx]
+		trainY[i] = labels[idx]
+	}
+
+	if err := model.Fit(trainX, trainY); err != nil {
+		return nil, err
+	}
+
+	observed := make([]float64, len(fold.Test))
+	predicted := make([]float64, len(fold.Test))
+	for i, idx := range fold.Test {
+		p, err := model.Predict(features[idx])
+		if err != nil {
+			return nil, err
+		}
+		observed[i] = labels[idx]
+		predicted[i] = p
+	}
+
+	values := make([]float64, len(metrics))
+	for m, metric := range metrics {
+		values[m] = metric.Fn(observed, predicted)
+	}
+
+	return values, nil
+}
+
+// KFold shuffles n rows and divides them into k folds of nearly
+// equal size.
+func KFold(n, k int, seed int64) ([]Fold, error) {
+
+	if k < 2 || k > n {
+		return nil, fmt.Errorf("cannot make %d folds from %d rows", k, n)
+	}
+
+	perm := rand.New(rand.NewSource(seed)).Perm(n)
+	assignment := make([]int, n)
+	for i, idx := range perm {
+		assignment[idx] = i % k
+	}
+
+	return foldsFromAssignment(assignment, k), nil
+}
+
+// StratifiedKFold divides the rows into k folds so that each fold
+// has nearly the same proportion of each label.
+func StratifiedKFold(labels []string, k int, seed int64) ([]Fold, error) {
+
+	if k < 2 || k > len(labels) {
+		return nil, fmt.Errorf("cannot make %d folds from %d rows", k, len(labels))
+	}
+
+	byLabel := make(map[string][]int)
+	for i, l := range labels {
+		byLabel[l] = append(byLabel[l], i)
+	}
+	var keys []string
+	for l := range byLabel {
+		keys = append(keys, l)
+	}
+	sort.Strings(keys)
+
+	// Deal the shuffled rows of each label out to the folds in turn,
+	// carrying on from the previous label so that the fold sizes
+	// stay balanced.
+	rng := rand.New(rand.NewSource(seed))
+	assignment := make([]int, len(labels))
+	var next int
+	for _, l := range keys {
+		idx := byLabel[l]
+		rng.Shuffle(len(idx), func(i, j int) { idx[i], idx[j] = idx[j], idx[i] })
+		for _, i := range idx {
+			assignment[i] = next % k
+			next++
+		}
+	}
+
+	return foldsFromAssignment(assignment, k), nil
+}
+
+// LeaveOneOut makes one fold for each of the n rows, testing on that
+// row alone.
+func LeaveOneOut(n int) []Fold {
+
+	assignment := make([]int, n)
+	for i := range assignment {
+		assignment[i] = i
+	}
+
+	return foldsFromAssignment(assignment, n)
+}
+
+// GroupKFold divides the rows into k folds so that all of the rows of
+// a group are in the same fold. The largest groups are assigned first,
+// each to the fold with the fewest rows so far.
+func GroupKFold(groups []string, k int) ([]Fold, error) {
+
+	byGroup := make(map[string][]int)
+	for i, g := range groups {
+		byGroup[g] = append(byGroup[g], i)
+	}
+	if k < 2 || k > len(byGroup) {
+		return nil, fmt.Errorf("cannot make %d folds from %d groups", k, len(byGroup))
+	}
+
+	var keys []string
+	for g := range byGroup {
+		keys = append(keys, g)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if len(byGroup[keys[a]]) != len(byGroup[keys[b]]) {
+			return len(byGroup[keys[a]]) > len(byGroup[keys[b]])
+		}
+		return keys[a] < keys[b]
+	})
+
+	assignment := make([]int, len(groups))
+	sizes := make([]int, k)
+	for _, g := range keys {
+		smallest := 0
+		for f := range sizes {
+			if sizes[f] < sizes[smallest] {
+				smallest = f
+			}
+		}
+		for _, i := range byGroup[g] {
+			assignment[i] = smallest
+		}
+		sizes[smallest] += len(byGroup[g])
+	}
+
+	return foldsFromAssignment(assignment, k), nil
+}
+
+// TimeSeriesSplit makes k folds over n ordered rows. Each fold tests
+// on the next block of rows after an expanding training window, so a
+// model is never trained on observations after the ones it predicts.
+func TimeSeriesSplit(n, k int) ([]Fold, error) {
+
+	testSize := n / (k + 1)
+	if k < 1 || testSize < 1 {
+		return nil, fmt.Errorf("cannot make %d time series folds from %d rows", k, n)
+	}
+
+	folds := make([]Fold, k)
+	for f := range folds {
+		end := n - (k-f-1)*testSize
+		start := end - testSize
+		folds[f] = Fold{Train: indices(0, start), Test: indices(start, end)}
+	}
+
+	return folds, nil
+}
+
+// foldsFromAssignment makes the folds from the fold number of each row,
+// with each fold training on the rows of all of the others.
+func foldsFromAssignment(assignment []int, k int) []Fold {
+
+	folds := make([]Fold, k)
+	for i, f := range assignment {
+		for g := range folds {
+			if g == f {
+				folds[g].Test = append(folds[g].Test, i)
+			} else {
+				folds[g].Train = append(folds[g].Train, i)
+			}
+		}
+	}
+
+	return folds
+}
+
+// indices returns the row indices in [start, end).
+func indices(start, end int) []int {
+	idx := make([]int, end-start)
+	for i := range idx {
+		idx[i] = start + i
+	}
+	return idx
+}
+
+// linearModel is a linear regression trained with github.com/sajari/regression.
+type linearModel struct {
+	r *regression.Regression
+}
+
+// Fit trains the linear regression.
+func (m *linearModel) Fit(features [][]float64, labels []float64) error {
+
+	m.r = new(regression.Regression)
+	m.r.SetObserved("y")
+	for j := range features[0] {
+		m.r.SetVar(j, "x"+strconv.Itoa(j))
+	}
+
+	for i, row := range features {
+		m.r.Train(regression.DataPoint(labels[i], row))
+	}
+
+	return m.r.Run()
+}
+
+// Predict makes a prediction with the trained linear regression.
+func (m *linearModel) Predict(features []float64) (float64, error) {
+	return m.r.Predict(features)
+}
+
+// logisticModel is a binary logistic regression trained with
+// stochastic gradient descent.
+type logisticModel struct {
+	steps        int
+	learningRate float64
+	seed         int64
+	weights      []float64
+}
+
+// Fit trains the logistic regression, with the last weight
+// being the intercept.
+func (m *logisticModel) Fit(features [][]float64, labels []float64) error {
+
+	// Initialize random weights.
+	r := rand.New(rand.NewSource(m.seed))
+	m.weights = make([]float64, len(features[0])+1)
+	for j := range m.weights {
+		m.weights[j] = r.Float64()
+	}
+
+	// Iteratively optimize the weights.
+	for i := 0; i < m.steps; i++ {
+		for idx, label := range labels {
+			pred := m.probability(features[idx])
+			grad := m.learningRate * (label - pred) * pred * (1 - pred)
+			for j, x := range features[idx] {
+				m.weights[j] += grad * x
+			}
+			m.weights[len(m.weights)-1] += grad
+		}
+	}
+
+	return nil
+}
+
+// Predict predicts the class, 0 or 1, of an observation.
+func (m *logisticModel) Predict(features []float64) (float64, error) {
+	if m.probability(features) >= 0.5 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// probability calculates the probability of the positive class.
+func (m *logisticModel) probability(features []float64) float64 {
+	z := m.weights[len(m.weights)-1]
+	for j, x := range features {
+		z += m.weights[j] * x
+	}
+	return 1 / (1 + math.Exp(-z))
+}
+
+// mae calculates the mean absolute error.
+func mae(observed, predicted []float64) float64 {
+	var sum float64
+	for i, o := range observed {
+		sum += math.Abs(o - predicted[i])
+	}
+	return sum / float64(len(observed))
+}
+
+// rmse calculates the root mean squared error.
+func rmse(observed, predicted []float64) float64 {
+	var sum float64
+	for i, o := range observed {
+		sum += (o - predicted[i]) * (o - predicted[i])
+	}
+	return math.Sqrt(sum / float64(len(observed)))
+}
+
+// rSquared calculates the coefficient of determination.
+func rSquared(observed, predicted []float64) float64 {
+	return stat.RSquaredFrom(predicted, observed, nil)
+}
+
+// accuracy calculates the fraction of correct predictions.
+func accuracy(observed, predicted []float64) float64 {
+	var correct int
+	for i, o := range observed {
+		if o == predicted[i] {
+			correct++
+		}
+	}
+	return float64(correct) / float64(len(observed))
+}
+
+// lagged builds the features and labels of an autoregressive model
+// of the given order, where each row holds the previous values.
+func lagged(x []float64, lag int) ([][]float64, []float64) {
+
+	var features [][]float64
+	var labels []float64
+	for t := lag; t < len(x); t++ {
+		row := make([]float64, lag)
+		for l := 1; l <= lag; l++ {
+			row[l-1] = x[t-l]
+		}
+		features = append(features, row)
+		labels = append(labels, x[t])
+	}
+
+	return features, labels
+}
+
+// rows combines columns into rows of features.
+func rows(cols ...[]float64) [][]float64 {
+	out := make([][]float64, len(cols[0]))
+	for i := range out {
+		out[i] = make([]float64, len(cols))
+		for j, col := range cols {
+			out[i][j] = col[i]
+		}
+	}
+	return out
+}
+
+// labelsOf formats values as labels for stratifying or grouping.
+func labelsOf(values []float64) []string {
+	labels := make([]string, len(values))
+	for i, v := range values {
+		labels[i] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return labels
+}
+
+// readColumns reads the named float columns from a CSV file with a header.
+func readColumns(path string, names ...string) ([][]float64, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, errors.New("expected a header and at least one row")
+	}
+
+	// Find the position of each of the named columns.
+	positions := make([]int, len(names))
+	for j, name := range names {
+		positions[j] = -1
+		for p, h := range records[0] {
+			if h == name {
+				positions[j] = p
+			}
+		}
+		if positions[j] < 0 {
+			return nil, fmt.Errorf("column %s not found", name)
+		}
+	}
+
+	cols := make([][]float64, len(names))
+	for i, record := range records[1:] {
+		for j, p := range positions {
+			val, err := strconv.ParseFloat(record[p], 64)
+			if err != nil {
+				return nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+			}
+			cols[j] = append(cols[j], val)
+		}
+	}
+
+	return cols, nil
+}
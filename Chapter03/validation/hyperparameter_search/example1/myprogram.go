@@ -0,0 +1,1581 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+	"gopkg.in/yaml.v2"
+)
+
+// Model is a model that can be fit to training data and then
+// make a prediction for a new observation.
+type Model interface {
+	Fit(features [][]float64, labels []float64) error
+	Predict(features []float64) (float64, error)
+}
+
+// Params holds the hyperparameter values of a candidate model.
+type Params map[string]interface{}
+
+// ParamSpec describes the values a hyperparameter can take. Values
+// lists them explicitly, Step gives a range from Min to Max, and
+// Distribution ("uniform" or "loguniform") gives a continuous range
+// from Min to Max, with Num points used by a grid search.
+type ParamSpec struct {
+	Values       []interface{} `json:"values,omitempty"`
+	Min          float64       `json:"min,omitempty"`
+	Max          float64       `json:"max,omitempty"`
+	Step         float64       `json:"step,omitempty"`
+	Distribution string        `json:"distribution,omitempty"`
+	Num          int           `json:"num,omitempty"`
+}
+
+// SearchSpec includes the data, model, parameter space and strategy
+// of a hyperparameter search. It is read from JSON, or from YAML with
+// the same field names. MinRows is the fewest rows a halving round may
+// use, which is raised if needed so that every candidate can be fit.
+type SearchSpec struct {
+	Data       string               `json:"data"`
+	Target     string               `json:"target"`
+	Features   []string             `json:"features,omitempty"`
+	Model      string               `json:"model"`
+	Strategy   string               `json:"strategy"`
+	Candidates int                  `json:"candidates,omitempty"`
+	Halving    bool                 `json:"halving,omitempty"`
+	Factor     int                  `json:"factor,omitempty"`
+	MinRows    int                  `json:"min_rows,omitempty"`
+	Folds      int                  `json:"folds"`
+	Metric     string               `json:"metric"`
+	Seed       int64                `json:"seed"`
+	Params     map[string]ParamSpec `json:"params"`
+}
+
+// Result includes the cross validated score of a candidate in one
+// round of the search. Candidates that cannot be fit, such as a k
+// larger than the rows of a small halving round, have the worst
+// possible score and the error that stopped them.
+type Result struct {
+	Round  int
+	Rows   int
+	Params Params
+	Mean   float64
+	StdDev float64
+	Err    error
+}
+
+// BestModel includes the best candidate refitted on all of the data.
+type BestModel struct {
+	Model   string      `json:"model"`
+	Params  Params      `json:"params"`
+	Metric  string      `json:"metric"`
+	Mean    float64     `json:"cv_mean"`
+	StdDev  float64     `json:"cv_std"`
+	Classes []string    `json:"classes,omitempty"`
+	Fitted  interface{} `json:"fitted"`
+}
+
+// ModelInfo includes the information about a fitted
+// linear model, in the format used by our predictor.
+type ModelInfo struct {
+	Intercept    float64           `json:"intercept"`
+	Coefficients []CoefficientInfo `json:"coefficients"`
+}
+
+// CoefficientInfo include information about a
+// particular model coefficient.
+type CoefficientInfo struct {
+	Name        string  `json:"name"`
+	Coefficient float64 `json:"coefficient"`
+}
+
+// KNNInfo includes the training data and settings of a fitted
+// k-nearest neighbors model, which votes on the label when Classify
+// is set and otherwise averages the labels.
+type KNNInfo struct {
+	K        int         `json:"k"`
+	Weights  string      `json:"weights"`
+	Distance string      `json:"distance"`
+	Classify bool        `json:"classify"`
+	Features []string    `json:"features"`
+	Rows     [][]float64 `json:"rows"`
+	Labels   []float64   `json:"labels"`
+}
+
+// ForestInfo includes the trees of a fitted random forest, which vote
+// on the label when Classify is set and are otherwise averaged.
+type ForestInfo struct {
+	Classify bool        `json:"classify"`
+	Trees    []*TreeInfo `json:"trees"`
+}
+
+// TreeInfo is a node of a fitted tree. Rows go left when their value of
+// Feature is at most Threshold, and leaves predict Value.
+type TreeInfo struct {
+	Feature   string    `json:"feature,omitempty"`
+	Threshold float64   `json:"threshold,omitempty"`
+	Left      *TreeInfo `json:"left,omitempty"`
+	Right     *TreeInfo `json:"right,omitempty"`
+	Value     float64   `json:"value"`
+}
+
+// NeuralNetInfo includes the weights of a fitted neural network with
+// one hidden layer. The features are standardized with Means and
+// Scales, and output j gives the score of Classes[j].
+type NeuralNetInfo struct {
+	Features      []string    `json:"features"`
+	Means         []float64   `json:"means"`
+	Scales        []float64   `json:"scales"`
+	HiddenWeights [][]float64 `json:"hidden_weights"`
+	HiddenBias    []float64   `json:"hidden_bias"`
+	OutputWeights [][]float64 `json:"output_weights"`
+	OutputBias    []float64   `json:"output_bias"`
+	Classes       []float64   `json:"classes"`
+}
+
+func main() {
+
+	// Declare the search flags.
+	specPtr := flag.String("spec", "ridge_search.json", "The JSON or YAML (.yaml, .yml) search specification")
+	workersPtr := flag.Int("workers", runtime.NumCPU(), "The number of candidates evaluated concurrently")
+	resultsPtr := flag.String("results", "results.csv", "The output file for the results table")
+	outPtr := flag.String("out", "best_model.json", "The output file for the refitted best model")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Read in the search specification.
+	data, err := ioutil.ReadFile(*specPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	spec, err := parseSpec(*specPtr, data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Read in the dataset.
+	names, features, labels, classes, err := readDataset(spec.Data, spec.Target, spec.Features)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Run the search.
+	results, best, err := Search(spec, features, labels, *workersPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := writeResults(*resultsPtr, spec, results); err != nil {
+		log.Fatal(err)
+	}
+
+	// Output the best candidates to standard out.
+	fmt.Printf("\n%s search over %s, %d candidate evaluations\n\n", spec.Strategy, spec.Model, len(results))
+	final := results[len(results)-1].Round
+	var failed int
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+		if r.Round == final && r.Err == nil {
+			fmt.Printf("  %-40s %s = %0.4f (+/- %0.4f), %d rows\n", formatParams(r.Params), spec.Metric, r.Mean, r.StdDev, r.Rows)
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("\n%d candidate evaluations could not be fit and were scored as the worst\n", failed)
+	}
+	fmt.Printf("\nBest: %s\n\n", formatParams(best.Params))
+
+	// Refit the best candidate on all of the data and save it.
+	model, err := newModel(spec.Model, best.Params)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := model.Fit(features, labels); err != nil {
+		log.Fatal(err)
+	}
+
+	out := BestModel{
+		Model:   spec.Model,
+		Params:  best.Params,
+		Metric:  spec.Metric,
+		Mean:    best.Mean,
+		StdDev:  best.StdDev,
+		Classes: classes,
+		Fitted:  fittedInfo(model, names),
+	}
+
+	outputData, err := json.MarshalIndent(out, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(*outPtr, outputData, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseSpec decodes a search specification, as YAML when the file has
+// a .yaml or .yml extension and as JSON otherwise. YAML is converted
+// to JSON first, so both formats share the field names and number
+// handling of the JSON tags.
+func parseSpec(path string, data []byte) (SearchSpec, error) {
+
+	var spec SearchSpec
+
+	ext := strings.ToLower(path[strings.LastIndex(path, ".")+1:])
+	if ext == "yaml" || ext == "yml" {
+		var raw interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return spec, err
+		}
+		converted, err := json.Marshal(jsonValue(raw))
+		if err != nil {
+			return spec, err
+		}
+		data = converted
+	}
+
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return spec, err
+	}
+
+	return spec, nil
+}
+
+// jsonValue converts the maps decoded from YAML, which have
+// interface{} keys, into maps that can be encoded as JSON.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{})
+		for key, value := range v {
+			out[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return out
+	case []interface{}:
+		for i, value := range v {
+			v[i] = jsonValue(value)
+		}
+	}
+	return v
+}
+
+// Search generates the candidates of the spec and scores them with
+// cross validation, evaluating up to workers candidates at once. With
+// halving, each round scores the remaining candidates on a larger
+// subsample of the rows and keeps the best 1/Factor of them for the
+// next round, until the last round uses all of the rows. The results
+// are ordered by round and then from best to worst.
+func Search(spec SearchSpec, features [][]float64, labels []float64, workers int) ([]Result, Result, error) {
+
+	metric, higherIsBetter, err := metricByName(spec.Metric)
+	if err != nil {
+		return nil, Result{}, err
+	}
+	if spec.Folds < 2 {
+		return nil, Result{}, errors.New("at least two folds are required")
+	}
+
+	rng := rand.New(rand.NewSource(spec.Seed))
+
+	var candidates []Params
+	switch spec.Strategy {
+	case "grid":
+		candidates, err = gridCandidates(spec.Params)
+	case "random":
+		candidates, err = randomCandidates(spec.Params, spec.Candidates, rng)
+	default:
+		err = fmt.Errorf("unknown search strategy %s", spec.Strategy)
+	}
+	if err != nil {
+		return nil, Result{}, err
+	}
+
+	// Make sure every candidate can build a model before searching.
+	for _, c := range candidates {
+		if _, err := newModel(spec.Model, c); err != nil {
+			return nil, Result{}, err
+		}
+	}
+
+	// Work out the number of rows used in each round.
+	n := len(labels)
+	minRows, err := roundMinimum(spec, candidates)
+	if err != nil {
+		return nil, Result{}, err
+	}
+	rounds := []int{n}
+	factor := spec.Factor
+	if spec.Halving {
+		if factor < 2 {
+			factor = 3
+		}
+		for c := len(candidates); c > factor; c = (c + factor - 1) / factor {
+			rounds = append(rounds, 0)
+		}
+		for r := range rounds {
+			rows := n
+			for i := r; i < len(rounds)-1; i++ {
+				rows /= factor
+			}
+			if rows < minRows {
+				rows = minRows
+			}
+			if rows > n {
+				rows = n
+			}
+			rounds[r] = rows
+		}
+	}
+
+	// Rounds subsample the same shuffled order, so the rows of each
+	// round include those of the previous one.
+	perm := rng.Perm(n)
+
+	var results []Result
+	for r, rows := range rounds {
+
+		subX := make([][]float64, rows)
+		subY := make([]float64, rows)
+		for i, idx := range perm[:rows] {
+			subX[i] = features[idx]
+			subY[i] = labels[idx]
+		}
+
+		folds, err := KFold(rows, spec.Folds, spec.Seed)
+		if err != nil {
+			return nil, Result{}, err
+		}
+
+		roundResults := evaluateCandidates(spec.Model, candidates, subX, subY, folds, metric, higherIsBetter, workers)
+
+		sort.SliceStable(roundResults, func(a, b int) bool {
+			if higherIsBetter {
+				return roundResults[a].Mean > roundResults[b].Mean
+			}
+			return roundResults[a].Mean < roundResults[b].Mean
+		})
+		for i := range roundResults {
+			roundResults[i].Round = r + 1
+			roundResults[i].Rows = rows
+		}
+		results = append(results, roundResults...)
+
+		// Keep the best candidates for the next round.
+		if r < len(rounds)-1 {
+			keep := (len(candidates) + factor - 1) / factor
+			candidates = make([]Params, keep)
+			for i := range candidates {
+				candidates[i] = roundResults[i].Params
+			}
+		}
+	}
+
+	// The best candidate is the first of the last round.
+	best := results[len(results)-len(candidates)]
+	if best.Err != nil {
+		return nil, Result{}, fmt.Errorf("no candidate could be fit, e.g. %s: %v", formatParams(best.Params), best.Err)
+	}
+
+	return results, best, nil
+}
+
+// roundMinimum returns the fewest rows a halving round may use: the
+// spec's MinRows, at least two rows per fold, and for kNN enough rows
+// that every fold trains on at least the largest k of the candidates.
+func roundMinimum(spec SearchSpec, candidates []Params) (int, error) {
+
+	rows := spec.MinRows
+	if rows < 2*spec.Folds {
+		rows = 2 * spec.Folds
+	}
+
+	if spec.Model == "knn" || spec.Model == "knn-classifier" {
+		var maxK int
+		for _, c := range candidates {
+			k, err := intParam(c, "k", 5, 1)
+			if err != nil {
+				return 0, err
+			}
+			if k > maxK {
+				maxK = k
+			}
+		}
+
+		// The largest fold holds out ceil(rows/folds) of the rows.
+		for rows-(rows+spec.Folds-1)/spec.Folds < maxK {
+			rows++
+		}
+	}
+
+	return rows, nil
+}
+
+// evaluateCandidates cross validates each candidate, running up to
+// workers of them concurrently. Candidates that fail are given the
+// worst score, so that they drop out of the search.
+func evaluateCandidates(name string, candidates []Params, features [][]float64, labels []float64, folds []Fold, metric Metric, higherIsBetter bool, workers int) []Result {
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make([]Result, len(candidates))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range jobs {
+				params := candidates[c]
+				newFn := func() Model {
+					m, _ := newModel(name, params)
+					return m
+				}
+
+				score, err := CrossValidate(newFn, features, labels, folds, metric)
+				if err != nil {
+					score = Score{Mean: math.Inf(1)}
+					if higherIsBetter {
+						score.Mean = math.Inf(-1)
+					}
+				}
+				results[c] = Result{Params: params, Mean: score.Mean, StdDev: score.StdDev, Err: err}
+			}
+		}()
+	}
+
+	for c := range candidates {
+		jobs <- c
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// gridCandidates returns every combination of the parameter values.
+func gridCandidates(space map[string]ParamSpec) ([]Params, error) {
+
+	candidates := []Params{{}}
+	for _, name := range paramNames(space) {
+		values, err := gridValues(space[name])
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %v", name, err)
+		}
+
+		var next []Params
+		for _, c := range candidates {
+			for _, v := range values {
+				p := Params{name: v}
+				for k, cv := range c {
+					p[k] = cv
+				}
+				next = append(next, p)
+			}
+		}
+		candidates = next
+	}
+
+	return candidates, nil
+}
+
+// gridValues returns the values of a parameter used by a grid search.
+func gridValues(s ParamSpec) ([]interface{}, error) {
+
+	switch {
+	case len(s.Values) > 0:
+		return s.Values, nil
+
+	case s.Step > 0:
+		var values []interface{}
+		for i := 0; s.Min+float64(i)*s.Step <= s.Max+1e-9*s.Step; i++ {
+			values = append(values, s.Min+float64(i)*s.Step)
+		}
+		return values, nil
+
+	case s.Distribution != "":
+		if s.Num < 1 {
+			return nil, errors.New("a grid over a distribution needs num points")
+		}
+		values := make([]interface{}, s.Num)
+		for i := range values {
+			t := 0.0
+			if s.Num > 1 {
+				t = float64(i) / float64(s.Num-1)
+			}
+			v, err := fromUnit(s, t)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	}
+
+	return nil, errors.New("no values, range or distribution given")
+}
+
+// randomCandidates draws n distinct candidates at random, picking from
+// the listed values and ranges uniformly and from the distributions.
+// When every parameter is discrete, n is capped at the number of
+// combinations, and repeated draws are redrawn.
+func randomCandidates(space map[string]ParamSpec, n int, rng *rand.Rand) ([]Params, error) {
+
+	if n < 1 {
+		return nil, errors.New("a random search needs at least one candidate")
+	}
+
+	// Count the combinations of the discrete parameters.
+	combinations := 1
+	for _, s := range space {
+		switch {
+		case len(s.Values) > 0:
+			combinations *= len(s.Values)
+		case s.Step > 0:
+			combinations *= int(math.Floor((s.Max-s.Min)/s.Step+1e-9)) + 1
+		default:
+			combinations = 0
+		}
+		if combinations == 0 || combinations >= n {
+			break
+		}
+	}
+	if combinations > 0 && combinations < n {
+		n = combinations
+	}
+
+	var candidates []Params
+	seen := make(map[string]bool)
+	for len(candidates) < n {
+		c := Params{}
+		for _, name := range paramNames(space) {
+			s := space[name]
+			switch {
+			case len(s.Values) > 0:
+				c[name] = s.Values[rng.Intn(len(s.Values))]
+
+			case s.Step > 0:
+				steps := int(math.Floor((s.Max-s.Min)/s.Step+1e-9)) + 1
+				c[name] = s.Min + float64(rng.Intn(steps))*s.Step
+
+			case s.Distribution != "":
+				v, err := fromUnit(s, rng.Float64())
+				if err != nil {
+					return nil, fmt.Errorf("parameter %s: %v", name, err)
+				}
+				c[name] = v
+
+			default:
+				return nil, fmt.Errorf("parameter %s: no values, range or distribution given", name)
+			}
+		}
+
+		if key := formatParams(c); !seen[key] {
+			seen[key] = true
+			candidates = append(candidates, c)
+		}
+	}
+
+	return candidates, nil
+}
+
+// fromUnit maps t in [0, 1] onto the range of a distribution.
+func fromUnit(s ParamSpec, t float64) (float64, error) {
+
+	switch s.Distribution {
+	case "uniform":
+		return s.Min + t*(s.Max-s.Min), nil
+	case "loguniform":
+		if s.Min <= 0 || s.Max <= 0 {
+			return 0, errors.New("a log-uniform range must be positive")
+		}
+		return math.Exp(math.Log(s.Min) + t*(math.Log(s.Max)-math.Log(s.Min))), nil
+	}
+
+	return 0, fmt.Errorf("unknown distribution %s", s.Distribution)
+}
+
+// paramNames returns the parameter names in sorted order.
+func paramNames(space map[string]ParamSpec) []string {
+	var names []string
+	for name := range space {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatParams formats the parameters of a candidate for output.
+func formatParams(p Params) string {
+	var s string
+	for _, name := range sortedKeys(p) {
+		if s != "" {
+			s += " "
+		}
+		s += name + "=" + formatValue(p[name])
+	}
+	return s
+}
+
+// formatValue formats a parameter value for output.
+func formatValue(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'g', 6, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// sortedKeys returns the parameter names of a candidate in sorted order.
+func sortedKeys(p Params) []string {
+	var names []string
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newModel creates an untrained model of the named type with
+// the given parameters.
+func newModel(name string, p Params) (Model, error) {
+
+	switch name {
+	case "ridge":
+		lambda, err := floatParam(p, "lambda", 1)
+		if err != nil {
+			return nil, err
+		}
+		if lambda < 0 {
+			return nil, errors.New("lambda must be non-negative")
+		}
+		return &ridgeModel{lambda: lambda}, nil
+
+	case "knn", "knn-classifier":
+		k, err := intParam(p, "k", 5, 1)
+		if err != nil {
+			return nil, err
+		}
+		weights, err := stringParam(p, "weights", "uniform")
+		if err != nil {
+			return nil, err
+		}
+		if weights != "uniform" && weights != "distance" {
+			return nil, fmt.Errorf("unknown weights %s", weights)
+		}
+		distance, err := stringParam(p, "distance", "euclidean")
+		if err != nil {
+			return nil, err
+		}
+		if distance != "euclidean" && distance != "manhattan" {
+			return nil, fmt.Errorf("unknown distance %s", distance)
+		}
+		return &knnModel{k: k, weights: weights, distance: distance, classify: name == "knn-classifier"}, nil
+
+	case "forest", "forest-classifier":
+		trees, err := intParam(p, "trees", 10, 1)
+		if err != nil {
+			return nil, err
+		}
+		maxDepth, err := intParam(p, "maxDepth", 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		minLeaf, err := intParam(p, "minLeaf", 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		maxFeatures, err := intParam(p, "maxFeatures", 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &forestModel{trees: trees, maxDepth: maxDepth, minLeaf: minLeaf, maxFeatures: maxFeatures, classify: name == "forest-classifier"}, nil
+
+	case "neuralnet":
+		hidden, err := intParam(p, "hiddenNeurons", 3, 1)
+		if err != nil {
+			return nil, err
+		}
+		epochs, err := intParam(p, "numEpochs", 5000, 1)
+		if err != nil {
+			return nil, err
+		}
+		learningRate, err := floatParam(p, "learningRate", 0.3)
+		if err != nil {
+			return nil, err
+		}
+		if learningRate <= 0 {
+			return nil, errors.New("learningRate must be positive")
+		}
+		return &neuralNetModel{hidden: hidden, epochs: epochs, learningRate: learningRate}, nil
+	}
+
+	return nil, fmt.Errorf("unknown model %s", name)
+}
+
+// floatParam returns a numeric parameter, or def when it is not set.
+func floatParam(p Params, name string, def float64) (float64, error) {
+	v, ok := p[name]
+	if !ok {
+		return def, nil
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return 0, fmt.Errorf("parameter %s must be a number", name)
+	}
+	return f, nil
+}
+
+// intParam returns an integer parameter of at least min,
+// or def when it is not set.
+func intParam(p Params, name string, def, min int) (int, error) {
+	f, err := floatParam(p, name, float64(def))
+	if err != nil {
+		return 0, err
+	}
+	if f < float64(min) || f != math.Trunc(f) {
+		return 0, fmt.Errorf("%s must be an integer of at least %d", name, min)
+	}
+	return int(f), nil
+}
+
+// stringParam returns a string parameter, or def when it is not set.
+func stringParam(p Params, name string, def string) (string, error) {
+	v, ok := p[name]
+	if !ok {
+		return def, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("parameter %s must be a string", name)
+	}
+	return s, nil
+}
+
+// fittedInfo returns the serializable form of a fitted model.
+func fittedInfo(model Model, names []string) interface{} {
+
+	switch m := model.(type) {
+	case *ridgeModel:
+		info := ModelInfo{Intercept: m.intercept}
+		for j, c := range m.coefficients {
+			info.Coefficients = append(info.Coefficients, CoefficientInfo{Name: names[j], Coefficient: c})
+		}
+		return info
+
+	case *knnModel:
+		return KNNInfo{K: m.k, Weights: m.weights, Distance: m.distance, Classify: m.classify, Features: names, Rows: m.features, Labels: m.labels}
+
+	case *forestModel:
+		info := ForestInfo{Classify: m.classify}
+		for _, root := range m.roots {
+			info.Trees = append(info.Trees, root.info(names))
+		}
+		return info
+
+	case *neuralNetModel:
+		return NeuralNetInfo{
+			Features:      names,
+			Means:         m.means,
+			Scales:        m.scales,
+			HiddenWeights: m.wHidden,
+			HiddenBias:    m.bHidden,
+			OutputWeights: m.wOut,
+			OutputBias:    m.bOut,
+			Classes:       m.classes,
+		}
+	}
+
+	return nil
+}
+
+// distinctLabels returns the sorted distinct labels.
+func distinctLabels(labels []float64) []float64 {
+	seen := make(map[float64]bool)
+	var out []float64
+	for _, l := range labels {
+		if !seen[l] {
+			seen[l] = true
+			out = append(out, l)
+		}
+	}
+	sort.Float64s(out)
+	return out
+}
+
+// vote returns the label with the most weight, preferring the
+// smallest label in a tie.
+func vote(weights map[float64]float64) float64 {
+	best, bestWeight := math.Inf(1), math.Inf(-1)
+	for label, w := range weights {
+		if w > bestWeight || (w == bestWeight && label < best) {
+			best, bestWeight = label, w
+		}
+	}
+	return best
+}
+
+// ridgeModel is a linear regression with an L2 penalty on the
+// coefficients. The intercept is not penalized.
+type ridgeModel struct {
+	lambda       float64
+	intercept    float64
+	coefficients []float64
+}
+
+// Fit solves (XᵀX + λI)β = Xᵀy on the centered features and labels.
+func (m *ridgeModel) Fit(features [][]float64, labels []float64) error {
+
+	n, p := len(features), len(features[0])
+
+	means := make([]float64, p)
+	for _, row := range features {
+		for j, v := range row {
+			means[j] += v / float64(n)
+		}
+	}
+	yMean := stat.Mean(labels, nil)
+
+	x := mat.NewDense(n, p, nil)
+	y := mat.NewVecDense(n, nil)
+	for i, row := range features {
+		for j, v := range row {
+			x.Set(i, j, v-means[j])
+		}
+		y.SetVec(i, labels[i]-yMean)
+	}
+
+	var a mat.Dense
+	a.Mul(x.T(), x)
+	for j := 0; j < p; j++ {
+		a.Set(j, j, a.At(j, j)+m.lambda)
+	}
+
+	var b, beta mat.VecDense
+	b.MulVec(x.T(), y)
+	if err := beta.SolveVec(&a, &b); err != nil {
+		return err
+	}
+
+	m.coefficients = make([]float64, p)
+	m.intercept = yMean
+	for j := range m.coefficients {
+		m.coefficients[j] = beta.AtVec(j)
+		m.intercept -= m.coefficients[j] * means[j]
+	}
+
+	return nil
+}
+
+// Predict makes a prediction with the fitted coefficients.
+func (m *ridgeModel) Predict(features []float64) (float64, error) {
+	if len(features) != len(m.coefficients) {
+		return 0, errors.New("unexpected number of features")
+	}
+	pred := m.intercept
+	for j, v := range features {
+		pred += m.coefficients[j] * v
+	}
+	return pred, nil
+}
+
+// knnModel is a k-nearest neighbors model, which averages the labels
+// of the neighbors for regression or lets them vote when classify
+// is set.
+type knnModel struct {
+	k        int
+	weights  string
+	distance string
+	classify bool
+	features [][]float64
+	labels   []float64
+}
+
+// Fit stores the training data.
+func (m *knnModel) Fit(features [][]float64, labels []float64) error {
+	if len(features) < m.k {
+		return fmt.Errorf("k = %d is more than the %d training rows", m.k, len(features))
+	}
+	m.features = features
+	m.labels = labels
+	return nil
+}
+
+// Predict combines the labels of the k nearest training rows, weighting
+// them by inverse distance when the weights are "distance".
+func (m *knnModel) Predict(features []float64) (float64, error) {
+
+	dists := make([]float64, len(m.features))
+	order := make([]int, len(m.features))
+	for i, row := range m.features {
+		var d float64
+		for j, v := range row {
+			if m.distance == "manhattan" {
+				d += math.Abs(v - features[j])
+			} else {
+				d += (v - features[j]) * (v - features[j])
+			}
+		}
+		if m.distance != "manhattan" {
+			d = math.Sqrt(d)
+		}
+		dists[i] = d
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return dists[order[a]] < dists[order[b]] })
+
+	var sum, total float64
+	votes := make(map[float64]float64)
+	for _, i := range order[:m.k] {
+		w := 1.0
+		if m.weights == "distance" {
+			if dists[i] == 0 {
+				return m.labels[i], nil
+			}
+			w = 1 / dists[i]
+		}
+		sum += w * m.labels[i]
+		total += w
+		votes[m.labels[i]] += w
+	}
+
+	if m.classify {
+		return vote(votes), nil
+	}
+
+	return sum / total, nil
+}
+
+// forestModel is a random forest of regression trees, or of
+// classification trees that vote when classify is set. Each tree is
+// grown on a bootstrap sample of the rows, trying maxFeatures random
+// features at each split (all of them when zero for regression, and
+// the square root of their number for classification).
+type forestModel struct {
+	trees       int
+	maxDepth    int
+	minLeaf     int
+	maxFeatures int
+	classify    bool
+	roots       []*treeNode
+}
+
+// treeNode is a node of a tree. Leaves have no children.
+type treeNode struct {
+	feature     int
+	threshold   float64
+	left, right *treeNode
+	value       float64
+}
+
+// Fit grows the trees. The sampling is seeded, so the same data
+// always gives the same forest.
+func (m *forestModel) Fit(features [][]float64, labels []float64) error {
+
+	p := len(features[0])
+	maxFeatures := m.maxFeatures
+	if maxFeatures == 0 {
+		maxFeatures = p
+		if m.classify {
+			maxFeatures = int(math.Max(1, math.Sqrt(float64(p))))
+		}
+	}
+	if maxFeatures > p {
+		return fmt.Errorf("maxFeatures = %d is more than the %d features", maxFeatures, p)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	m.roots = make([]*treeNode, m.trees)
+	for t := range m.roots {
+		idx := make([]int, len(labels))
+		for i := range idx {
+			idx[i] = rng.Intn(len(labels))
+		}
+		m.roots[t] = m.grow(features, labels, idx, 0, maxFeatures, rng)
+	}
+
+	return nil
+}
+
+// grow builds the subtree for the rows idx by choosing the split that
+// most reduces the squared error, or the Gini impurity when classifying.
+func (m *forestModel) grow(features [][]float64, labels []float64, idx []int, depth, maxFeatures int, rng *rand.Rand) *treeNode {
+
+	node := &treeNode{value: m.leafValue(labels, idx)}
+	if len(idx) < 2*m.minLeaf || (m.maxDepth > 0 && depth >= m.maxDepth) || m.impurity(labels, idx) == 0 {
+		return node
+	}
+
+	bestScore, bestFeature, bestThreshold := m.impurity(labels, idx)*float64(len(idx)), -1, 0.0
+	sorted := append([]int(nil), idx...)
+	for _, j := range rng.Perm(len(features[0]))[:maxFeatures] {
+		sort.Slice(sorted, func(a, b int) bool { return features[sorted[a]][j] < features[sorted[b]][j] })
+
+		// Score each split between distinct values, keeping at
+		// least minLeaf rows on either side.
+		for i := m.minLeaf; i <= len(sorted)-m.minLeaf; i++ {
+			lo, hi := features[sorted[i-1]][j], features[sorted[i]][j]
+			if lo == hi {
+				continue
+			}
+			score := m.impurity(labels, sorted[:i])*float64(i) + m.impurity(labels, sorted[i:])*float64(len(sorted)-i)
+			if score < bestScore-1e-12 {
+				bestScore, bestFeature, bestThreshold = score, j, (lo+hi)/2
+			}
+		}
+	}
+	if bestFeature < 0 {
+		return node
+	}
+
+	var left, right []int
+	for _, i := range idx {
+		if features[i][bestFeature] <= bestThreshold {
+			left = append(left, i)
+		} else {
+			right = append(right, i)
+		}
+	}
+
+	node.feature, node.threshold = bestFeature, bestThreshold
+	node.left = m.grow(features, labels, left, depth+1, maxFeatures, rng)
+	node.right = m.grow(features, labels, right, depth+1, maxFeatures, rng)
+
+	return node
+}
+
+// impurity returns the variance of the labels of the rows idx, or
+// their Gini impurity when classifying.
+func (m *forestModel) impurity(labels []float64, idx []int) float64 {
+
+	if m.classify {
+		counts := make(map[float64]float64)
+		for _, i := range idx {
+			counts[labels[i]]++
+		}
+		gini := 1.0
+		for _, c := range counts {
+			gini -= (c / float64(len(idx))) * (c / float64(len(idx)))
+		}
+		return gini
+	}
+
+	var sum, sumSq float64
+	for _, i := range idx {
+		sum += labels[i]
+		sumSq += labels[i] * labels[i]
+	}
+	mean := sum / float64(len(idx))
+	return math.Max(0, sumSq/float64(len(idx))-mean*mean)
+}
+
+// leafValue returns the mean label of the rows idx, or their most
+// common label when classifying.
+func (m *forestModel) leafValue(labels []float64, idx []int) float64 {
+
+	if m.classify {
+		counts := make(map[float64]float64)
+		for _, i := range idx {
+			counts[labels[i]]++
+		}
+		return vote(counts)
+	}
+
+	var sum float64
+	for _, i := range idx {
+		sum += labels[i]
+	}
+	return sum / float64(len(idx))
+}
+
+// Predict averages the predictions of the trees, or takes
+// their vote when classifying.
+func (m *forestModel) Predict(features []float64) (float64, error) {
+
+	var sum float64
+	votes := make(map[float64]float64)
+	for _, root := range m.roots {
+		node := root
+		for node.left != nil {
+			if features[node.feature] <= node.threshold {
+				node = node.left
+			} else {
+				node = node.right
+			}
+		}
+		sum += node.value
+		votes[node.value]++
+	}
+
+	if m.classify {
+		return vote(votes), nil
+	}
+
+	return sum / float64(len(m.roots)), nil
+}
+
+// info returns the serializable form of the subtree.
+func (n *treeNode) info(names []string) *TreeInfo {
+	if n.left == nil {
+		return &TreeInfo{Value: n.value}
+	}
+	return &TreeInfo{
+		Feature:   names[n.feature],
+		Threshold: n.threshold,
+		Left:      n.left.info(names),
+		Right:     n.right.info(names),
+		Value:     n.value,
+	}
+}
+
+// neuralNetModel is a classifier with one hidden layer of sigmoid
+// neurons and one sigmoid output per class, trained by backpropagation
+// on the whole training set in each epoch. The features are
+// standardized first.
+type neuralNetModel struct {
+	hidden       int
+	epochs       int
+	learningRate float64
+	classes      []float64
+	means        []float64
+	scales       []float64
+	wHidden      [][]float64
+	bHidden      []float64
+	wOut         [][]float64
+	bOut         []float64
+}
+
+// sigmoid implements the sigmoid function
+// for use in activation functions.
+func sigmoid(x float64) float64 {
+	return 1.0 / (1.0 + math.Exp(-x))
+}
+
+// Fit trains the weights, starting from seeded random values so the
+// same data always gives the same network.
+func (m *neuralNetModel) Fit(features [][]float64, labels []float64) error {
+
+	n, p := len(features), len(features[0])
+	m.classes = distinctLabels(labels)
+	k := len(m.classes)
+	if k < 2 {
+		return errors.New("at least two classes are required")
+	}
+
+	// Standardize the features.
+	m.means = make([]float64, p)
+	m.scales = make([]float64, p)
+	for j := 0; j < p; j++ {
+		col := make([]float64, n)
+		for i, row := range features {
+			col[i] = row[j]
+		}
+		m.means[j], m.scales[j] = stat.MeanStdDev(col, nil)
+		if m.scales[j] == 0 {
+			m.scales[j] = 1
+		}
+	}
+	x := make([][]float64, n)
+	for i, row := range features {
+		x[i] = m.standardize(row)
+	}
+
+	// One-hot encode the labels.
+	y := make([][]float64, n)
+	for i, l := range labels {
+		y[i] = make([]float64, k)
+		y[i][sort.SearchFloat64s(m.classes, l)] = 1
+	}
+
+	// Initialize the weights and biases.
+	rng := rand.New(rand.NewSource(1))
+	random := func(rows, cols int) [][]float64 {
+		w := make([][]float64, rows)
+		for r := range w {
+			w[r] = make([]float64, cols)
+			for c := range w[r] {
+				w[r][c] = rng.Float64()
+			}
+		}
+		return w
+	}
+	m.wHidden = random(p, m.hidden)
+	m.bHidden = random(1, m.hidden)[0]
+	m.wOut = random(m.hidden, k)
+	m.bOut = random(1, k)[0]
+
+	for epoch := 0; epoch < m.epochs; epoch++ {
+
+		// Accumulate the gradients over all of the rows.
+		gwHidden := make([][]float64, p)
+		for j := range gwHidden {
+			gwHidden[j] = make([]float64, m.hidden)
+		}
+		gbHidden := make([]float64, m.hidden)
+		gwOut := make([][]float64, m.hidden)
+		for h := range gwOut {
+			gwOut[h] = make([]float64, k)
+		}
+		gbOut := make([]float64, k)
+
+		for i, row := range x {
+			hidden, out := m.forward(row)
+
+			// Back propagate the output errors to the hidden layer.
+			dOut := make([]float64, k)
+			for c := range out {
+				dOut[c] = (y[i][c] - out[c]) * out[c] * (1 - out[c])
+				gbOut[c] += dOut[c]
+			}
+			for h, a := range hidden {
+				var errHidden float64
+				for c := range dOut {
+					gwOut[h][c] += a * dOut[c]
+					errHidden += dOut[c] * m.wOut[h][c]
+				}
+				dHidden := errHidden * a * (1 - a)
+				gbHidden[h] += dHidden
+				for j, v := range row {
+					gwHidden[j][h] += v * dHidden
+				}
+			}
+		}
+
+		// Adjust the weights and biases.
+		for j := range m.wHidden {
+			for h := range m.wHidden[j] {
+				m.wHidden[j][h] += m.learningRate * gwHidden[j][h]
+			}
+		}
+		for h := range m.wOut {
+			m.bHidden[h] += m.learningRate * gbHidden[h]
+			for c := range m.wOut[h] {
+				m.wOut[h][c] += m.learningRate * gwOut[h][c]
+			}
+		}
+		for c := range m.bOut {
+			m.bOut[c] += m.learningRate * gbOut[c]
+		}
+	}
+
+	return nil
+}
+
+// standardize scales a row of features with the training means and
+// standard deviations.
+func (m *neuralNetModel) standardize(row []float64) []float64 {
+	out := make([]float64, len(row))
+	for j, v := range row {
+		out[j] = (v - m.means[j]) / m.scales[j]
+	}
+	return out
+}
+
+// forward returns the activations of the hidden and output layers.
+func (m *neuralNetModel) forward(row []float64) ([]float64, []float64) {
+
+	hidden := make([]float64, m.hidden)
+	for h := range hidden {
+		v := m.bHidden[h]
+		for j, x := range row {
+			v += x * m.wHidden[j][h]
+		}
+		hidden[h] = sigmoid(v)
+	}
+
+	out := make([]float64, len(m.classes))
+	for c := range out {
+		v := m.bOut[c]
+		for h, a := range hidden {
+			v += a * m.wOut[h][c]
+		}
+		out[c] = sigmoid(v)
+	}
+
+	return hidden, out
+}
+
+// Predict returns the class with the largest output.
+func (m *neuralNetModel) Predict(features []float64) (float64, error) {
+
+	if len(features) != len(m.means) {
+		return 0, errors.New("unexpected number of features")
+	}
+
+	_, out := m.forward(m.standardize(features))
+	best := 0
+	for c, v := range out {
+		if v > out[best] {
+			best = c
+		}
+	}
+
+	return m.classes[best], nil
+}
+
+// Fold includes the training and test row indices of one fold.
+type Fold struct {
+	Train []int
+	Test  []int
+}
+
+// Metric scores the predictions of a model against the observed values.
+type Metric func(observed, predicted []float64) float64
+
+// Score includes the mean and standard deviation of a metric over folds.
+type Score struct {
+	Mean   float64
+	StdDev float64
+}
+
+// CrossValidate fits a new model on the training rows of each fold and
+// scores its predictions for the test rows.
+func CrossValidate(newModel func() Model, features [][]float64, labels []float64, folds []Fold, metric Metric) (Score, error) {
+
+	values := make([]float64, len(folds))
+	for f, fold := range folds {
+
+		trainX := make([][]float64, len(fold.Train))
+		trainY := make([]float64, len(fold.Train))
+		for i, idx := range fold.Train {
+			trainX[i] = features[idx]
+			trainY[i] = labels[idx]
+		}
+
+		model := newModel()
+		if err := model.Fit(trainX, trainY); err != nil {
+			return Score{}, err
+		}
+
+		observed := make([]float64, len(fold.Test))
+		predicted := make([]float64, len(fold.Test))
+		for i, idx := range fold.Test {
+			p, err := model.Predict(features[idx])
+			if err != nil {
+				return Score{}, err
+			}
+			observed[i] = labels[idx]
+			predicted[i] = p
+		}
+
+		values[f] = metric(observed, predicted)
+	}
+
+	mean, std := stat.MeanStdDev(values, nil)
+	return Score{Mean: mean, StdDev: std}, nil
+}
+
+// KFold shuffles n rows and divides them into k folds of nearly
+// equal size.
+func KFold(n, k int, seed int64) ([]Fold, error) {
+
+	if k < 2 || k > n {
+		return nil, fmt.Errorf("cannot make %d folds from %d rows", k, n)
+	}
+
+	perm := rand.New(rand.NewSource(seed)).Perm(n)
+	folds := make([]Fold, k)
+	for i, idx := range perm {
+		for f := range folds {
+			if f == i%k {
+				folds[f].Test = append(folds[f].Test, idx)
+			} else {
+				folds[f].Train = append(folds[f].Train, idx)
+			}
+		}
+	}
+
+	return folds, nil
+}
+
+// metricByName returns the named metric and whether higher
+// values of it are better.
+func metricByName(name string) (Metric, bool, error) {
+
+	switch name {
+	case "mae":
+		return func(observed, predicted []float64) float64 {
+			var sum float64
+			for i, o := range observed {
+				sum += math.Abs(o - predicted[i])
+			}
+			return sum / float64(len(observed))
+		}, false, nil
+
+	case "rmse":
+		return func(observed, predicted []float64) float64 {
+			var sum float64
+			for i, o := range observed {
+				sum += (o - predicted[i]) * (o - predicted[i])
+			}
+			return math.Sqrt(sum / float64(len(observed)))
+		}, false, nil
+
+	case "r2":
+		return func(observed, predicted []float64) float64 {
+			return stat.RSquaredFrom(predicted, observed, nil)
+		}, true, nil
+
+	case "accuracy":
+		return func(observed, predicted []float64) float64 {
+			var correct float64
+			for i, o := range observed {
+				if o == predicted[i] {
+					correct++
+				}
+			}
+			return correct / float64(len(observed))
+		}, true, nil
+	}
+
+	return nil, false, fmt.Errorf("unknown metric %s", name)
+}
+
+// readDataset reads the target and feature columns from a CSV file.
+// Without feature names, every column except the target is used. A
+// target that is not numeric is treated as class names, which are
+// sorted and returned, and each label is the index of its class.
+func readDataset(path, target string, names []string) ([]string, [][]float64, []float64, []string, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if len(records) < 2 {
+		return nil, nil, nil, nil, errors.New("expected a header and at least one row")
+	}
+
+	positions := make(map[string]int)
+	for p, h := range records[0] {
+		positions[h] = p
+	}
+	targetPos, ok := positions[target]
+	if !ok {
+		return nil, nil, nil, nil, fmt.Errorf("target column %s not found", target)
+	}
+
+	if len(names) == 0 {
+		for _, h := range records[0] {
+			if h != target {
+				names = append(names, h)
+			}
+		}
+	}
+	for _, name := range names {
+		if _, ok := positions[name]; !ok {
+			return nil, nil, nil, nil, fmt.Errorf("feature column %s not found", name)
+		}
+	}
+
+	// Collect the class names if any target value is not a number.
+	var classes []string
+	index := make(map[string]int)
+	for _, record := range records[1:] {
+		if _, err := strconv.ParseFloat(record[targetPos], 64); err != nil {
+			for _, r := range records[1:] {
+				if _, ok := index[r[targetPos]]; !ok {
+					index[r[targetPos]] = 0
+					classes = append(classes, r[targetPos])
+				}
+			}
+			sort.Strings(classes)
+			for i, c := range classes {
+				index[c] = i
+			}
+			break
+		}
+	}
+
+	features := make([][]float64, len(records)-1)
+	labels := make([]float64, len(records)-1)
+	for i, record := range records[1:] {
+		if classes != nil {
+			labels[i] = float64(index[record[targetPos]])
+		} else {
+			labels[i], err = strconv.ParseFloat(record[targetPos], 64)
+			if err != nil {
+				return nil, nil, nil, nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+			}
+		}
+
+		features[i] = make([]float64, len(names))
+		for j, name := range names {
+			features[i][j], err = strconv.ParseFloat(record[positions[name]], 64)
+			if err != nil {
+				return nil, nil, nil, nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+			}
+		}
+	}
+
+	return names, features, labels, classes, nil
+}
+
+// writeResults writes the results table to a CSV file, with one
+// column per parameter.
+func writeResults(path string, spec SearchSpec, results []Result) error {
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	names := paramNames(spec.Params)
+	w := csv.NewWriter(f)
+	header := append([]string{"round", "rows"}, names...)
+	header = append(header, spec.Metric+"_mean", spec.Metric+"_std", "error")
+	if err := w.Write(header); err != nil {
+		f.Close()
+		return err
+	}
+
+	for _, r := range results {
+		record := []string{strconv.Itoa(r.Round), strconv.Itoa(r.Rows)}
+		for _, name := range names {
+			record = append(record, formatValue(r.Params[name]))
+		}
+		record = append(record, strconv.FormatFloat(r.Mean, 'f', 6, 64), strconv.FormatFloat(r.StdDev, 'f', 6, 64))
+		if r.Err != nil {
+			record = append(record, r.Err.Error())
+		} else {
+			record = append(record, "")
+		}
+		if err := w.Write(record); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	// Flush the writer before closing the file.
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// SplitConfig includes the settings for splitting the rows of a dataset.
+// Strata and Groups, when non-nil, hold a label and a group for each row.
+type SplitConfig struct {
+	Fractions []float64
+	Seed      int64
+	Strata    []string
+	Groups    []string
+}
+
+// SetInfo includes the summary of one of the sets of a split.
+type SetInfo struct {
+	Name     string         `json:"name"`
+	File     string         `json:"file"`
+	Fraction float64        `json:"fraction"`
+	Rows     int            `json:"rows"`
+	Strata   map[string]int `json:"strata,omitempty"`
+	Groups   int            `json:"groups,omitempty"`
+}
+
+// Manifest includes the settings and row counts of a split, so
+// that the split can be reproduced and checked later.
+type Manifest struct {
+	Input    string    `json:"input"`
+	Seed     int64     `json:"seed"`
+	Stratify string    `json:"stratify,omitempty"`
+	Bins     int       `json:"bins,omitempty"`
+	Group    string    `json:"group,omitempty"`
+	Rows     int       `json:"rows"`
+	Sets     []SetInfo `json:"sets"`
+}
+
+func main() {
+
+	// Declare the split flags.
+	inPtr := flag.String("in", "diabetes.csv", "The CSV file to split")
+	trainPtr := flag.Float64("train", 0.8, "The fraction of rows in the training set")
+	validationPtr := flag.Float64("validation", 0, "The fraction of rows in the validation set")
+	testPtr := flag.Float64("test", 0.2, "The fraction of rows in the test set")
+	seedPtr := flag.Int64("seed", 42, "The seed for the shuffle")
+	stratifyPtr := flag.String("stratify", "", "The label column to stratify on")
+	binsPtr := flag.Int("bins", 0, "The number of quantile bins for a numeric stratify column, 0 to use the values as labels")
+	groupPtr := flag.String("group", "", "The column identifying groups that must stay in the same set")
+	manifestPtr := flag.String("manifest", "manifest.json", "The output file for the split manifest")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Read in the dataset.
+	header, records, err := readRecords(*inPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Only the sets with a non-zero fraction are written out.
+	var names, files []string
+	var fractions []float64
+	for _, s := range []struct {
+		name     string
+		file     string
+		fraction float64
+	}{
+		{"training", "training.csv", *trainPtr},
+		{"validation", "validation.csv", *validationPtr},
+		{"test", "test.csv", *testPtr},
+	} {
+		if s.fraction > 0 {
+			names = append(names, s.name)
+			files = append(files, s.file)
+			fractions = append(fractions, s.fraction)
+		}
+	}
+
+	cfg := SplitConfig{
+		Fractions: fractions,
+		Seed:      *seedPtr,
+	}
+
+	// Gather the stratification labels.
+	if *stratifyPtr != "" {
+		cfg.Strata, err = column(header, records, *stratifyPtr)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if *binsPtr > 0 {
+			cfg.Strata, err = quantileBins(cfg.Strata, *binsPtr)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	// Gather the groups.
+	if *groupPtr != "" {
+		cfg.Groups, err = column(header, records, *groupPtr)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Split the rows.
+	sets, err := Split(len(records), cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	manifest := Manifest{
+		Input:    *inPtr,
+		Seed:     *seedPtr,
+		Stratify: *stratifyPtr,
+		Group:    *groupPtr,
+		Rows:     len(records),
+	}
+	if *stratifyPtr != "" {
+		manifest.Bins = *binsPtr
+	}
+
+	// Write out each of the sets and summarize them in the manifest.
+	fmt.Println()
+	for k, idx := range sets {
+		if err := writeRecords(files[k], header, records, idx); err != nil {
+			log.Fatal(err)
+		}
+
+		info := SetInfo{
+			Name:     names[k],
+			File:     files[k],
+			Fraction: fractions[k],
+			Rows:     len(idx),
+		}
+		if cfg.Strata != nil {
+			info.Strata = make(map[string]int)
+			for _, i := range idx {
+				info.Strata[cfg.Strata[i]]++
+			}
+		}
+		if cfg.Groups != nil {
+			groups := make(map[string]bool)
+			for _, i := range idx {
+				groups[cfg.Groups[i]] = true
+			}
+			info.Groups = len(groups)
+		}
+		manifest.Sets = append(manifest.Sets, info)
+
+		fmt.Printf("%-10s %5d rows -> %s\n", info.Name, info.Rows, info.File)
+	}
+	fmt.Println()
+
+	// Write out the manifest.
+	outputData, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(*manifestPtr, outputData, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Split shuffles the n rows of a dataset and assigns them to sets in
+// the given fractions, returning the row indices of each set. With
+// strata, each stratum is split in the same fractions. With groups,
+// whole groups are assigned to sets, so the fractions are only
+// approximate.
+func Split(n int, cfg SplitConfig) ([][]int, error) {
+
+	if n == 0 {
+		return nil, errors.New("there are no rows to split")
+	}
+	if len(cfg.Fractions) == 0 {
+		return nil, errors.New("at least one set is required")
+	}
+
+	var total float64
+	for _, f := range cfg.Fractions {
+		if f <= 0 {
+			return nil, errors.New("set fractions must be positive")
+		}
+		total += f
+	}
+	if math.Abs(total-1) > 1e-9 {
+		return nil, fmt.Errorf("set fractions sum to %v rather than 1", total)
+	}
+
+	if cfg.Strata != nil && len(cfg.Strata) != n {
+		return nil, errors.New("there must be one stratum label per row")
+	}
+	if cfg.Groups != nil && len(cfg.Groups) != n {
+		return nil, errors.New("there must be one group per row")
+	}
+	if cfg.Strata != nil && cfg.Groups != nil {
+		return nil, errors.New("stratified and grouped splits cannot be combined")
+	}
+
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	sets := make([][]int, len(cfg.Fractions))
+
+	switch {
+	case cfg.Groups != nil:
+		splitGroups(rng, cfg.Groups, cfg.Fractions, sets)
+		for _, idx := range sets {
+			if len(idx) == 0 {
+				return nil, errors.New("there are too few groups to fill every set")
+			}
+		}
+
+	case cfg.Strata != nil:
+
+		// Split each stratum, visiting them in sorted order so
+		// the split only depends on the seed.
+		byStratum := make(map[string][]int)
+		for i, s := range cfg.Strata {
+			byStratum[s] = append(byStratum[s], i)
+		}
+		var strata []string
+		for s := range byStratum {
+			strata = append(strata, s)
+		}
+		sort.Strings(strata)
+
+		for _, s := range strata {
+			rows := byStratum[s]
+			rng.Shuffle(len(rows), func(i, j int) { rows[i], rows[j] = rows[j], rows[i] })
+			splitRows(rows, cfg.Fractions, sets)
+		}
+
+	default:
+		splitRows(rng.Perm(n), cfg.Fractions, sets)
+	}
+
+	// Shuffle within each set, so that stratified and grouped
+	// sets are not ordered by stratum or group.
+	for _, idx := range sets {
+		rng.Shuffle(len(idx), func(i, j int) { idx[i], idx[j] = idx[j], idx[i] })
+	}
+
+	return sets, nil
+}
+
+// splitRows appends consecutive runs of the shuffled rows to the sets,
+// sized by allocate.
+func splitRows(rows []int, fractions []float64, sets [][]int) {
+
+	var start int
+	for k, count := range allocate(len(rows), fractions) {
+		sets[k] = append(sets[k], rows[start:start+count]...)
+		start += count
+	}
+}
+
+// allocate divides n rows between the sets in the given fractions,
+// giving the rows lost to rounding down to the sets with the largest
+// remainders.
+func allocate(n int, fractions []float64) []int {
+
+	counts := make([]int, len(fractions))
+	remainders := make([]float64, len(fractions))
+	assigned := 0
+	for k, f := range fractions {
+		exact := f * float64(n)
+		counts[k] = int(exact)
+		remainders[k] = exact - float64(counts[k])
+		assigned += counts[k]
+	}
+
+	order := make([]int, len(fractions))
+	for k := range order {
+		order[k] = k
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+
+	for i := 0; assigned < n; i++ {
+		counts[order[i%len(order)]]++
+		assigned++
+	}
+
+	return counts
+}
+
+// splitGroups shuffles the groups and assigns each in turn to the set
+// furthest below its target number of rows, relative to that target.
+func splitGroups(rng *rand.Rand, groups []string, fractions []float64, sets [][]int) {
+
+	byGroup := make(map[string][]int)
+	for i, g := range groups {
+		byGroup[g] = append(byGroup[g], i)
+	}
+	var keys []string
+	for g := range byGroup {
+		keys = append(keys, g)
+	}
+	sort.Strings(keys)
+	rng.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+
+	n := float64(len(groups))
+	for _, g := range keys {
+		best := 0
+		bestDeficit := math.Inf(-1)
+		for k, f := range fractions {
+			if deficit := 1 - float64(len(sets[k]))/(f*n); deficit > bestDeficit {
+				best = k
+				bestDeficit = deficit
+			}
+		}
+		sets[best] = append(sets[best], byGroup[g]...)
+	}
+}
+
+// quantileBins replaces numeric values with the label of the
+// quantile bin they fall in, for stratifying on a continuous column.
+func quantileBins(values []string, bins int) ([]string, error) {
+
+	vals := make([]float64, len(values))
+	for i, v := range values {
+		var err error
+		vals[i], err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("binning line %d failed: %v", i+2, err)
+		}
+	}
+
+	sorted := make([]float64, len(vals))
+	copy(sorted, vals)
+	sort.Float64s(sorted)
+
+	// edges holds the upper bound of each bin but the last.
+	edges := make([]float64, bins-1)
+	for k := range edges {
+		edges[k] = sorted[(k+1)*len(sorted)/bins]
+	}
+
+	labels := make([]string, len(vals))
+	for i, v := range vals {
+		labels[i] = "bin" + strconv.Itoa(sort.Search(len(edges), func(k int) bool { return v < edges[k] }))
+	}
+
+	return labels, nil
+}
+
+// column returns the values of the named column.
+func column(header []string, records [][]string, name string) ([]string, error) {
+
+	for j, h := range header {
+		if h == name {
+			values := make([]string, len(records))
+			for i, record := range records {
+				values[i] = record[j]
+			}
+			return values, nil
+		}
+	}
+
+	return nil, fmt.Errorf("column %s not found", name)
+}
+
+// readRecords reads a CSV file, returning the header and the rows.
+func readRecords(path string) ([]string, [][]string, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) < 2 {
+		return nil, nil, errors.New("expected a header and at least one row")
+	}
+
+	return records[0], records[1:], nil
+}
+
+// writeRecords writes the header and the given rows to a CSV file,
+// leaving the values exactly as they were read.
+func writeRecords(path string, header []string, records [][]string, idx []int) error {
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(f)
+	if err := w.Write(header); err != nil {
+		f.Close()
+		return err
+	}
+	for _, i := range idx {
+		if err := w.Write(records[i]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	// Flush the writer before closing the file.
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -69,5 +69,14 @@ func main() {
 		if err := setMap[idx].WriteCSV(w); err != nil {
 			log.Fatal(err)
 		}
+
+		// Flush the buffered writer and close the file.
+		if err := w.Flush(); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
 	}
 }
@@ -2,23 +2,55 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"image"
 	"image/color"
+	"image/color/palette"
+	imagedraw "image/draw"
+	"image/gif"
 	"io"
 	"log"
+	"math"
 	"os"
+	"strconv"
+	"strings"
 
 	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
 	"gonum.org/v1/plot/vg/draw"
-
-	"github.com/campoy/justforfunc/38-linreg-vanilla/linreg"
+	"gonum.org/v1/plot/vg/vgimg"
 )
 
+// config holds the settings of the gradient descent.
+type config struct {
+	iterations   int
+	learningRate float64
+	tolerance    float64
+	scale        bool
+}
+
+// fit is the result of the gradient descent. The weights and bias
+// are in the units of the original features, and history holds the
+// bias followed by the weights after each iteration.
+type fit struct {
+	weights []float64
+	bias    float64
+	losses  []float64
+	history [][]float64
+}
+
 func main() {
-	iterations := flag.Int("n", 1000, "number of iterations")
+	iterations := flag.Int("n", 1000, "maximum number of iterations")
+	learningRate := flag.Float64("lr", 0.1, "learning rate")
+	tolerance := flag.Float64("tol", 1e-9, "stop once the loss decreases by less than this")
+	scale := flag.Bool("scale", true, "standardize the features before the descent")
 	outPath := flag.String("o", "out.png", "path to output file")
+	lossPath := flag.String("loss", "loss.png", "path to the loss curve output file")
+	gifPath := flag.String("gif", "fit.gif", "path to the animation output file, or empty to skip it")
+	frames := flag.Int("frames", 40, "number of frames in the animation")
 	flag.Parse()
 
 	inPath := flag.Arg(0)
@@ -38,71 +70,326 @@ func main() {
 		log.Fatalf("could not read %s: %v", inPath, err)
 	}
 
-	outFile, err := os.Create(*outPath)
+	cfg := config{
+		iterations:   *iterations,
+		learningRate: *learningRate,
+		tolerance:    *tolerance,
+		scale:        *scale,
+	}
+	f, err := gradientDescent(xs, ys, cfg)
 	if err != nil {
-		log.Fatalf("could not create %s: %v", *outPath, err)
+		log.Fatalf("could not fit the data: %v", err)
 	}
 
-	err = plotData(outFile, xs, ys, *iterations)
-	if err != nil {
-		log.Fatalf("could not plot data: %v", err)
+	formula := fmt.Sprintf("y = %0.4f", f.bias)
+	for j, w := range f.weights {
+		formula += fmt.Sprintf(" + x%d*%0.4f", j+1, w)
+	}
+	fmt.Printf("%s\nafter %d iterations with loss %0.4f\n", formula, len(f.losses)-1, f.losses[len(f.losses)-1])
+
+	if err := writeFile(*lossPath, func(w io.Writer) error { return plotLoss(w, f.losses) }); err != nil {
+		log.Fatal(err)
 	}
 
-	err = outFile.Close()
+	// the fitted line can only be drawn for a single feature
+	if len(xs[0]) != 1 {
+		log.Printf("skipping the line plots of %d features", len(xs[0]))
+		return
+	}
+
+	x := make([]float64, len(xs))
+	for i := range xs {
+		x[i] = xs[i][0]
+	}
+
+	err = writeFile(*outPath, func(w io.Writer) error {
+		p, err := plotLine(x, ys, f.bias, f.weights[0], "")
+		if err != nil {
+			return err
+		}
+		return writePNG(w, p)
+	})
 	if err != nil {
-		log.Fatalf("could not close %s: %v", *outPath, err)
+		log.Fatal(err)
+	}
+
+	// The animation needs a fit before and after at least one
+	// iteration, so it is skipped when the descent never ran.
+	if *gifPath != "" && len(f.history) < 2 {
+		log.Printf("skipping the animation, which needs at least one iteration")
+	} else if *gifPath != "" {
+		err := writeFile(*gifPath, func(w io.Writer) error { return animate(w, x, ys, f, *frames) })
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 }
 
-func readData(data io.Reader) (xs, ys []float64, err error) {
+func readData(data io.Reader) (xs [][]float64, ys []float64, err error) {
 	s := bufio.NewScanner(data)
 	for s.Scan() {
-		var x, y float64
-		_, err := fmt.Sscanf(s.Text(), "%f,%f", &x, &y)
+		fields := strings.Split(s.Text(), ",")
+		if len(fields) < 2 {
+			log.Printf("discarding bad data point %q: expected features and a target", s.Text())
+			continue
+		}
+
+		vals := make([]float64, len(fields))
+		for i, field := range fields {
+			if vals[i], err = strconv.ParseFloat(strings.TrimSpace(field), 64); err != nil {
+				break
+			}
+		}
 		if err != nil {
 			log.Printf("discarding bad data point %q: %v", s.Text(), err)
+			err = nil
 			continue
 		}
-		xs = append(xs, x)
-		ys = append(ys, y)
+		if len(xs) > 0 && len(vals)-1 != len(xs[0]) {
+			return nil, nil, fmt.Errorf("expected %d features in %q", len(xs[0]), s.Text())
+		}
+
+		xs = append(xs, vals[:len(vals)-1])
+		ys = append(ys, vals[len(vals)-1])
 	}
 	if err := s.Err(); err != nil {
 		return nil, nil, fmt.Errorf("could not scan: %v", err)
 	}
+	if len(xs) == 0 {
+		return nil, nil, errors.New("no data points")
+	}
 	return xs, ys, nil
 }
 
+// gradientDescent fits y = bias + weights·x by batch gradient descent on
+// the mean squared error / 2, recording the loss before the first step and
+// after every step. It stops after cfg.iterations steps or once a step
+// lowers the loss by less than cfg.tolerance. With cfg.scale the descent
+// runs on standardized features, which lets one learning rate suit
+// features of any size, and the result is converted back.
+func gradientDescent(xs [][]float64, ys []float64, cfg config) (*fit, error) {
+	n, k := len(xs), len(xs[0])
+
+	// standardize the features if requested
+	mean := make([]float64, k)
+	std := make([]float64, k)
+	for j := range std {
+		std[j] = 1
+	}
+	if cfg.scale {
+		for j := 0; j < k; j++ {
+			var sum, sumSq float64
+			for _, x := range xs {
+				sum += x[j]
+				sumSq += x[j] * x[j]
+			}
+			mean[j] = sum / float64(n)
+			std[j] = math.Sqrt(sumSq/float64(n) - mean[j]*mean[j])
+			if std[j] == 0 {
+				return nil, fmt.Errorf("feature %d is constant", j+1)
+			}
+		}
+	}
+	scaled := make([][]float64, n)
+	for i, x := range xs {
+		scaled[i] = make([]float64, k)
+		for j, v := range x {
+			scaled[i][j] = (v - mean[j]) / std[j]
+		}
+	}
+
+	// unscale converts the scaled bias and weights back to the original
+	// units: w/std, and bias - Σ w·mean/std.
+	unscale := func(b float64, w []float64) []float64 {
+		coeffs := make([]float64, k+1)
+		coeffs[0] = b
+		for j := range w {
+			coeffs[j+1] = w[j] / std[j]
+			coeffs[0] -= w[j] * mean[j] / std[j]
+		}
+		return coeffs
+	}
+
+	loss := func(b float64, w []float64) float64 {
+		var sum float64
+		for i, x := range scaled {
+			r := predict(b, w, x) - ys[i]
+			sum += r * r
+		}
+		return sum / float64(2*n)
+	}
+
+	f := &fit{}
+	var b float64
+	w := make([]float64, k)
+	grad := make([]float64, k)
+	f.losses = append(f.losses, loss(b, w))
+	f.history = append(f.history, unscale(b, w))
+
+	for iter := 0; iter < cfg.iterations; iter++ {
+		var gradB float64
+		for j := range grad {
+			grad[j] = 0
+		}
+		for i, x := range scaled {
+			r := predict(b, w, x) - ys[i]
+			gradB += r / float64(n)
+			for j, v := range x {
+				grad[j] += r * v / float64(n)
+			}
+		}
+
+		b -= cfg.learningRate * gradB
+		for j := range w {
+			w[j] -= cfg.learningRate * grad[j]
+		}
+
+		l := loss(b, w)
+		if math.IsNaN(l) || math.IsInf(l, 0) {
+			return nil, fmt.Errorf("the descent diverged after %d iterations, try a lower learning rate", iter+1)
+		}
+		prev := f.losses[len(f.losses)-1]
+		f.losses = append(f.losses, l)
+		f.history = append(f.history, unscale(b, w))
+		if math.Abs(prev-l) < cfg.tolerance {
+			break
+		}
+	}
+
+	coeffs := f.history[len(f.history)-1]
+	f.bias, f.weights = coeffs[0], coeffs[1:]
+	return f, nil
+}
+
+func predict(b float64, w, x []float64) float64 {
+	y := b
+	for j, v := range x {
+		y += w[j] * v
+	}
+	return y
+}
+
+// writeFile creates the file at path and writes to it with write.
+func writeFile(path string, write func(io.Writer) error) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create %s: %v", path, err)
+	}
+	if err := write(out); err != nil {
+		out.Close()
+		return fmt.Errorf("could not write %s: %v", path, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("could not close %s: %v", path, err)
+	}
+	return nil
+}
+
 type xyer struct{ xs, ys []float64 }
 
 func (x xyer) Len() int                    { return len(x.xs) }
 func (x xyer) XY(i int) (float64, float64) { return x.xs[i], x.ys[i] }
 
-func plotData(out io.Writer, xs, ys []float64, iterations int) error {
+// plotLine plots the data points and the line y = b + w*x across the
+// range of the data, with the axes fixed to the data so that the frames
+// of the animation line up.
+func plotLine(xs, ys []float64, b, w float64, title string) (*plot.Plot, error) {
 	p, err := plot.New()
 	if err != nil {
-		return fmt.Errorf("could not create plot: %v", err)
+		return nil, fmt.Errorf("could not create plot: %v", err)
 	}
+	p.Title.Text = title
 
 	// create scatter with all data points
 	s, err := plotter.NewScatter(xyer{xs, ys})
 	if err != nil {
-		return fmt.Errorf("could not create scatter: %v", err)
+		return nil, fmt.Errorf("could not create scatter: %v", err)
 	}
 	s.GlyphStyle.Shape = draw.CrossGlyph{}
 	s.Color = color.RGBA{R: 255, A: 255}
 	p.Add(s)
 
-	x, c := linreg.LinearRegression(xs, ys, iterations, 0.01)
-
-	// create fake linear regression result
+	minX, maxX, minY, maxY := plotter.XYRange(xyer{xs, ys})
 	l, err := plotter.NewLine(plotter.XYs{
-		{3, 3*x + c}, {20, 20*x + c},
+		{X: minX, Y: b + w*minX}, {X: maxX, Y: b + w*maxX},
 	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create line: %v", err)
+	}
+	p.Add(l)
+
+	p.X.Min, p.X.Max = minX, maxX
+	p.Y.Min, p.Y.Max = minY, maxY
+	return p, nil
+}
+
+// plotLoss plots the loss after each iteration on a log scale.
+func plotLoss(out io.Writer, losses []float64) error {
+	p, err := plot.New()
+	if err != nil {
+		return fmt.Errorf("could not create plot: %v", err)
+	}
+	p.Title.Text = "Loss"
+	p.X.Label.Text = "iteration"
+	p.Y.Label.Text = "mean squared error / 2"
+	p.Y.Scale = plot.LogScale{}
+	p.Y.Tick.Marker = plot.LogTicks{}
+
+	pts := make(plotter.XYs, len(losses))
+	for i, l := range losses {
+		pts[i].X, pts[i].Y = float64(i), l
+	}
+	l, err := plotter.NewLine(pts)
 	if err != nil {
 		return fmt.Errorf("could not create line: %v", err)
 	}
 	p.Add(l)
 
+	return writePNG(out, p)
+}
+
+// animate writes a GIF of the fitted line at evenly spaced iterations,
+// ending on the final fit.
+func animate(out io.Writer, xs, ys []float64, f *fit, frames int) error {
+	if frames < 2 {
+		return errors.New("the animation needs at least two frames")
+	}
+	last := len(f.history) - 1
+	if last < 1 {
+		return errors.New("the animation needs at least one iteration")
+	}
+	if frames > last+1 {
+		frames = last + 1
+	}
+
+	anim := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		iter := i * last / (frames - 1)
+		coeffs := f.history[iter]
+		title := fmt.Sprintf("iteration %d, loss %0.3f", iter, f.losses[iter])
+		p, err := plotLine(xs, ys, coeffs[0], coeffs[1], title)
+		if err != nil {
+			return err
+		}
+
+		c := vgimg.New(4*vg.Inch, 4*vg.Inch)
+		p.Draw(draw.New(c))
+		img := c.Image()
+		frame := image.NewPaletted(img.Bounds(), palette.Plan9)
+		imagedraw.Draw(frame, frame.Rect, img, img.Bounds().Min, imagedraw.Src)
+
+		delay := 10
+		if i == frames-1 {
+			delay = 200
+		}
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, delay)
+	}
+
+	return gif.EncodeAll(out, anim)
+}
+
+func writePNG(out io.Writer, p *plot.Plot) error {
 	wt, err := p.WriterTo(256, 256, "png")
 	if err != nil {
 		return fmt.Errorf("could not create writer: %v", err)
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+)
+
+// ModelInfo includes the information about the
+// model that is output from the training.
+type ModelInfo struct {
+	Intercept    float64           `json:"intercept"`
+	Coefficients []CoefficientInfo `json:"coefficients"`
+	Penalty      *PenaltyInfo      `json:"penalty,omitempty"`
+}
+
+// CoefficientInfo include information about a
+// particular model coefficient.
+type CoefficientInfo struct {
+	Name        string  `json:"name"`
+	Coefficient float64 `json:"coefficient"`
+}
+
+// PenaltyInfo includes the penalty of a regularized model
+// and how it was chosen.
+type PenaltyInfo struct {
+	Method    string  `json:"method"`
+	Alpha     float64 `json:"alpha"`
+	Lambda    float64 `json:"lambda"`
+	LambdaMin float64 `json:"lambda_min"`
+	Rule      string  `json:"rule"`
+	CVMSE     float64 `json:"cv_mse"`
+	Folds     int     `json:"folds"`
+}
+
+// Path includes the fitted intercept and coefficients, on the original
+// scale of the features, at each lambda of a regularization path.
+type Path struct {
+	Lambdas      []float64
+	Intercepts   []float64
+	Coefficients [][]float64
+}
+
+// CVResult includes the cross validated mean squared error at each lambda
+// of a path, with the index of the lambda minimizing it and the index of
+// the largest lambda within one standard error of that minimum.
+type CVResult struct {
+	MSE    []float64
+	StdErr []float64
+	Min    int
+	OneSE  int
+}
+
+const (
+	// maxIter is the maximum number of coordinate descent sweeps.
+	maxIter = 10000
+
+	// tolerance is the largest coefficient change, on the standardized
+	// scale, at which coordinate descent has converged.
+	tolerance = 1e-7
+
+	// lambdaRatio is the ratio of the smallest to the largest lambda.
+	lambdaRatio = 1e-3
+)
+
+func main() {
+
+	// Declare the data flags.
+	inPtr := flag.String("in", "training.csv", "The training data")
+	targetPtr := flag.String("target", "Sales", "The column to model, with every other column used as a feature")
+
+	// Declare the model flags.
+	methodPtr := flag.String("method", "lasso", "The penalty: ridge, lasso or elasticnet")
+	alphaPtr := flag.Float64("alpha", 0.5, "The mix of the L1 penalty in the elastic net, between 0 and 1")
+	nLambdaPtr := flag.Int("nlambda", 100, "The number of lambdas on the path")
+	foldsPtr := flag.Int("folds", 10, "The number of cross validation folds")
+	seedPtr := flag.Int64("seed", 42, "The seed for assigning the folds")
+	outPtr := flag.String("out", "model.json", "The output file for the model")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// The methods differ only in the mix of L1 and L2 penalties.
+	var alpha float64
+	switch *methodPtr {
+	case "ridge":
+		alpha = 0
+	case "lasso":
+		alpha = 1
+	case "elasticnet":
+		alpha = *alphaPtr
+		if alpha < 0 || alpha > 1 {
+			log.Fatal("alpha must be between 0 and 1")
+		}
+	default:
+		log.Fatalf("Unknown method %s", *methodPtr)
+	}
+
+	// Read in the training data.
+	names, x, y, err := readData(*inPtr, *targetPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Calculate the regularization path on all of the data.
+	lambdas, err := LambdaGrid(x, y, alpha, *nLambdaPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	path, err := FitPath(x, y, alpha, lambdas)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Choose lambda with k-fold cross validation and the 1-SE rule.
+	cv, err := CrossValidatePath(x, y, alpha, lambdas, *foldsPtr, *seedPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	best := cv.OneSE
+	modelInfo := ModelInfo{
+		Intercept: path.Intercepts[best],
+		Penalty: &PenaltyInfo{
+			Method:    *methodPtr,
+			Alpha:     alpha,
+			Lambda:    lambdas[best],
+			LambdaMin: lambdas[cv.Min],
+			Rule:      "1se",
+			CVMSE:     cv.MSE[best],
+			Folds:     *foldsPtr,
+		},
+	}
+	for j, name := range names {
+		modelInfo.Coefficients = append(modelInfo.Coefficients, CoefficientInfo{
+			Name:        name,
+			Coefficient: path.Coefficients[best][j],
+		})
+	}
+
+	// Output the chosen model to standard out.
+	fmt.Printf("\n%s (alpha = %0.2f), %d-fold CV over %d lambdas\n\n", *methodPtr, alpha, *foldsPtr, len(lambdas))
+	fmt.Printf("lambda.min = %0.6g (CV MSE %0.4f +/- %0.4f)\n", lambdas[cv.Min], cv.MSE[cv.Min], cv.StdErr[cv.Min])
+	fmt.Printf("lambda.1se = %0.6g (CV MSE %0.4f +/- %0.4f)\n\n", lambdas[best], cv.MSE[best], cv.StdErr[best])
+	fmt.Printf("%-12s %12s %12s\n", "", "lambda.min", "lambda.1se")
+	fmt.Printf("%-12s %12.4f %12.4f\n", "intercept", path.Intercepts[cv.Min], path.Intercepts[best])
+	for j, name := range names {
+		fmt.Printf("%-12s %12.4f %12.4f\n", name, path.Coefficients[cv.Min][j], path.Coefficients[best][j])
+	}
+	fmt.Println()
+
+	// Save the model.
+	outputData, err := json.MarshalIndent(modelInfo, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(*outPtr, outputData, 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	// Save the path and cross validation plots.
+	if err := plotPath(names, path, x, lambdas[cv.Min], lambdas[best], "path.png"); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := plotCV(lambdas, cv, "cv.png"); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// standardized holds features scaled to zero mean and unit variance
+// along with the centered observations.
+type standardized struct {
+	x     [][]float64
+	y     []float64
+	means []float64
+	sds   []float64
+	yMean float64
+}
+
+// standardize centers and scales each feature, and centers y.
+func standardize(x [][]float64, y []float64) (standardized, error) {
+
+	n, p := len(x), len(x[0])
+	s := standardized{
+		x:     make([][]float64, n),
+		y:     make([]float64, n),
+		means: make([]float64, p),
+		sds:   make([]float64, p),
+		yMean: stat.Mean(y, nil),
+	}
+
+	col := make([]float64, n)
+	for j := 0; j < p; j++ {
+		for i := range x {
+			col[i] = x[i][j]
+		}
+		mean, variance := stat.MeanVariance(col, nil)
+		s.means[j] = mean
+		s.sds[j] = math.Sqrt(variance * float64(n-1) / float64(n))
+		if s.sds[j] == 0 {
+			return standardized{}, fmt.Errorf("feature %d is constant", j)
+		}
+	}
+
+	for i := range x {
+		s.x[i] = make([]float64, p)
+		for j, v := range x[i] {
+			s.x[i][j] = (v - s.means[j]) / s.sds[j]
+		}
+		s.y[i] = y[i] - s.yMean
+	}
+
+	return s, nil
+}
+
+// LambdaGrid returns n lambdas decreasing on a log scale from the smallest
+// lambda at which all of the coefficients are zero. For ridge, where no
+// lambda zeroes the coefficients, the grid starts from the value for
+// alpha = 0.001 as in glmnet.
+func LambdaGrid(x [][]float64, y []float64, alpha float64, n int) ([]float64, error) {
+
+	if n < 2 {
+		return nil, errors.New("at least two lambdas are required")
+	}
+
+	s, err := standardize(x, y)
+	if err != nil {
+		return nil, err
+	}
+
+	var maxDot float64
+	for j := range s.means {
+		var dot float64
+		for i, row := range s.x {
+			dot += row[j] * s.y[i]
+		}
+		maxDot = math.Max(maxDot, math.Abs(dot)/float64(len(s.y)))
+	}
+
+	// Ridge's grid starts higher, so it also extends further down
+	// to reach the lightly penalized fits.
+	lambdaMax := maxDot / math.Max(alpha, 1e-3)
+	ratio := lambdaRatio
+	if alpha < 1e-3 {
+		ratio *= 1e-3
+	}
+
+	lambdas := make([]float64, n)
+	for k := range lambdas {
+		lambdas[k] = lambdaMax * math.Pow(ratio, float64(k)/float64(n-1))
+	}
+
+	return lambdas, nil
+}
+
+// FitPath fits the elastic net
+//
+//	min 1/(2n) Σ (yᵢ - β₀ - xᵢβ)² + λ [ (1-α)/2 ‖β‖² + α ‖β‖₁ ]
+//
+// at each lambda by coordinate descent on the standardized features,
+// starting each fit from the previous one. The intercept is not
+// penalized. Alpha = 1 is the lasso and alpha = 0 is ridge.
+func FitPath(x [][]float64, y []float64, alpha float64, lambdas []float64) (Path, error) {
+
+	if len(x) == 0 || len(x) != len(y) {
+		return Path{}, errors.New("there must be one observation per row of features")
+	}
+
+	s, err := standardize(x, y)
+	if err != nil {
+		return Path{}, err
+	}
+
+	n, p := len(s.x), len(s.means)
+	beta := make([]float64, p)
+	resid := make([]float64, n)
+	copy(resid, s.y)
+
+	path := Path{Lambdas: lambdas}
+	for _, lambda := range lambdas {
+		l1 := lambda * alpha
+		l2 := lambda * (1 - alpha)
+
+		for iter := 0; iter < maxIter; iter++ {
+			var maxChange float64
+			for j := 0; j < p; j++ {
+
+				// With unit variance features, the partial residual
+				// correlation is the mean of xⱼ r plus the current βⱼ.
+				var z float64
+				for i, row := range s.x {
+					z += row[j] * resid[i]
+				}
+				z = z/float64(n) + beta[j]
+
+				updated := softThreshold(z, l1) / (1 + l2)
+				if change := updated - beta[j]; change != 0 {
+					for i, row := range s.x {
+						resid[i] -= row[j] * change
+					}
+					beta[j] = updated
+					maxChange = math.Max(maxChange, math.Abs(change))
+				}
+			}
+			if maxChange < tolerance {
+				break
+			}
+		}
+
+		// Transform the coefficients back to the original scale.
+		coeffs := make([]float64, p)
+		intercept := s.yMean
+		for j := range coeffs {
+			coeffs[j] = beta[j] / s.sds[j]
+			intercept -= coeffs[j] * s.means[j]
+		}
+		path.Intercepts = append(path.Intercepts, intercept)
+		path.Coefficients = append(path.Coefficients, coeffs)
+	}
+
+	return path, nil
+}
+
+// softThreshold shrinks z towards zero by gamma.
+func softThreshold(z, gamma float64) float64 {
+	switch {
+	case z > gamma:
+		return z - gamma
+	case z < -gamma:
+		return z + gamma
+	}
+	return 0
+}
+
+// CrossValidatePath fits the path on the training rows of each of k folds
+// and calculates the mean squared error of each lambda on the test rows.
+func CrossValidatePath(x [][]float64, y []float64, alpha float64, lambdas []float64, k int, seed int64) (CVResult, error) {
+
+	n := len(y)
+	if k < 2 || k > n {
+		return CVResult{}, fmt.Errorf("cannot make %d folds from %d rows", k, n)
+	}
+
+	// Assign the rows to folds.
+	fold := make([]int, n)
+	for i, idx := range rand.New(rand.NewSource(seed)).Perm(n) {
+		fold[idx] = i % k
+	}
+
+	foldMSE := make([][]float64, len(lambdas))
+	for f := 0; f < k; f++ {
+
+		var trainX, testX [][]float64
+		var trainY, testY []float64
+		for i := range y {
+			if fold[i] == f {
+				testX = append(testX, x[i])
+				testY = append(testY, y[i])
+			} else {
+				trainX = append(trainX, x[i])
+				trainY = append(trainY, y[i])
+			}
+		}
+
+		path, err := FitPath(trainX, trainY, alpha, lambdas)
+		if err != nil {
+			return CVResult{}, err
+		}
+
+		for l := range lambdas {
+			var mse float64
+			for i, row := range testX {
+				pred := path.Intercepts[l]
+				for j, v := range row {
+					pred += path.Coefficients[l][j] * v
+				}
+				mse += (testY[i] - pred) * (testY[i] - pred)
+			}
+			foldMSE[l] = append(foldMSE[l], mse/float64(len(testY)))
+		}
+	}
+
+	res := CVResult{
+		MSE:    make([]float64, len(lambdas)),
+		StdErr: make([]float64, len(lambdas)),
+	}
+	for l := range lambdas {
+		res.MSE[l] = stat.Mean(foldMSE[l], nil)
+		res.StdErr[l] = stat.StdDev(foldMSE[l], nil) / math.Sqrt(float64(k))
+		if res.MSE[l] < res.MSE[res.Min] {
+			res.Min = l
+		}
+	}
+
+	// The lambdas decrease, so the first within one standard
+	// error of the minimum is the largest.
+	limit := res.MSE[res.Min] + res.StdErr[res.Min]
+	for l := range lambdas {
+		if res.MSE[l] <= limit {
+			res.OneSE = l
+			break
+		}
+	}
+
+	return res, nil
+}
+
+// plotPath saves a plot of the standardized coefficients against
+// log10(lambda), marking the lambdas chosen by cross validation.
+func plotPath(names []string, path Path, x [][]float64, lambdaMin, lambda1SE float64, file string) error {
+
+	s, err := standardize(x, make([]float64, len(x)))
+	if err != nil {
+		return err
+	}
+
+	p, err := plot.New()
+	if err != nil {
+		return err
+	}
+	p.Title.Text = "Regularization path"
+	p.X.Label.Text = "log10(lambda)"
+	p.Y.Label.Text = "Standardized coefficient"
+	p.Add(plotter.NewGrid())
+
+	var lo, hi float64
+	for j, name := range names {
+		pts := make(plotter.XYs, len(path.Lambdas))
+		for l, lambda := range path.Lambdas {
+			pts[l].X = math.Log10(lambda)
+			pts[l].Y = path.Coefficients[l][j] * s.sds[j]
+			lo = math.Min(lo, pts[l].Y)
+			hi = math.Max(hi, pts[l].Y)
+		}
+
+		line, err := plotter.NewLine(pts)
+		if err != nil {
+			return err
+		}
+		line.LineStyle.Color = plotutil.Color(j)
+		line.LineStyle.Dashes = plotutil.Dashes(j / len(plotutil.DefaultColors))
+		line.LineStyle.Width = vg.Points(1.5)
+		p.Add(line)
+		p.Legend.Add(name, line)
+	}
+
+	// Mark the chosen lambdas.
+	for _, lambda := range []float64{lambdaMin, lambda1SE} {
+		mark, err := plotter.NewLine(plotter.XYs{{X: math.Log10(lambda), Y: lo}, {X: math.Log10(lambda), Y: hi}})
+		if err != nil {
+			return err
+		}
+		mark.Dashes = []vg.Length{vg.Points(4), vg.Points(4)}
+		p.Add(mark)
+	}
+
+	return p.Save(6*vg.Inch, 4*vg.Inch, file)
+}
+
+// plotCV saves a plot of the cross validated mean squared error, plus
+// and minus one standard error, against log10(lambda).
+func plotCV(lambdas []float64, cv CVResult, file string) error {
+
+	p, err := plot.New()
+	if err != nil {
+		return err
+	}
+	p.Title.Text = "Cross validation"
+	p.X.Label.Text = "log10(lambda)"
+	p.Y.Label.Text = "Mean squared error"
+	p.Add(plotter.NewGrid())
+
+	for _, offset := range []float64{0, -1, 1} {
+		pts := make(plotter.XYs, len(lambdas))
+		for l, lambda := range lambdas {
+			pts[l].X = math.Log10(lambda)
+			pts[l].Y = cv.MSE[l] + offset*cv.StdErr[l]
+		}
+
+		line, err := plotter.NewLine(pts)
+		if err != nil {
+			return err
+		}
+		if offset != 0 {
+			line.Dashes = []vg.Length{vg.Points(4), vg.Points(4)}
+		} else {
+			line.LineStyle.Width = vg.Points(1.5)
+		}
+		p.Add(line)
+	}
+
+	return p.Save(6*vg.Inch, 4*vg.Inch, file)
+}
+
+// readData reads a CSV file with a header, returning the feature names,
+// the features and the target column.
+func readData(path, target string) ([]string, [][]float64, []float64, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(records) < 2 {
+		return nil, nil, nil, errors.New("expected a header and at least one row")
+	}
+
+	targetCol := -1
+	var names []string
+	for j, h := range records[0] {
+		if h == target {
+			targetCol = j
+		} else {
+			names = append(names, h)
+		}
+	}
+	if targetCol < 0 {
+		return nil, nil, nil, fmt.Errorf("target column %s not found", target)
+	}
+
+	var x [][]float64
+	var y []float64
+	for i, record := range records[1:] {
+		row := make([]float64, 0, len(names))
+		for j, raw := range record {
+			val, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+			}
+			if j == targetCol {
+				y = append(y, val)
+			} else {
+				row = append(row, val)
+			}
+		}
+		x = append(x, row)
+	}
+
+	return names, x, y, nil
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sajari/regression"
+	"gonum.org/v1/gonum/stat"
+)
+
+// ModelInfo includes the information about the
+// model that is output from the training.
+type ModelInfo struct {
+	Intercept    float64           `json:"intercept"`
+	Coefficients []CoefficientInfo `json:"coefficients"`
+	Expansion    *Expansion        `json:"expansion,omitempty"`
+}
+
+// CoefficientInfo include information about a
+// particular model coefficient.
+type CoefficientInfo struct {
+	Name        string  `json:"name"`
+	Coefficient float64 `json:"coefficient"`
+}
+
+// Expansion describes how the raw inputs are expanded into the
+// features of the model. Each input gets polynomial terms up to
+// Degree, unless it has a natural cubic spline basis, and
+// Interactions ("none", "pairwise" or "all") adds the products
+// of the raw inputs.
+type Expansion struct {
+	Inputs       []string     `json:"inputs"`
+	Degree       int          `json:"degree"`
+	Interactions string       `json:"interactions"`
+	Splines      []SplineInfo `json:"splines,omitempty"`
+}
+
+// SplineInfo includes the knots of the natural cubic
+// spline basis of an input.
+type SplineInfo struct {
+	Input string    `json:"input"`
+	Knots []float64 `json:"knots"`
+}
+
+func main() {
+
+	// Declare the data flags.
+	trainPtr := flag.String("train", "training.csv", "The training data")
+	testPtr := flag.String("test", "test.csv", "The test data")
+	targetPtr := flag.String("target", "Sales", "The column to model, with every other column used as an input")
+
+	// Declare the expansion flags.
+	degreePtr := flag.Int("degree", 2, "The degree of the polynomial terms of each input")
+	interactionsPtr := flag.String("interactions", "pairwise", "The interaction terms: none, pairwise or all")
+	splinesPtr := flag.String("splines", "", "Natural cubic splines as input:k for k quantile knots or input=k1,k2,... for given knots, separated by ;")
+	outPtr := flag.String("out", "model.json", "The output file for the model")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Read in the training data.
+	inputs, rawTrain, yTrain, err := readData(*trainPtr, *targetPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Set up the expansion.
+	expansion := &Expansion{
+		Inputs:       inputs,
+		Degree:       *degreePtr,
+		Interactions: *interactionsPtr,
+	}
+	if expansion.Splines, err = parseSplines(*splinesPtr, rawTrain); err != nil {
+		log.Fatal(err)
+	}
+
+	// Expand the training data.
+	names, xTrain, err := expandAll(expansion, rawTrain)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create the regression value with one variable
+	// per expanded feature.
+	var r regression.Regression
+	r.SetObserved(*targetPtr)
+	for j, name := range names {
+		r.SetVar(j, name)
+	}
+
+	for i, row := range xTrain {
+		r.Train(regression.DataPoint(yTrain[i], row))
+	}
+
+	// Train/fit the regression model.
+	if err := r.Run(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Fill in the model information, saving the expansion
+	// so that it can be applied at prediction time.
+	modelInfo := ModelInfo{
+		Intercept: r.Coeff(0),
+		Expansion: expansion,
+	}
+	for j, name := range names {
+		modelInfo.Coefficients = append(modelInfo.Coefficients, CoefficientInfo{
+			Name:        name,
+			Coefficient: r.Coeff(j + 1),
+		})
+	}
+
+	// Evaluate the model on the test data.
+	_, rawTest, yTest, err := readData(*testPtr, *targetPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var mAE float64
+	for i, raw := range rawTest {
+		_, row, err := Expand(expansion, raw)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		yPredicted, err := r.Predict(row)
+		if err != nil {
+			log.Fatal(err)
+		}
+		mAE += math.Abs(yTest[i]-yPredicted) / float64(len(rawTest))
+	}
+
+	// Output the results to standard out.
+	fmt.Printf("\nRegression Formula:\n%v\n\n", r.Formula)
+	fmt.Printf("%d expanded features: %s\n", len(names), strings.Join(names, ", "))
+	fmt.Printf("R^2 = %0.4f\n", r.R2)
+	fmt.Printf("Test MAE = %0.2f\n\n", mAE)
+
+	// Save the model.
+	outputData, err := json.MarshalIndent(modelInfo, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(*outPtr, outputData, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Expand generates the names and values of the expanded features from
+// the raw input values. The features are the polynomial or spline terms
+// of each input in turn, followed by the interaction terms.
+func Expand(e *Expansion, raw map[string]float64) ([]string, []float64, error) {
+
+	if e.Degree < 1 {
+		return nil, nil, errors.New("the degree must be at least 1")
+	}
+
+	knots := make(map[string][]float64)
+	for _, s := range e.Splines {
+		knots[s.Input] = s.Knots
+	}
+
+	var names []string
+	var values []float64
+	xs := make([]float64, len(e.Inputs))
+	for i, input := range e.Inputs {
+		x, ok := raw[input]
+		if !ok {
+			return nil, nil, fmt.Errorf("expected a value for input %s", input)
+		}
+		xs[i] = x
+
+		// Add the spline basis, which is linear in x beyond the
+		// boundary knots.
+		if k, ok := knots[input]; ok {
+			basis, err := naturalSpline(x, k)
+			if err != nil {
+				return nil, nil, fmt.Errorf("spline for %s: %v", input, err)
+			}
+			names = append(names, input)
+			values = append(values, x)
+			for b, v := range basis {
+				names = append(names, fmt.Sprintf("ns(%s,%d)", input, b+1))
+				values = append(values, v)
+			}
+			continue
+		}
+
+		// Add the polynomial terms.
+		for d := 1; d <= e.Degree; d++ {
+			name := input
+			if d > 1 {
+				name = fmt.Sprintf("%s^%d", input, d)
+			}
+			names = append(names, name)
+			values = append(values, math.Pow(x, float64(d)))
+		}
+	}
+
+	// Add the products of each pair, or of each subset of two or
+	// more, of the raw inputs.
+	var maxOrder int
+	switch e.Interactions {
+	case "", "none":
+	case "pairwise":
+		maxOrder = 2
+	case "all":
+		maxOrder = len(e.Inputs)
+	default:
+		return nil, nil, fmt.Errorf("unknown interactions %s", e.Interactions)
+	}
+
+	for order := 2; order <= maxOrder; order++ {
+		for _, subset := range combinations(len(e.Inputs), order) {
+			product := 1.0
+			parts := make([]string, len(subset))
+			for p, i := range subset {
+				product *= xs[i]
+				parts[p] = e.Inputs[i]
+			}
+			names = append(names, strings.Join(parts, "*"))
+			values = append(values, product)
+		}
+	}
+
+	return names, values, nil
+}
+
+// naturalSpline returns the nonlinear terms of the natural cubic spline
+// basis with the given knots, which together with x itself span the
+// cubic splines that are linear beyond the boundary knots:
+//
+//	d_k(x) = ((x-ξ_k)³₊ - (x-ξ_K)³₊) / (ξ_K - ξ_k)
+//	N_k(x) = d_k(x) - d_{K-1}(x),  k = 1, ..., K-2
+func naturalSpline(x float64, knots []float64) ([]float64, error) {
+
+	n := len(knots)
+	if n < 3 {
+		return nil, errors.New("at least three knots are required")
+	}
+	for k := 1; k < n; k++ {
+		if knots[k] <= knots[k-1] {
+			return nil, errors.New("knots must be strictly increasing")
+		}
+	}
+
+	cube := func(v float64) float64 {
+		if v <= 0 {
+			return 0
+		}
+		return v * v * v
+	}
+	d := func(k int) float64 {
+		return (cube(x-knots[k]) - cube(x-knots[n-1])) / (knots[n-1] - knots[k])
+	}
+
+	basis := make([]float64, n-2)
+	last := d(n - 2)
+	for k := range basis {
+		basis[k] = d(k) - last
+	}
+
+	return basis, nil
+}
+
+// combinations returns the subsets of the given size of the
+// indices 0 to n-1, in lexicographic order.
+func combinations(n, size int) [][]int {
+
+	var out [][]int
+	subset := make([]int, size)
+	var build func(start, pos int)
+	build = func(start, pos int) {
+		if pos == size {
+			out = append(out, append([]int(nil), subset...))
+			return
+		}
+		for i := start; i < n; i++ {
+			subset[pos] = i
+			build(i+1, pos+1)
+		}
+	}
+	build(0, 0)
+
+	return out
+}
+
+// expandAll expands each row of raw inputs.
+func expandAll(e *Expansion, raw []map[string]float64) ([]string, [][]float64, error) {
+
+	var names []string
+	rows := make([][]float64, len(raw))
+	for i, r := range raw {
+		var err error
+		names, rows[i], err = Expand(e, r)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return names, rows, nil
+}
+
+// parseSplines parses the splines flag. Inputs given a number of knots
+// get knots at evenly spaced quantiles of the training data, from the
+// minimum to the maximum.
+func parseSplines(spec string, raw []map[string]float64) ([]SplineInfo, error) {
+
+	var splines []SplineInfo
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		// Parse the given knots.
+		if i := strings.Index(part, "="); i > 0 {
+			s := SplineInfo{Input: part[:i]}
+			for _, v := range strings.Split(part[i+1:], ",") {
+				knot, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid knot in %s", part)
+				}
+				s.Knots = append(s.Knots, knot)
+			}
+			splines = append(splines, s)
+			continue
+		}
+
+		// Place the number of knots at quantiles.
+		i := strings.Index(part, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid spline %s", part)
+		}
+		input := part[:i]
+		count, err := strconv.Atoi(part[i+1:])
+		if err != nil || count < 3 {
+			return nil, fmt.Errorf("spline %s needs at least three knots", input)
+		}
+
+		values := make([]float64, len(raw))
+		for r, row := range raw {
+			v, ok := row[input]
+			if !ok {
+				return nil, fmt.Errorf("input %s not found", input)
+			}
+			values[r] = v
+		}
+		sort.Float64s(values)
+
+		s := SplineInfo{Input: input}
+		for k := 0; k < count; k++ {
+			s.Knots = append(s.Knots, stat.Quantile(float64(k)/float64(count-1), stat.LinInterp, values, nil))
+		}
+		splines = append(splines, s)
+	}
+
+	return splines, nil
+}
+
+// readData reads a CSV file with a header, returning the input names,
+// the raw input values of each row and the target column.
+func readData(path, target string) ([]string, []map[string]float64, []float64, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(records) < 2 {
+		return nil, nil, nil, errors.New("expected a header and at least one row")
+	}
+
+	header := records[0]
+	var inputs []string
+	found := false
+	for _, h := range header {
+		if h == target {
+			found = true
+		} else {
+			inputs = append(inputs, h)
+		}
+	}
+	if !found {
+		return nil, nil, nil, fmt.Errorf("target column %s not found", target)
+	}
+
+	var raw []map[string]float64
+	var y []float64
+	for i, record := range records[1:] {
+		row := make(map[string]float64)
+		for j, v := range record {
+			val, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+			}
+			if header[j] == target {
+				y = append(y, val)
+			} else {
+				row[header[j]] = val
+			}
+		}
+		raw = append(raw, row)
+	}
+
+	return inputs, raw, y, nil
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// ModelInfo includes the information about the model that is
+// output from the training, in the format read by the predictor
+// in Chapter 10. The intercept and coefficients are those of the
+// quantile closest to the median, and Quantiles holds the model of
+// each quantile. When Rearrange is set, the predictions of the
+// quantiles are sorted so that they cannot cross.
+type ModelInfo struct {
+	Intercept    float64           `json:"intercept"`
+	Coefficients []CoefficientInfo `json:"coefficients"`
+	Quantiles    []QuantileInfo    `json:"quantiles"`
+	Rearrange    bool              `json:"rearrange"`
+}
+
+// QuantileInfo includes the model of a single quantile
+// along with its pinball loss on the training data.
+type QuantileInfo struct {
+	Quantile     float64           `json:"quantile"`
+	Intercept    float64           `json:"intercept"`
+	Coefficients []CoefficientInfo `json:"coefficients"`
+	PinballLoss  float64           `json:"pinball_loss"`
+}
+
+// CoefficientInfo include information about a
+// particular model coefficient.
+type CoefficientInfo struct {
+	Name        string  `json:"name"`
+	Coefficient float64 `json:"coefficient"`
+}
+
+func main() {
+
+	// Declare the data flags.
+	trainPtr := flag.String("train", "training.csv", "The training data")
+	testPtr := flag.String("test", "test.csv", "The test data, or empty to skip the evaluation")
+	targetPtr := flag.String("target", "Sales", "The column to model")
+	featuresPtr := flag.String("features", "", "Comma separated feature columns, or empty for every column except the target")
+
+	// Declare the model flags.
+	quantilesPtr := flag.String("quantiles", "0.1,0.5,0.9", "Comma separated quantiles to fit")
+	maxIterPtr := flag.Int("maxIter", 500, "The maximum number of reweighting iterations")
+	tolPtr := flag.Float64("tol", 1e-10, "The smallest relative decrease of the pinball loss before stopping")
+	outPtr := flag.String("out", "model.json", "The output file for the model")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	quantiles, err := parseQuantiles(*quantilesPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Read in the training data.
+	features, xTrain, yTrain, err := readData(*trainPtr, *targetPtr, *featuresPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Fit each of the quantiles.
+	model := ModelInfo{Rearrange: true}
+	coeffs := make([][]float64, len(quantiles))
+	for q, tau := range quantiles {
+		if coeffs[q], err = FitQuantile(xTrain, yTrain, tau, *maxIterPtr, *tolPtr); err != nil {
+			log.Fatal(err)
+		}
+
+		info := QuantileInfo{
+			Quantile:  tau,
+			Intercept: coeffs[q][0],
+		}
+		for j, name := range features {
+			info.Coefficients = append(info.Coefficients, CoefficientInfo{
+				Name:        name,
+				Coefficient: coeffs[q][j+1],
+			})
+		}
+		model.Quantiles = append(model.Quantiles, info)
+	}
+
+	// Evaluate the quantiles on the training data, counting the
+	// rows where the separately fitted quantiles cross.
+	trainLoss, trainCoverage, crossings := evaluate(coeffs, quantiles, xTrain, yTrain)
+	for q := range model.Quantiles {
+		model.Quantiles[q].PinballLoss = trainLoss[q]
+	}
+
+	// Output the results to standard out.
+	fmt.Println()
+	for q, info := range model.Quantiles {
+		formula := fmt.Sprintf("Q%g(%s) = %0.4f", info.Quantile, *targetPtr, info.Intercept)
+		for _, coeff := range info.Coefficients {
+			formula += fmt.Sprintf(" + %s*%0.4f", coeff.Name, coeff.Coefficient)
+		}
+		fmt.Println(formula)
+		fmt.Printf("    training pinball loss = %0.4f, coverage = %0.3f\n", trainLoss[q], trainCoverage[q])
+	}
+	fmt.Printf("\n%d of %d training rows had crossing quantiles before rearrangement\n", crossings, len(yTrain))
+
+	// Evaluate the quantiles on the test data.
+	if *testPtr != "" {
+		_, xTest, yTest, err := readData(*testPtr, *targetPtr, strings.Join(features, ","))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		testLoss, testCoverage, _ := evaluate(coeffs, quantiles, xTest, yTest)
+		fmt.Println("\nTest evaluation:")
+		for q, tau := range quantiles {
+			fmt.Printf("    Q%g: pinball loss = %0.4f, coverage = %0.3f\n", tau, testLoss[q], testCoverage[q])
+		}
+	}
+	fmt.Println()
+
+	// Save the model, with the quantile closest to the
+	// median as its point prediction.
+	median := 0
+	for q, tau := range quantiles {
+		if math.Abs(tau-0.5) < math.Abs(quantiles[median]-0.5) {
+			median = q
+		}
+	}
+	model.Intercept = model.Quantiles[median].Intercept
+	model.Coefficients = model.Quantiles[median].Coefficients
+
+	outputData, err := json.MarshalIndent(model, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(*outPtr, outputData, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// FitQuantile fits the linear model of quantile tau by iteratively
+// reweighted least squares. The pinball loss of each residual r equals
+// a weighted squared residual w·r² with w = tau/|r| for r > 0 and
+// (1-tau)/|r| otherwise, so each iteration solves the weighted least
+// squares problem with the weights of the previous residuals. The first
+// returned coefficient is the intercept.
+func FitQuantile(x [][]float64, y []float64, tau float64, maxIter int, tol float64) ([]float64, error) {
+
+	if tau <= 0 || tau >= 1 {
+		return nil, errors.New("quantiles must be between 0 and 1")
+	}
+
+	// Start from the least squares fit.
+	weights := make([]float64, len(y))
+	for i := range weights {
+		weights[i] = 1
+	}
+	coeffs, err := weightedLeastSquares(x, y, weights)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the weights of tiny residuals bounded, relative
+	// to the spread of the target.
+	var spread float64
+	for _, v := range y {
+		spread = math.Max(spread, math.Abs(v))
+	}
+	eps := 1e-6 * math.Max(spread, 1)
+
+	best := coeffs
+	bestLoss := pinballLoss(coeffs, x, y, tau)
+	for iter := 0; iter < maxIter; iter++ {
+
+		// Compute the weights from the residuals.
+		for i, row := range x {
+			r := y[i] - predict(coeffs, row)
+			w := tau
+			if r < 0 {
+				w = 1 - tau
+			}
+			weights[i] = w / math.Max(math.Abs(r), eps)
+		}
+
+		if coeffs, err = weightedLeastSquares(x, y, weights); err != nil {
+			return nil, err
+		}
+
+		// Stop once the loss no longer improves.
+		loss := pinballLoss(coeffs, x, y, tau)
+		improvement := bestLoss - loss
+		if loss < bestLoss {
+			best, bestLoss = coeffs, loss
+		}
+		if improvement <= tol*bestLoss {
+			break
+		}
+	}
+
+	return best, nil
+}
+
+// PredictQuantiles predicts each quantile for a row. The separately
+// fitted quantiles can cross, so the predictions are rearranged into
+// increasing order to keep them monotone in the quantile.
+func PredictQuantiles(coeffs [][]float64, row []float64) []float64 {
+
+	predictions := make([]float64, len(coeffs))
+	for q, c := range coeffs {
+		predictions[q] = predict(c, row)
+	}
+	sort.Float64s(predictions)
+
+	return predictions
+}
+
+// evaluate calculates the mean pinball loss and the fraction of rows
+// at or below the rearranged prediction of each quantile, along with
+// the number of rows whose raw predictions crossed.
+func evaluate(coeffs [][]float64, quantiles []float64, x [][]float64, y []float64) ([]float64, []float64, int) {
+
+	loss := make([]float64, len(quantiles))
+	coverage := make([]float64, len(quantiles))
+	var crossings int
+	for i, row := range x {
+		for q := 1; q < len(coeffs); q++ {
+			if predict(coeffs[q], row) < predict(coeffs[q-1], row) {
+				crossings++
+				break
+			}
+		}
+
+		for q, pred := range PredictQuantiles(coeffs, row) {
+			loss[q] += pinball(y[i]-pred, quantiles[q]) / float64(len(y))
+			if y[i] <= pred {
+				coverage[q] += 1 / float64(len(y))
+			}
+		}
+	}
+
+	return loss, coverage, crossings
+}
+
+// pinball returns the pinball loss of a residual for quantile tau.
+func pinball(r, tau float64) float64 {
+	if r >= 0 {
+		return tau * r
+	}
+	return (tau - 1) * r
+}
+
+// pinballLoss returns the total pinball loss of the coefficients.
+func pinballLoss(coeffs []float64, x [][]float64, y []float64, tau float64) float64 {
+	var loss float64
+	for i, row := range x {
+		loss += pinball(y[i]-predict(coeffs, row), tau)
+	}
+	return loss
+}
+
+// weightedLeastSquares solves the weighted least squares problem, with
+// an intercept, using a QR decomposition of the weighted design matrix.
+func weightedLeastSquares(x [][]float64, y, weights []float64) ([]float64, error) {
+
+	n := len(x)
+	if n == 0 {
+		return nil, errors.New("no rows to fit")
+	}
+	p := len(x[0]) + 1
+
+	design := mat.NewDense(n, p, nil)
+	target := mat.NewVecDense(n, nil)
+	for i, row := range x {
+		s := math.Sqrt(weights[i])
+		design.Set(i, 0, s)
+		for j, v := range row {
+			design.Set(i, j+1, s*v)
+		}
+		target.SetVec(i, s*y[i])
+	}
+
+	var qr mat.QR
+	qr.Factorize(design)
+
+	var coeffs mat.VecDense
+	if err := qr.SolveVecTo(&coeffs, false, target); err != nil {
+		return nil, err
+	}
+
+	return mat.Col(nil, 0, &coeffs), nil
+}
+
+// predict returns the prediction of the coefficients for a row.
+func predict(coeffs, row []float64) float64 {
+	prediction := coeffs[0]
+	for j, v := range row {
+		prediction += coeffs[j+1] * v
+	}
+	return prediction
+}
+
+// parseQuantiles parses the quantiles flag into increasing order.
+func parseQuantiles(spec string) ([]float64, error) {
+
+	var quantiles []float64
+	for _, v := range strings.Split(spec, ",") {
+		tau, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || tau <= 0 || tau >= 1 {
+			return nil, fmt.Errorf("invalid quantile %s", v)
+		}
+		quantiles = append(quantiles, tau)
+	}
+	sort.Float64s(quantiles)
+
+	for q := 1; q < len(quantiles); q++ {
+		if quantiles[q] == quantiles[q-1] {
+			return nil, fmt.Errorf("quantile %g is repeated", quantiles[q])
+		}
+	}
+
+	return quantiles, nil
+}
+
+// readData reads the feature and target columns of a CSV file with a header.
+func readData(path, target, featureSpec string) ([]string, [][]float64, []float64, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(records) < 2 {
+		return nil, nil, nil, errors.New("expected a header and at least one row")
+	}
+	header := records[0]
+
+	// Work out the feature columns.
+	var features []string
+	for _, name := range strings.Split(featureSpec, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			features = append(features, name)
+		}
+	}
+	if len(features) == 0 {
+		for _, name := range header {
+			if name != target {
+				features = append(features, name)
+			}
+		}
+	}
+
+	index := make(map[string]int)
+	for i, name := range header {
+		index[name] = i
+	}
+	targetCol, ok := index[target]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("target column %s not found", target)
+	}
+	cols := make([]int, len(features))
+	for j, name := range features {
+		if cols[j], ok = index[name]; !ok || name == target {
+			return nil, nil, nil, fmt.Errorf("invalid feature column %s", name)
+		}
+	}
+
+	// Parse the rows.
+	x := make([][]float64, len(records)-1)
+	y := make([]float64, len(records)-1)
+	for i, record := range records[1:] {
+		if y[i], err = strconv.ParseFloat(record[targetCol], 64); err != nil {
+			return nil, nil, nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+		}
+		x[i] = make([]float64, len(cols))
+		for j, c := range cols {
+			if x[i][j], err = strconv.ParseFloat(record[c], 64); err != nil {
+				return nil, nil, nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+			}
+		}
+	}
+
+	return features, x, y, nil
+}
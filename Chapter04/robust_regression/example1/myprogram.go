@@ -0,0 +1,511 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+)
+
+// ModelInfo includes the information about the
+// model that is output from the training.
+type ModelInfo struct {
+	Intercept    float64           `json:"intercept"`
+	Coefficients []CoefficientInfo `json:"coefficients"`
+}
+
+// CoefficientInfo include information about a
+// particular model coefficient.
+type CoefficientInfo struct {
+	Name        string  `json:"name"`
+	Coefficient float64 `json:"coefficient"`
+}
+
+// LinearFitter fits a linear model to the rows of x, weighting each
+// row by the matching entry of weights (or equally if weights is nil).
+// The first returned coefficient is the intercept.
+type LinearFitter func(x [][]float64, y, weights []float64) ([]float64, error)
+
+// WeightFunc gives the weight of a residual that has been divided
+// by the scale of the residuals.
+type WeightFunc func(u float64) float64
+
+// Fit includes the coefficients of a robust fit along with the
+// weight that each row ended up with.
+type Fit struct {
+	Coefficients []float64
+	Weights      []float64
+	Scale        float64
+	Iterations   int
+}
+
+// HuberWeight returns the Huber weight function with tuning constant c,
+// which down-weights residuals larger than c in proportion to their size.
+func HuberWeight(c float64) WeightFunc {
+	return func(u float64) float64 {
+		if math.Abs(u) <= c {
+			return 1
+		}
+		return c / math.Abs(u)
+	}
+}
+
+// TukeyWeight returns the Tukey bisquare weight function with tuning
+// constant c, which gives residuals larger than c no weight at all.
+func TukeyWeight(c float64) WeightFunc {
+	return func(u float64) float64 {
+		if math.Abs(u) >= c {
+			return 0
+		}
+		v := 1 - (u/c)*(u/c)
+		return v * v
+	}
+}
+
+func main() {
+
+	// Declare the data flags.
+	inPtr := flag.String("in", "diabetes.csv", "The input data file")
+	targetPtr := flag.String("target", "y", "The column to model")
+	featuresPtr := flag.String("features", "", "Comma separated feature columns, or empty for every column except the target")
+
+	// Declare the estimator flags.
+	huberPtr := flag.Float64("huber", 1.345, "The tuning constant of the Huber weights")
+	tukeyPtr := flag.Float64("tukey", 4.685, "The tuning constant of the Tukey bisquare weights")
+	maxIterPtr := flag.Int("maxIter", 100, "The maximum number of reweighting iterations")
+	tolPtr := flag.Float64("tol", 1e-8, "The largest coefficient change at convergence")
+	trialsPtr := flag.Int("trials", 1000, "The number of RANSAC trials")
+	minSamplesPtr := flag.Int("minSamples", 0, "The rows in each RANSAC sample, or 0 for one more than the features")
+	thresholdPtr := flag.Float64("threshold", 0, "The largest absolute residual of a RANSAC inlier, or 0 for 2.5 times the robust scale of the least squares residuals")
+	seedPtr := flag.Int64("seed", 1, "The seed of the RANSAC samples")
+
+	// Declare the output flags.
+	methodPtr := flag.String("method", "huber", "The estimator to save: ols, huber, tukey or ransac")
+	outPtr := flag.String("out", "model.json", "The output file for the model")
+	weightsPtr := flag.String("weights", "weights.csv", "The output file for the weights of each row")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Read in the data.
+	features, x, y, err := readData(*inPtr, *targetPtr, *featuresPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Fit the ordinary least squares model for comparison.
+	ols, err := LeastSquares(x, y, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Fit the M-estimators. The bisquare objective has several
+	// minima, so it starts from the Huber fit.
+	huber, err := IRLS(LeastSquares, x, y, HuberWeight(*huberPtr), ols, *maxIterPtr, *tolPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tukey, err := IRLS(LeastSquares, x, y, TukeyWeight(*tukeyPtr), huber.Coefficients, *maxIterPtr, *tolPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Fit RANSAC around least squares. The default threshold is 2.5
+	// times the robust scale of the least squares residuals, their
+	// median absolute deviation over 0.6745 as in IRLS, which keeps
+	// about 99% of normal noise around the fit.
+	threshold := *thresholdPtr
+	if threshold == 0 {
+		residuals := make([]float64, len(y))
+		for i, row := range x {
+			residuals[i] = y[i] - predict(ols, row)
+		}
+		threshold = 2.5 * medianAbsDeviation(residuals) / 0.6745
+	}
+	minSamples := *minSamplesPtr
+	if minSamples == 0 {
+		minSamples = len(features) + 1
+	}
+	ransac, err := RANSAC(LeastSquares, x, y, minSamples, threshold, *trialsPtr, *seedPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Output the coefficients side by side.
+	fmt.Printf("\n%-12s %12s %12s %12s %12s\n", "", "OLS", "Huber", "Tukey", "RANSAC")
+	names := append([]string{"intercept"}, features...)
+	for j, name := range names {
+		fmt.Printf("%-12s %12.4f %12.4f %12.4f %12.4f\n", name, ols[j], huber.Coefficients[j], tukey.Coefficients[j], ransac.Coefficients[j])
+	}
+	fmt.Printf("\nHuber: %d iterations, scale %0.2f\n", huber.Iterations, huber.Scale)
+	fmt.Printf("Tukey: %d iterations, scale %0.2f\n", tukey.Iterations, tukey.Scale)
+	fmt.Printf("RANSAC: %0.0f of %d rows are inliers within %0.2f\n\n", sum(ransac.Weights), len(y), threshold)
+
+	// Output the most down-weighted rows.
+	order := make([]int, len(y))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return tukey.Weights[order[a]] < tukey.Weights[order[b]]
+	})
+	fmt.Println("Most down-weighted rows:")
+	fmt.Printf("%6s %10s %12s %12s %12s %8s\n", "row", "y", "residual", "huber", "tukey", "inlier")
+	for _, i := range order[:5] {
+		fmt.Printf("%6d %10.1f %12.2f %12.4f %12.4f %8t\n", i+1, y[i], y[i]-predict(ols, x[i]), huber.Weights[i], tukey.Weights[i], ransac.Weights[i] == 1)
+	}
+	fmt.Println()
+
+	// Save the weights of each row.
+	if err := writeWeights(*weightsPtr, x, y, ols, huber, tukey, ransac); err != nil {
+		log.Fatal(err)
+	}
+
+	// Save the chosen model.
+	var coeffs []float64
+	switch *methodPtr {
+	case "ols":
+		coeffs = ols
+	case "huber":
+		coeffs = huber.Coefficients
+	case "tukey":
+		coeffs = tukey.Coefficients
+	case "ransac":
+		coeffs = ransac.Coefficients
+	default:
+		log.Fatalf("unknown method %s", *methodPtr)
+	}
+
+	modelInfo := ModelInfo{Intercept: coeffs[0]}
+	for j, name := range features {
+		modelInfo.Coefficients = append(modelInfo.Coefficients, CoefficientInfo{
+			Name:        name,
+			Coefficient: coeffs[j+1],
+		})
+	}
+
+	outputData, err := json.MarshalIndent(modelInfo, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(*outPtr, outputData, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// LeastSquares is a LinearFitter that solves the weighted least squares
+// problem with a QR decomposition of the weighted design matrix.
+func LeastSquares(x [][]float64, y, weights []float64) ([]float64, error) {
+
+	n := len(x)
+	if n == 0 {
+		return nil, errors.New("no rows to fit")
+	}
+	p := len(x[0]) + 1
+	if n < p {
+		return nil, fmt.Errorf("%d rows cannot determine %d coefficients", n, p)
+	}
+
+	// Scale each row, and its target, by the square
+	// root of its weight.
+	design := mat.NewDense(n, p, nil)
+	target := mat.NewVecDense(n, nil)
+	for i, row := range x {
+		s := 1.0
+		if weights != nil {
+			s = math.Sqrt(weights[i])
+		}
+		design.Set(i, 0, s)
+		for j, v := range row {
+			design.Set(i, j+1, s*v)
+		}
+		target.SetVec(i, s*y[i])
+	}
+
+	var qr mat.QR
+	qr.Factorize(design)
+
+	var coeffs mat.VecDense
+	if err := qr.SolveVecTo(&coeffs, false, target); err != nil {
+		return nil, err
+	}
+
+	return mat.Col(nil, 0, &coeffs), nil
+}
+
+// IRLS fits an M-estimator by iteratively reweighted least squares,
+// starting from the given coefficients. Each iteration rescales the
+// residuals by their median absolute deviation, weights the rows
+// with weight and refits with fitter.
+func IRLS(fitter LinearFitter, x [][]float64, y []float64, weight WeightFunc, start []float64, maxIter int, tol float64) (Fit, error) {
+
+	fit := Fit{
+		Coefficients: start,
+		Weights:      make([]float64, len(y)),
+	}
+	residuals := make([]float64, len(y))
+
+	for fit.Iterations < maxIter {
+		fit.Iterations++
+
+		// Compute the weights from the scaled residuals.
+		for i, row := range x {
+			residuals[i] = y[i] - predict(fit.Coefficients, row)
+		}
+		fit.Scale = medianAbsDeviation(residuals) / 0.6745
+		if fit.Scale == 0 {
+			return fit, errors.New("the residuals have zero scale")
+		}
+		for i, r := range residuals {
+			fit.Weights[i] = weight(r / fit.Scale)
+		}
+
+		// Refit with the new weights.
+		coeffs, err := fitter(x, y, fit.Weights)
+		if err != nil {
+			return fit, err
+		}
+
+		var change float64
+		for j := range coeffs {
+			change = math.Max(change, math.Abs(coeffs[j]-fit.Coefficients[j]))
+		}
+		fit.Coefficients = coeffs
+		if change < tol {
+			break
+		}
+	}
+
+	return fit, nil
+}
+
+// RANSAC repeatedly fits random samples of minSamples rows and keeps the
+// sample whose model has the most rows within threshold of it, breaking
+// ties by the squared error of those rows. The final model is refit on
+// the inliers, whose weights are 1 while the outliers get 0. Each sample
+// needs at least one row per coefficient, including the intercept.
+func RANSAC(fitter LinearFitter, x [][]float64, y []float64, minSamples int, threshold float64, trials int, seed int64) (Fit, error) {
+
+	n := len(y)
+	if minSamples > n {
+		return Fit{}, fmt.Errorf("invalid sample size %d for %d rows", minSamples, n)
+	}
+	if len(x) > 0 && minSamples < len(x[0])+1 {
+		return Fit{}, fmt.Errorf("a sample of %d rows cannot determine %d coefficients", minSamples, len(x[0])+1)
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	var best []bool
+	bestCount, bestSSE := 0, math.Inf(1)
+
+	sampleX := make([][]float64, minSamples)
+	sampleY := make([]float64, minSamples)
+	for t := 0; t < trials; t++ {
+
+		// Fit a random sample, skipping degenerate ones.
+		for s, i := range rng.Perm(n)[:minSamples] {
+			sampleX[s], sampleY[s] = x[i], y[i]
+		}
+		coeffs, err := fitter(sampleX, sampleY, nil)
+		if err != nil || !finite(coeffs) {
+			continue
+		}
+
+		// Find the inliers of the sample model.
+		inliers := make([]bool, n)
+		var count int
+		var sse float64
+		for i, row := range x {
+			r := y[i] - predict(coeffs, row)
+			if math.Abs(r) <= threshold {
+				inliers[i] = true
+				count++
+				sse += r * r
+			}
+		}
+
+		if count > bestCount || (count == bestCount && sse < bestSSE) {
+			best, bestCount, bestSSE = inliers, count, sse
+		}
+	}
+
+	if bestCount < minSamples {
+		return Fit{}, errors.New("no sample model had enough inliers")
+	}
+
+	// Refit on the inliers.
+	fit := Fit{Weights: make([]float64, n), Iterations: trials}
+	var inX [][]float64
+	var inY []float64
+	for i, in := range best {
+		if in {
+			fit.Weights[i] = 1
+			inX = append(inX, x[i])
+			inY = append(inY, y[i])
+		}
+	}
+
+	coeffs, err := fitter(inX, inY, nil)
+	if err != nil || !finite(coeffs) {
+		return Fit{}, fmt.Errorf("the refit on the %d inliers is singular: %v", len(inY), err)
+	}
+	fit.Coefficients = coeffs
+	fit.Scale = threshold
+
+	return fit, nil
+}
+
+// predict returns the prediction of the coefficients for a row.
+func predict(coeffs, row []float64) float64 {
+	prediction := coeffs[0]
+	for j, v := range row {
+		prediction += coeffs[j+1] * v
+	}
+	return prediction
+}
+
+// medianAbsDeviation returns the median absolute deviation
+// of the values from their median.
+func medianAbsDeviation(values []float64) float64 {
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	median := stat.Quantile(0.5, stat.Empirical, sorted, nil)
+
+	for i, v := range sorted {
+		sorted[i] = math.Abs(v - median)
+	}
+	sort.Float64s(sorted)
+
+	return stat.Quantile(0.5, stat.Empirical, sorted, nil)
+}
+
+// finite reports whether all of the values are finite.
+func finite(values []float64) bool {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// sum returns the sum of the values.
+func sum(values []float64) float64 {
+	var total float64
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+// writeWeights saves the residual of each row under least squares
+// along with its weight under each of the robust estimators.
+func writeWeights(path string, x [][]float64, y []float64, ols []float64, huber, tukey, ransac Fit) error {
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"row", "y", "ols_residual", "huber_weight", "tukey_weight", "ransac_inlier"}); err != nil {
+		return err
+	}
+	for i, row := range x {
+		record := []string{
+			strconv.Itoa(i + 1),
+			strconv.FormatFloat(y[i], 'f', -1, 64),
+			strconv.FormatFloat(y[i]-predict(ols, row), 'f', 4, 64),
+			strconv.FormatFloat(huber.Weights[i], 'f', 4, 64),
+			strconv.FormatFloat(tukey.Weights[i], 'f', 4, 64),
+			strconv.FormatBool(ransac.Weights[i] == 1),
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+
+	return w.Error()
+}
+
+// readData reads the feature and target columns of a CSV file with a header.
+func readData(path, target, featureSpec string) ([]string, [][]float64, []float64, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(records) < 2 {
+		return nil, nil, nil, errors.New("expected a header and at least one row")
+	}
+	header := records[0]
+
+	// Work out the feature columns.
+	var features []string
+	for _, name := range strings.Split(featureSpec, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			features = append(features, name)
+		}
+	}
+	if len(features) == 0 {
+		for _, name := range header {
+			if name != target {
+				features = append(features, name)
+			}
+		}
+	}
+
+	index := make(map[string]int)
+	for i, name := range header {
+		index[name] = i
+	}
+	targetCol, ok := index[target]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("target column %s not found", target)
+	}
+	cols := make([]int, len(features))
+	for j, name := range features {
+		if cols[j], ok = index[name]; !ok || name == target {
+			return nil, nil, nil, fmt.Errorf("invalid feature column %s", name)
+		}
+	}
+
+	// Parse the rows.
+	x := make([][]float64, len(records)-1)
+	y := make([]float64, len(records)-1)
+	for i, record := range records[1:] {
+		if y[i], err = strconv.ParseFloat(record[targetCol], 64); err != nil {
+			return nil, nil, nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+		}
+		x[i] = make([]float64, len(cols))
+		for j, c := range cols {
+			if x[i][j], err = strconv.ParseFloat(record[c], 64); err != nil {
+				return nil, nil, nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+			}
+		}
+	}
+
+	return features, x, y, nil
+}
@@ -0,0 +1,904 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TreeModel includes the information about the fitted
+// tree that is output from the training.
+type TreeModel struct {
+	Criterion string        `json:"criterion"`
+	Target    string        `json:"target"`
+	Classes   []string      `json:"classes,omitempty"`
+	Features  []FeatureInfo `json:"features"`
+	Alpha     float64       `json:"alpha"`
+	Root      *Node         `json:"root"`
+}
+
+// FeatureInfo describes a feature column. The values of a
+// categorical feature are one of its levels.
+type FeatureInfo struct {
+	Name        string   `json:"name"`
+	Categorical bool     `json:"categorical"`
+	Levels      []string `json:"levels,omitempty"`
+}
+
+// Node is a node of the tree. Rows go left when their value of Feature
+// is at most Threshold or, for a categorical feature, is one of
+// Categories. Leaves have no children and predict Value, which for
+// classification is the index of Class, with Distribution holding the
+// proportion of each class.
+type Node struct {
+	Feature      string    `json:"feature,omitempty"`
+	Threshold    float64   `json:"threshold,omitempty"`
+	Categories   []string  `json:"categories,omitempty"`
+	Left         *Node     `json:"left,omitempty"`
+	Right        *Node     `json:"right,omitempty"`
+	Value        float64   `json:"value"`
+	Class        string    `json:"class,omitempty"`
+	Distribution []float64 `json:"distribution,omitempty"`
+	Samples      int       `json:"samples"`
+	Impurity     float64   `json:"impurity"`
+
+	feature int
+	left    map[int]bool
+}
+
+// Config holds the settings used to grow a tree.
+type Config struct {
+	Criterion string
+	MaxDepth  int
+	MinLeaf   int
+	Classes   int
+}
+
+// Dataset holds the encoded rows of a CSV file, where categorical values
+// are the index of their level and class labels the index of their class.
+type Dataset struct {
+	Features []FeatureInfo
+	X        [][]float64
+	Y        []float64
+}
+
+func main() {
+
+	// Declare the data flags.
+	inPtr := flag.String("in", "iris.csv", "The training data")
+	targetPtr := flag.String("target", "species", "The column to model")
+	categoricalPtr := flag.String("categorical", "", "Comma separated numeric columns to treat as categorical, in addition to any non-numeric columns")
+
+	// Declare the tree flags.
+	criterionPtr := flag.String("criterion", "gini", "The split criterion: gini or entropy for classification, mse or mae for regression")
+	maxDepthPtr := flag.Int("maxDepth", 0, "The maximum depth of the tree, or 0 for no limit")
+	minLeafPtr := flag.Int("minLeaf", 1, "The minimum number of samples in a leaf")
+	alphaPtr := flag.Float64("alpha", -1, "The cost-complexity pruning alpha, or negative to choose it by cross validation")
+	foldsPtr := flag.Int("folds", 5, "The number of cross validation folds used to choose alpha")
+	seedPtr := flag.Int64("seed", 1, "The seed of the cross validation folds")
+
+	// Declare the output flags.
+	outPtr := flag.String("out", "tree.json", "The output file for the model")
+	dotPtr := flag.String("dot", "tree.dot", "The output file for the Graphviz export")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	cfg := Config{
+		Criterion: *criterionPtr,
+		MaxDepth:  *maxDepthPtr,
+		MinLeaf:   *minLeafPtr,
+	}
+	classification, err := isClassification(cfg.Criterion)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Read in the data.
+	data, classes, err := readData(*inPtr, *targetPtr, splitNames(*categoricalPtr), classification)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.Classes = len(classes)
+
+	// Grow the full tree.
+	all := make([]int, len(data.Y))
+	for i := range all {
+		all[i] = i
+	}
+	full := Grow(data, all, cfg)
+
+	// Choose alpha by cross validation over the pruning path
+	// of the full tree, unless one was given.
+	alpha := *alphaPtr
+	if alpha < 0 {
+		candidates := candidateAlphas(PruningPath(full, len(all)))
+		scores, err := CrossValidateAlpha(data, cfg, candidates, *foldsPtr, *seedPtr)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("\n%12s %8s %12s %12s\n", "alpha", "leaves", "cv error", "std dev")
+		best := 0
+		for c, s := range scores {
+			pruned := Prune(full, candidates[c], len(all))
+			fmt.Printf("%12.6f %8d %12.4f %12.4f\n", candidates[c], countLeaves(pruned), s[0], s[1])
+			if s[0] < scores[best][0] {
+				best = c
+			}
+		}
+		alpha = candidates[best]
+	}
+
+	// Prune the full tree with the chosen alpha.
+	root := Prune(full, alpha, len(all))
+
+	var trainErr float64
+	for i, row := range data.X {
+		trainErr += loss(cfg.Criterion, data.Y[i], Predict(root, data.Features, row).Value) / float64(len(data.Y))
+	}
+
+	fmt.Printf("\nalpha = %0.6f: %d leaves, depth %d, training error %0.4f\n\n", alpha, countLeaves(root), depth(root), trainErr)
+
+	// Save the model, naming the class of each node.
+	nameClasses(root, classes)
+	model := TreeModel{
+		Criterion: cfg.Criterion,
+		Target:    *targetPtr,
+		Classes:   classes,
+		Features:  data.Features,
+		Alpha:     alpha,
+		Root:      root,
+	}
+	outputData, err := json.MarshalIndent(model, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(*outPtr, outputData, 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	// Save the Graphviz export.
+	if err := ioutil.WriteFile(*dotPtr, []byte(DOT(&model)), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Grow recursively grows a tree on the rows in idx, splitting each node
+// on the feature and split that most reduce the impurity, until a node
+// is pure, reaches the maximum depth or cannot be split with at least
+// the minimum number of samples in each leaf.
+func Grow(data *Dataset, idx []int, cfg Config) *Node {
+	return grow(data, idx, cfg, 0)
+}
+
+func grow(data *Dataset, idx []int, cfg Config, level int) *Node {
+
+	node := leafNode(data, idx, cfg)
+	if node.Impurity <= 1e-12 || (cfg.MaxDepth > 0 && level >= cfg.MaxDepth) || len(idx) < 2*cfg.MinLeaf {
+		return node
+	}
+
+	// Find the best split over all of the features.
+	bestCost := node.Impurity * float64(len(idx))
+	found := false
+	for f, feature := range data.Features {
+		var s split
+		if feature.Categorical {
+			s = categoricalSplit(data, idx, f, cfg)
+		} else {
+			s = numericSplit(data, idx, f, cfg)
+		}
+		if s.ok && s.cost < bestCost-1e-12 {
+			bestCost, found = s.cost, true
+			node.feature = f
+			node.Feature = feature.Name
+			node.Threshold = s.threshold
+			node.left = s.left
+		}
+	}
+	if !found {
+		return node
+	}
+
+	// Partition the rows and grow the children.
+	var leftIdx, rightIdx []int
+	for _, i := range idx {
+		if goesLeft(node, data.Features, data.X[i]) {
+			leftIdx = append(leftIdx, i)
+		} else {
+			rightIdx = append(rightIdx, i)
+		}
+	}
+	if node.left != nil {
+		for l := range node.left {
+			node.Categories = append(node.Categories, data.Features[node.feature].Levels[l])
+		}
+		sort.Strings(node.Categories)
+	}
+
+	node.Left = grow(data, leftIdx, cfg, level+1)
+	node.Right = grow(data, rightIdx, cfg, level+1)
+
+	return node
+}
+
+// leafNode returns a leaf predicting the rows in idx.
+func leafNode(data *Dataset, idx []int, cfg Config) *Node {
+
+	acc := newAccumulator(cfg)
+	for _, i := range idx {
+		acc.add(data.Y[i])
+	}
+
+	node := &Node{
+		Samples:  len(idx),
+		Impurity: acc.impurity(),
+		feature:  -1,
+	}
+
+	switch a := acc.(type) {
+	case *classAccumulator:
+		node.Distribution = make([]float64, len(a.counts))
+		for c, count := range a.counts {
+			node.Distribution[c] = count / a.n
+			if count > a.counts[int(node.Value)] {
+				node.Value = float64(c)
+			}
+		}
+	case *mseAccumulator:
+		node.Value = a.sum / a.n
+	case *maeAccumulator:
+		node.Value = median(a.values)
+	}
+
+	return node
+}
+
+// split is a candidate split of a node, with the sum of the
+// impurities of its children weighted by their samples.
+type split struct {
+	ok        bool
+	cost      float64
+	threshold float64
+	left      map[int]bool
+}
+
+// numericSplit finds the best threshold of feature f, halfway
+// between consecutive distinct values.
+func numericSplit(data *Dataset, idx []int, f int, cfg Config) split {
+
+	sorted := append([]int(nil), idx...)
+	sort.Slice(sorted, func(a, b int) bool { return data.X[sorted[a]][f] < data.X[sorted[b]][f] })
+
+	left, right := newAccumulator(cfg), newAccumulator(cfg)
+	for _, i := range sorted {
+		right.add(data.Y[i])
+	}
+
+	var best split
+	for k := 0; k < len(sorted)-1; k++ {
+		left.add(data.Y[sorted[k]])
+		right.remove(data.Y[sorted[k]])
+
+		x, next := data.X[sorted[k]][f], data.X[sorted[k+1]][f]
+		if x == next || k+1 < cfg.MinLeaf || len(sorted)-k-1 < cfg.MinLeaf {
+			continue
+		}
+
+		cost := left.impurity()*left.count() + right.impurity()*right.count()
+		if !best.ok || cost < best.cost {
+			best = split{ok: true, cost: cost, threshold: (x + next) / 2}
+		}
+	}
+
+	return best
+}
+
+// categoricalSplit finds the best subset of the levels of feature f to
+// send left. For regression and binary classification the levels are
+// ordered by their mean target and only splits along that order are
+// tried, which finds the best subset. For more classes every subset is
+// tried when there are few levels, and otherwise the levels are ordered
+// by the proportion of the most common class.
+func categoricalSplit(data *Dataset, idx []int, f int, cfg Config) split {
+
+	// Group the rows by level.
+	groups := make(map[int][]int)
+	for _, i := range idx {
+		level := int(data.X[i][f])
+		groups[level] = append(groups[level], i)
+	}
+	if len(groups) < 2 {
+		return split{}
+	}
+	var levels []int
+	for level := range groups {
+		levels = append(levels, level)
+	}
+	sort.Ints(levels)
+
+	evaluate := func(left map[int]bool) split {
+		l, r := newAccumulator(cfg), newAccumulator(cfg)
+		for _, level := range levels {
+			acc := r
+			if left[level] {
+				acc = l
+			}
+			for _, i := range groups[level] {
+				acc.add(data.Y[i])
+			}
+		}
+		if int(l.count()) < cfg.MinLeaf || int(r.count()) < cfg.MinLeaf {
+			return split{}
+		}
+		return split{ok: true, cost: l.impurity()*l.count() + r.impurity()*r.count(), left: left}
+	}
+
+	var best split
+	consider := func(s split) {
+		if s.ok && (!best.ok || s.cost < best.cost) {
+			best = s
+		}
+	}
+
+	// Try every subset, keeping the last level on the right
+	// so that each split is only tried once.
+	if cfg.Classes > 2 && len(levels) <= 10 {
+		for mask := 1; mask < 1<<uint(len(levels)-1); mask++ {
+			left := make(map[int]bool)
+			for b, level := range levels[:len(levels)-1] {
+				if mask&(1<<uint(b)) != 0 {
+					left[level] = true
+				}
+			}
+			consider(evaluate(left))
+		}
+		return best
+	}
+
+	// Order the levels and try each prefix.
+	ordering := 1
+	if cfg.Classes > 2 {
+		ordering = majority(data, idx, cfg.Classes)
+	}
+	key := make(map[int]float64)
+	for _, level := range levels {
+		acc := newAccumulator(cfg)
+		for _, i := range groups[level] {
+			acc.add(data.Y[i])
+		}
+		switch a := acc.(type) {
+		case *classAccumulator:
+			key[level] = a.counts[ordering] / a.n
+		case *mseAccumulator:
+			key[level] = a.sum / a.n
+		case *maeAccumulator:
+			key[level] = median(a.values)
+		}
+	}
+	sort.SliceStable(levels, func(a, b int) bool { return key[levels[a]] < key[levels[b]] })
+
+	left := make(map[int]bool)
+	for _, level := range levels[:len(levels)-1] {
+		left[level] = true
+		prefix := make(map[int]bool)
+		for l := range left {
+			prefix[l] = true
+		}
+		consider(evaluate(prefix))
+	}
+
+	return best
+}
+
+// majority returns the most common class of the rows in idx.
+func majority(data *Dataset, idx []int, classes int) int {
+	counts := make([]int, classes)
+	best := 0
+	for _, i := range idx {
+		c := int(data.Y[i])
+		counts[c]++
+		if counts[c] > counts[best] {
+			best = c
+		}
+	}
+	return best
+}
+
+// accumulator keeps track of the impurity of a set of targets
+// as they are added and removed.
+type accumulator interface {
+	add(y float64)
+	remove(y float64)
+	count() float64
+	impurity() float64
+}
+
+func newAccumulator(cfg Config) accumulator {
+	switch cfg.Criterion {
+	case "gini", "entropy":
+		return &classAccumulator{counts: make([]float64, cfg.Classes), entropy: cfg.Criterion == "entropy"}
+	case "mae":
+		return &maeAccumulator{}
+	default:
+		return &mseAccumulator{}
+	}
+}
+
+// classAccumulator calculates the Gini impurity, 1 - Σp², or
+// the entropy, -Σp·log₂p, of the class counts.
+type classAccumulator struct {
+	counts  []float64
+	n       float64
+	entropy bool
+}
+
+func (a *classAccumulator) add(y float64)    { a.counts[int(y)]++; a.n++ }
+func (a *classAccumulator) remove(y float64) { a.counts[int(y)]--; a.n-- }
+func (a *classAccumulator) count() float64   { return a.n }
+
+func (a *classAccumulator) impurity() float64 {
+	if a.n == 0 {
+		return 0
+	}
+	var sum float64
+	for _, count := range a.counts {
+		p := count / a.n
+		if a.entropy {
+			if p > 0 {
+				sum -= p * math.Log2(p)
+			}
+		} else {
+			sum += p * p
+		}
+	}
+	if a.entropy {
+		return sum
+	}
+	return 1 - sum
+}
+
+// mseAccumulator calculates the variance of the targets,
+// which is their mean squared error about their mean.
+type mseAccumulator struct {
+	sum, sumSq, n float64
+}
+
+func (a *mseAccumulator) add(y float64)    { a.sum += y; a.sumSq += y * y; a.n++ }
+func (a *mseAccumulator) remove(y float64) { a.sum -= y; a.sumSq -= y * y; a.n-- }
+func (a *mseAccumulator) count() float64   { return a.n }
+
+func (a *mseAccumulator) impurity() float64 {
+	if a.n == 0 {
+		return 0
+	}
+	mean := a.sum / a.n
+	return math.Max(a.sumSq/a.n-mean*mean, 0)
+}
+
+// maeAccumulator calculates the mean absolute error of
+// the targets about their median.
+type maeAccumulator struct {
+	values []float64
+}
+
+func (a *maeAccumulator) add(y float64)  { a.values = append(a.values, y) }
+func (a *maeAccumulator) count() float64 { return float64(len(a.values)) }
+
+func (a *maeAccumulator) remove(y float64) {
+	for i, v := range a.values {
+		if v == y {
+			a.values = append(a.values[:i], a.values[i+1:]...)
+			return
+		}
+	}
+}
+
+func (a *maeAccumulator) impurity() float64 {
+	if len(a.values) == 0 {
+		return 0
+	}
+	m := median(a.values)
+	var sum float64
+	for _, v := range a.values {
+		sum += math.Abs(v - m)
+	}
+	return sum / float64(len(a.values))
+}
+
+// median returns the median of the values without reordering them.
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// goesLeft reports whether a row goes to the left child of a node.
+func goesLeft(node *Node, features []FeatureInfo, row []float64) bool {
+	if features[node.feature].Categorical {
+		return node.left[int(row[node.feature])]
+	}
+	return row[node.feature] <= node.Threshold
+}
+
+// Predict returns the leaf that a row falls into.
+func Predict(node *Node, features []FeatureInfo, row []float64) *Node {
+	for node.Left != nil {
+		if goesLeft(node, features, row) {
+			node = node.Left
+		} else {
+			node = node.Right
+		}
+	}
+	return node
+}
+
+// Prune returns the smallest subtree minimizing the cost-complexity
+// R(T) + alpha·|leaves(T)|, where the cost R(T) sums the impurity of
+// the leaves weighted by their share of the total samples.
+func Prune(node *Node, alpha float64, total int) *Node {
+	pruned, _ := prune(node, alpha, float64(total))
+	return pruned
+}
+
+func prune(node *Node, alpha, total float64) (*Node, float64) {
+
+	leafCost := node.Impurity*float64(node.Samples)/total + alpha
+	if node.Left == nil {
+		return node, leafCost
+	}
+
+	left, leftCost := prune(node.Left, alpha, total)
+	right, rightCost := prune(node.Right, alpha, total)
+	if leafCost <= leftCost+rightCost+1e-12 {
+		leaf := *node
+		leaf.Left, leaf.Right = nil, nil
+		leaf.Feature, leaf.Threshold, leaf.Categories = "", 0, nil
+		leaf.feature, leaf.left = -1, nil
+		return &leaf, leafCost
+	}
+
+	copied := *node
+	copied.Left, copied.Right = left, right
+	return &copied, leftCost + rightCost
+}
+
+// PruningPath returns the increasing alphas at which the weakest links
+// of the tree are pruned, starting from 0 and ending when only the
+// root is left.
+func PruningPath(root *Node, total int) []float64 {
+
+	alphas := []float64{0}
+	tree := root
+	for tree.Left != nil {
+
+		// Find the weakest link, which is the internal node t with the
+		// smallest (R(t) - R(T_t)) / (|leaves(T_t)| - 1).
+		weakest := math.Inf(1)
+		var walk func(n *Node) (float64, int)
+		walk = func(n *Node) (float64, int) {
+			cost := n.Impurity * float64(n.Samples) / float64(total)
+			if n.Left == nil {
+				return cost, 1
+			}
+			leftCost, leftLeaves := walk(n.Left)
+			rightCost, rightLeaves := walk(n.Right)
+			subtreeCost, leaves := leftCost+rightCost, leftLeaves+rightLeaves
+			weakest = math.Min(weakest, (cost-subtreeCost)/float64(leaves-1))
+			return subtreeCost, leaves
+		}
+		walk(tree)
+
+		weakest = math.Max(weakest, alphas[len(alphas)-1])
+		if weakest > alphas[len(alphas)-1] {
+			alphas = append(alphas, weakest)
+		}
+		tree = Prune(tree, weakest, total)
+	}
+
+	return alphas
+}
+
+// candidateAlphas returns the geometric means of consecutive alphas on
+// the pruning path, which are typical of the range in which each
+// subtree is optimal, followed by the last alpha.
+func candidateAlphas(path []float64) []float64 {
+	var candidates []float64
+	for k := 0; k < len(path)-1; k++ {
+		candidates = append(candidates, math.Sqrt(path[k]*path[k+1]))
+	}
+	return append(candidates, path[len(path)-1])
+}
+
+// CrossValidateAlpha grows a tree on the training rows of each fold,
+// prunes it with each candidate alpha and returns the mean and standard
+// deviation of the error on the held out rows for each candidate.
+func CrossValidateAlpha(data *Dataset, cfg Config, candidates []float64, folds int, seed int64) ([][2]float64, error) {
+
+	n := len(data.Y)
+	if folds < 2 || folds > n {
+		return nil, fmt.Errorf("invalid number of folds %d for %d rows", folds, n)
+	}
+
+	perm := rand.New(rand.NewSource(seed)).Perm(n)
+	errs := make([][]float64, len(candidates))
+	for k := 0; k < folds; k++ {
+		var train, test []int
+		for pos, i := range perm {
+			if pos%folds == k {
+				test = append(test, i)
+			} else {
+				train = append(train, i)
+			}
+		}
+
+		tree := Grow(data, train, cfg)
+		for c, alpha := range candidates {
+			pruned := Prune(tree, alpha, len(train))
+			var e float64
+			for _, i := range test {
+				e += loss(cfg.Criterion, data.Y[i], Predict(pruned, data.Features, data.X[i]).Value)
+			}
+			errs[c] = append(errs[c], e/float64(len(test)))
+		}
+	}
+
+	scores := make([][2]float64, len(candidates))
+	for c, e := range errs {
+		var mean, sumSq float64
+		for _, v := range e {
+			mean += v / float64(len(e))
+		}
+		for _, v := range e {
+			sumSq += (v - mean) * (v - mean)
+		}
+		scores[c] = [2]float64{mean, math.Sqrt(sumSq / float64(len(e)-1))}
+	}
+
+	return scores, nil
+}
+
+// loss returns the error of a prediction under the criterion: the
+// misclassification for classification and the squared or absolute
+// error for regression.
+func loss(criterion string, observed, predicted float64) float64 {
+	switch criterion {
+	case "gini", "entropy":
+		if observed == predicted {
+			return 0
+		}
+		return 1
+	case "mae":
+		return math.Abs(observed - predicted)
+	default:
+		return (observed - predicted) * (observed - predicted)
+	}
+}
+
+// nameClasses sets the class of each node of a classification tree.
+func nameClasses(node *Node, classes []string) {
+	if classes == nil {
+		return
+	}
+	node.Class = classes[int(node.Value)]
+	if node.Left != nil {
+		nameClasses(node.Left, classes)
+		nameClasses(node.Right, classes)
+	}
+}
+
+// countLeaves returns the number of leaves of the tree.
+func countLeaves(node *Node) int {
+	if node.Left == nil {
+		return 1
+	}
+	return countLeaves(node.Left) + countLeaves(node.Right)
+}
+
+// depth returns the depth of the tree.
+func depth(node *Node) int {
+	if node.Left == nil {
+		return 0
+	}
+	l, r := depth(node.Left), depth(node.Right)
+	if l > r {
+		return l + 1
+	}
+	return r + 1
+}
+
+// DOT exports the tree in the Graphviz DOT language, labelling each
+// node with its split, impurity, samples and prediction.
+func DOT(model *TreeModel) string {
+
+	var b strings.Builder
+	b.WriteString("digraph Tree {\n")
+	b.WriteString("\tnode [shape=box, style=\"rounded\", fontname=\"helvetica\"];\n")
+	b.WriteString("\tedge [fontname=\"helvetica\"];\n")
+
+	id := 0
+	var write func(node *Node) int
+	write = func(node *Node) int {
+		nodeID := id
+		id++
+
+		var lines []string
+		if node.Left != nil {
+			if node.Categories != nil {
+				lines = append(lines, fmt.Sprintf("%s in {%s}", node.Feature, strings.Join(node.Categories, ", ")))
+			} else {
+				lines = append(lines, fmt.Sprintf("%s <= %.4g", node.Feature, node.Threshold))
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%s = %.4f", model.Criterion, node.Impurity))
+		lines = append(lines, fmt.Sprintf("samples = %d", node.Samples))
+		if model.Classes != nil {
+			counts := make([]string, len(node.Distribution))
+			for c, p := range node.Distribution {
+				counts[c] = strconv.Itoa(int(math.Round(p * float64(node.Samples))))
+			}
+			lines = append(lines, fmt.Sprintf("value = [%s]", strings.Join(counts, ", ")))
+			lines = append(lines, fmt.Sprintf("class = %s", node.Class))
+		} else {
+			lines = append(lines, fmt.Sprintf("value = %.4g", node.Value))
+		}
+		fmt.Fprintf(&b, "\t%d [label=%q];\n", nodeID, strings.Join(lines, "\n"))
+
+		if node.Left != nil {
+			leftID := write(node.Left)
+			fmt.Fprintf(&b, "\t%d -> %d [label=\"yes\"];\n", nodeID, leftID)
+			rightID := write(node.Right)
+			fmt.Fprintf(&b, "\t%d -> %d [label=\"no\"];\n", nodeID, rightID)
+		}
+
+		return nodeID
+	}
+	write(model.Root)
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// isClassification reports whether the criterion is for classification.
+func isClassification(criterion string) (bool, error) {
+	switch criterion {
+	case "gini", "entropy":
+		return true, nil
+	case "mse", "mae":
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown criterion %s", criterion)
+}
+
+// splitNames splits a comma separated list of column names.
+func splitNames(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// readData reads a CSV file with a header into a dataset, treating the
+// named columns and any non-numeric columns as categorical. For
+// classification the target is encoded as the index of its class in
+// the returned classes.
+func readData(path, target string, categorical []string, classification bool) (*Dataset, []string, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) < 2 {
+		return nil, nil, errors.New("expected a header and at least one row")
+	}
+	header, rows := records[0], records[1:]
+
+	targetCol := -1
+	for j, name := range header {
+		if name == target {
+			targetCol = j
+		}
+	}
+	if targetCol < 0 {
+		return nil, nil, fmt.Errorf("target column %s not found", target)
+	}
+
+	isCategorical := make(map[string]bool)
+	for _, name := range categorical {
+		isCategorical[name] = true
+	}
+
+	// levels returns the sorted distinct values of a column.
+	levels := func(col int) []string {
+		seen := make(map[string]bool)
+		var values []string
+		for _, row := range rows {
+			if !seen[row[col]] {
+				seen[row[col]] = true
+				values = append(values, row[col])
+			}
+		}
+		sort.Strings(values)
+		return values
+	}
+
+	// Work out the type of each feature column.
+	data := &Dataset{}
+	var cols []int
+	for j, name := range header {
+		if j == targetCol {
+			continue
+		}
+		feature := FeatureInfo{Name: name, Categorical: isCategorical[name]}
+		for _, row := range rows {
+			if _, err := strconv.ParseFloat(row[j], 64); err != nil {
+				feature.Categorical = true
+				break
+			}
+		}
+		if feature.Categorical {
+			feature.Levels = levels(j)
+		}
+		data.Features = append(data.Features, feature)
+		cols = append(cols, j)
+	}
+
+	var classes []string
+	classIndex := make(map[string]int)
+	if classification {
+		classes = levels(targetCol)
+		for c, class := range classes {
+			classIndex[class] = c
+		}
+	}
+
+	// Encode the rows.
+	for i, row := range rows {
+		x := make([]float64, len(cols))
+		for k, j := range cols {
+			feature := data.Features[k]
+			if feature.Categorical {
+				x[k] = float64(sort.SearchStrings(feature.Levels, row[j]))
+				continue
+			}
+			x[k], _ = strconv.ParseFloat(row[j], 64)
+		}
+
+		var y float64
+		if classification {
+			y = float64(classIndex[row[targetCol]])
+		} else if y, err = strconv.ParseFloat(row[targetCol], 64); err != nil {
+			return nil, nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+		}
+
+		data.X = append(data.X, x)
+		data.Y = append(data.Y, y)
+	}
+
+	return data, classes, nil
+}
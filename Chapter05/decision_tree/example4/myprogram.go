@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"strconv"
+)
+
+// TreeModel includes the information about the fitted
+// tree that is output from the training.
+type TreeModel struct {
+	Criterion string        `json:"criterion"`
+	Target    string        `json:"target"`
+	Classes   []string      `json:"classes,omitempty"`
+	Features  []FeatureInfo `json:"features"`
+	Alpha     float64       `json:"alpha"`
+	Root      *Node         `json:"root"`
+}
+
+// FeatureInfo describes a feature column. The values of a
+// categorical feature are one of its levels.
+type FeatureInfo struct {
+	Name        string   `json:"name"`
+	Categorical bool     `json:"categorical"`
+	Levels      []string `json:"levels,omitempty"`
+}
+
+// Node is a node of the tree. Rows go left when their value of Feature
+// is at most Threshold or, for a categorical feature, is one of
+// Categories. Leaves have no children and predict Value, which for
+// classification is the index of Class, with Distribution holding the
+// proportion of each class.
+type Node struct {
+	Feature      string    `json:"feature,omitempty"`
+	Threshold    float64   `json:"threshold,omitempty"`
+	Categories   []string  `json:"categories,omitempty"`
+	Left         *Node     `json:"left,omitempty"`
+	Right        *Node     `json:"right,omitempty"`
+	Value        float64   `json:"value"`
+	Class        string    `json:"class,omitempty"`
+	Distribution []float64 `json:"distribution,omitempty"`
+	Samples      int       `json:"samples"`
+	Impurity     float64   `json:"impurity"`
+}
+
+func main() {
+
+	// Declare the input and output flags.
+	modelPtr := flag.String("model", "tree.json", "The model file output from the training")
+	inPtr := flag.String("in", "iris.csv", "The data to predict, with a header naming the features")
+	outPtr := flag.String("out", "predictions.csv", "The output file for the predictions")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Load and unmarshal the model.
+	f, err := ioutil.ReadFile(*modelPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var model TreeModel
+	if err := json.Unmarshal(f, &model); err != nil {
+		log.Fatal(err)
+	}
+	if model.Root == nil {
+		log.Fatal("the model has no tree")
+	}
+
+	// Read in the data to predict.
+	in, err := os.Open(*inPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer in.Close()
+
+	records, err := csv.NewReader(in).ReadAll()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(records) < 2 {
+		log.Fatal("expected a header and at least one row")
+	}
+	header := records[0]
+
+	// Add the prediction columns, with the probability of
+	// each class for classification.
+	outHeader := append(append([]string(nil), header...), "predicted")
+	for _, class := range model.Classes {
+		outHeader = append(outHeader, "p_"+class)
+	}
+	outRecords := [][]string{outHeader}
+
+	// Make the predictions, keeping track of the error
+	// when the data includes the target.
+	targetCol := -1
+	for j, name := range header {
+		if name == model.Target {
+			targetCol = j
+		}
+	}
+
+	var errSum float64
+	for i, record := range records[1:] {
+		values := make(map[string]string)
+		for j, name := range header {
+			values[name] = record[j]
+		}
+
+		leaf, err := Predict(&model, values)
+		if err != nil {
+			log.Fatalf("Predicting line %d failed: %v", i+2, err)
+		}
+
+		outRecord := append([]string(nil), record...)
+		if model.Classes != nil {
+			outRecord = append(outRecord, leaf.Class)
+			for _, p := range leaf.Distribution {
+				outRecord = append(outRecord, strconv.FormatFloat(p, 'f', 4, 64))
+			}
+		} else {
+			outRecord = append(outRecord, strconv.FormatFloat(leaf.Value, 'f', -1, 64))
+		}
+		outRecords = append(outRecords, outRecord)
+
+		if targetCol < 0 {
+			continue
+		}
+		if model.Classes != nil {
+			if record[targetCol] != leaf.Class {
+				errSum++
+			}
+			continue
+		}
+		observed, err := strconv.ParseFloat(record[targetCol], 64)
+		if err != nil {
+			log.Fatalf("Parsing line %d failed: %v", i+2, err)
+		}
+		if model.Criterion == "mae" {
+			errSum += math.Abs(observed - leaf.Value)
+		} else {
+			errSum += (observed - leaf.Value) * (observed - leaf.Value)
+		}
+	}
+
+	// Output the error to standard out.
+	if targetCol >= 0 {
+		n := float64(len(records) - 1)
+		switch {
+		case model.Classes != nil:
+			fmt.Printf("\nAccuracy = %0.4f\n\n", 1-errSum/n)
+		case model.Criterion == "mae":
+			fmt.Printf("\nMAE = %0.4f\n\n", errSum/n)
+		default:
+			fmt.Printf("\nMSE = %0.4f\n\n", errSum/n)
+		}
+	}
+
+	// Save the predictions.
+	out, err := os.Create(*outPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer out.Close()
+
+	w := csv.NewWriter(out)
+	if err := w.WriteAll(outRecords); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Predict returns the leaf of the tree that the
+// named feature values fall into.
+func Predict(model *TreeModel, values map[string]string) (*Node, error) {
+
+	categorical := make(map[string]bool)
+	for _, feature := range model.Features {
+		categorical[feature.Name] = feature.Categorical
+	}
+
+	node := model.Root
+	for node.Left != nil {
+
+		// Get the value of the split feature.
+		value, ok := values[node.Feature]
+		if !ok {
+			return nil, fmt.Errorf("Expected a value for feature %s", node.Feature)
+		}
+
+		// Decide which way to go. Categories not seen
+		// in the training go right.
+		left := false
+		if categorical[node.Feature] {
+			for _, category := range node.Categories {
+				if value == category {
+					left = true
+					break
+				}
+			}
+		} else {
+			x, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("feature %s: %v", node.Feature, err)
+			}
+			left = x <= node.Threshold
+		}
+
+		if left {
+			node = node.Left
+		} else {
+			node = node.Right
+		}
+		if node == nil {
+			return nil, errors.New("the tree is missing a child node")
+		}
+	}
+
+	return node, nil
+}
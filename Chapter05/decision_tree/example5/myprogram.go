@@ -0,0 +1,941 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ForestModel includes the information about the fitted
+// forest that is output from the training.
+type ForestModel struct {
+	Criterion   string           `json:"criterion"`
+	Target      string           `json:"target"`
+	Classes     []string         `json:"classes,omitempty"`
+	Features    []FeatureInfo    `json:"features"`
+	MaxFeatures int              `json:"max_features"`
+	OOBError    float64          `json:"oob_error"`
+	Importances []ImportanceInfo `json:"importances"`
+	Trees       []*Node          `json:"trees"`
+}
+
+// ImportanceInfo includes the importance of a feature as its share of
+// the impurity decrease of the splits, and as the increase of the
+// out-of-bag error when its values are permuted.
+type ImportanceInfo struct {
+	Feature     string  `json:"feature"`
+	Impurity    float64 `json:"impurity"`
+	Permutation float64 `json:"permutation"`
+}
+
+// FeatureInfo describes a feature column. The values of a
+// categorical feature are one of its levels.
+type FeatureInfo struct {
+	Name        string   `json:"name"`
+	Categorical bool     `json:"categorical"`
+	Levels      []string `json:"levels,omitempty"`
+}
+
+// Node is a node of the tree. Rows go left when their value of Feature
+// is at most Threshold or, for a categorical feature, is one of
+// Categories. Leaves have no children and predict Value, which for
+// classification is the index of Class, with Distribution holding the
+// proportion of each class.
+type Node struct {
+	Feature      string    `json:"feature,omitempty"`
+	Threshold    float64   `json:"threshold,omitempty"`
+	Categories   []string  `json:"categories,omitempty"`
+	Left         *Node     `json:"left,omitempty"`
+	Right        *Node     `json:"right,omitempty"`
+	Value        float64   `json:"value"`
+	Class        string    `json:"class,omitempty"`
+	Distribution []float64 `json:"distribution,omitempty"`
+	Samples      int       `json:"samples"`
+	Impurity     float64   `json:"impurity"`
+
+	feature int
+	left    map[int]bool
+}
+
+// Config holds the settings used to grow a tree. When MaxFeatures is
+// positive, each split only considers that many features, drawn at
+// random for every node.
+type Config struct {
+	Criterion   string
+	MaxDepth    int
+	MinLeaf     int
+	MaxFeatures int
+	Classes     int
+}
+
+// Dataset holds the encoded rows of a CSV file, where categorical values
+// are the index of their level and class labels the index of their class.
+type Dataset struct {
+	Features []FeatureInfo
+	X        [][]float64
+	Y        []float64
+}
+
+func main() {
+
+	// Declare the data flags.
+	inPtr := flag.String("in", "iris.csv", "The training data")
+	targetPtr := flag.String("target", "species", "The column to model")
+	categoricalPtr := flag.String("categorical", "", "Comma separated numeric columns to treat as categorical, in addition to any non-numeric columns")
+
+	// Declare the forest flags.
+	criterionPtr := flag.String("criterion", "gini", "The split criterion: gini or entropy for classification, mse or mae for regression")
+	treesPtr := flag.Int("trees", 100, "The number of trees")
+	maxFeaturesPtr := flag.Int("maxFeatures", 0, "The features considered at each split, or 0 for the square root of the features for classification and a third of them for regression")
+	maxDepthPtr := flag.Int("maxDepth", 0, "The maximum depth of each tree, or 0 for no limit")
+	minLeafPtr := flag.Int("minLeaf", 1, "The minimum number of samples in a leaf")
+	workersPtr := flag.Int("workers", runtime.NumCPU(), "The number of trees grown at once")
+	seedPtr := flag.Int64("seed", 1, "The seed from which each tree gets its own seed")
+	outPtr := flag.String("out", "forest.json", "The output file for the model")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	cfg := Config{
+		Criterion:   *criterionPtr,
+		MaxDepth:    *maxDepthPtr,
+		MinLeaf:     *minLeafPtr,
+		MaxFeatures: *maxFeaturesPtr,
+	}
+	classification, err := isClassification(cfg.Criterion)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *treesPtr < 1 || *workersPtr < 1 {
+		log.Fatal("the number of trees and workers must be positive")
+	}
+
+	// Read in the data.
+	data, classes, err := readData(*inPtr, *targetPtr, splitNames(*categoricalPtr), classification)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.Classes = len(classes)
+
+	if cfg.MaxFeatures <= 0 {
+		if classification {
+			cfg.MaxFeatures = int(math.Sqrt(float64(len(data.Features))))
+		} else {
+			cfg.MaxFeatures = len(data.Features) / 3
+		}
+		if cfg.MaxFeatures < 1 {
+			cfg.MaxFeatures = 1
+		}
+	}
+
+	// Grow the forest.
+	results := Forest(data, cfg, *treesPtr, *workersPtr, *seedPtr)
+
+	// Calculate the out-of-bag error and the feature importances.
+	oobError, covered := OOBError(data, cfg, results)
+	importances := Importances(data, results)
+
+	// Output the results to standard out.
+	fmt.Printf("\n%d trees considering %d of %d features at each split\n", len(results), cfg.MaxFeatures, len(data.Features))
+	fmt.Printf("%d of %d rows were out of bag for at least one tree\n", covered, len(data.Y))
+	switch {
+	case classification:
+		fmt.Printf("OOB error = %0.4f (accuracy %0.4f)\n", oobError, 1-oobError)
+	case cfg.Criterion == "mae":
+		fmt.Printf("OOB MAE = %0.4f\n", oobError)
+	default:
+		fmt.Printf("OOB MSE = %0.4f (R^2 %0.4f)\n", oobError, 1-oobError/variance(data.Y))
+	}
+
+	sorted := append([]ImportanceInfo(nil), importances...)
+	sort.SliceStable(sorted, func(a, b int) bool { return sorted[a].Permutation > sorted[b].Permutation })
+	fmt.Printf("\n%-16s %12s %12s\n", "feature", "impurity", "permutation")
+	for _, imp := range sorted {
+		fmt.Printf("%-16s %12.4f %12.4f\n", imp.Feature, imp.Impurity, imp.Permutation)
+	}
+	fmt.Println()
+
+	// Save the model, naming the class of each node.
+	model := ForestModel{
+		Criterion:   cfg.Criterion,
+		Target:      *targetPtr,
+		Classes:     classes,
+		Features:    data.Features,
+		MaxFeatures: cfg.MaxFeatures,
+		OOBError:    oobError,
+		Importances: importances,
+	}
+	for _, r := range results {
+		nameClasses(r.tree, classes)
+		model.Trees = append(model.Trees, r.tree)
+	}
+
+	outputData, err := json.MarshalIndent(model, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(*outPtr, outputData, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// treeResult holds a tree of the forest along with the rows left out
+// of its bootstrap sample and the increase of its error on those rows
+// when each feature is permuted.
+type treeResult struct {
+	tree     *Node
+	oob      []int
+	increase []float64
+}
+
+// Forest grows the trees on bootstrap samples with a pool of workers.
+// Each tree gets its own seed, drawn in order from the given seed, so
+// the forest does not depend on the number of workers or on the order
+// in which the trees finish.
+func Forest(data *Dataset, cfg Config, trees, workers int, seed int64) []treeResult {
+
+	master := rand.New(rand.NewSource(seed))
+	seeds := make([]int64, trees)
+	for t := range seeds {
+		seeds[t] = master.Int63()
+	}
+
+	results := make([]treeResult, trees)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range jobs {
+				results[t] = growTree(data, cfg, seeds[t])
+			}
+		}()
+	}
+	for t := 0; t < trees; t++ {
+		jobs <- t
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// growTree grows a tree on a bootstrap sample of the rows and measures
+// the permutation importance of each feature on the rows it left out.
+func growTree(data *Dataset, cfg Config, seed int64) treeResult {
+
+	rng := rand.New(rand.NewSource(seed))
+
+	// Draw the bootstrap sample.
+	n := len(data.Y)
+	inBag := make([]bool, n)
+	sample := make([]int, n)
+	for k := range sample {
+		sample[k] = rng.Intn(n)
+		inBag[sample[k]] = true
+	}
+
+	result := treeResult{
+		tree:     Grow(data, sample, cfg, rng),
+		increase: make([]float64, len(data.Features)),
+	}
+	for i, in := range inBag {
+		if !in {
+			result.oob = append(result.oob, i)
+		}
+	}
+	if len(result.oob) == 0 {
+		return result
+	}
+
+	// Permute each feature among the out-of-bag rows.
+	base := treeError(result.tree, data, cfg, result.oob, -1, nil)
+	for f := range data.Features {
+		result.increase[f] = treeError(result.tree, data, cfg, result.oob, f, rng.Perm(len(result.oob))) - base
+	}
+
+	return result
+}
+
+// treeError returns the mean loss of the tree on the rows, with the
+// values of feature f shuffled among them by perm when f is not -1.
+func treeError(tree *Node, data *Dataset, cfg Config, rows []int, f int, perm []int) float64 {
+
+	row := make([]float64, len(data.Features))
+	var sum float64
+	for k, i := range rows {
+		copy(row, data.X[i])
+		if f >= 0 {
+			row[f] = data.X[rows[perm[k]]][f]
+		}
+		sum += loss(cfg.Criterion, data.Y[i], Predict(tree, data.Features, row).Value)
+	}
+
+	return sum / float64(len(rows))
+}
+
+// aggregate combines the leaves that a row falls into: the mean class
+// distribution, with Value set to its most probable class, for
+// classification and the mean value for regression.
+func aggregate(leaves []*Node, classes int) *Node {
+
+	combined := &Node{}
+	if classes > 0 {
+		combined.Distribution = make([]float64, classes)
+	}
+	for _, leaf := range leaves {
+		for c, p := range leaf.Distribution {
+			combined.Distribution[c] += p / float64(len(leaves))
+		}
+		combined.Value += leaf.Value / float64(len(leaves))
+	}
+
+	if classes > 0 {
+		combined.Value = 0
+		for c, p := range combined.Distribution {
+			if p > combined.Distribution[int(combined.Value)] {
+				combined.Value = float64(c)
+			}
+		}
+	}
+
+	return combined
+}
+
+// OOBError predicts each row with the trees that did not see it and
+// returns the mean loss of those predictions along with the number of
+// rows that were out of bag for at least one tree.
+func OOBError(data *Dataset, cfg Config, results []treeResult) (float64, int) {
+
+	leaves := make([][]*Node, len(data.Y))
+	for _, r := range results {
+		for _, i := range r.oob {
+			leaves[i] = append(leaves[i], Predict(r.tree, data.Features, data.X[i]))
+		}
+	}
+
+	var sum float64
+	var covered int
+	for i, l := range leaves {
+		if len(l) == 0 {
+			continue
+		}
+		covered++
+		sum += loss(cfg.Criterion, data.Y[i], aggregate(l, cfg.Classes).Value)
+	}
+	if covered == 0 {
+		return math.NaN(), 0
+	}
+
+	return sum / float64(covered), covered
+}
+
+// Importances returns the impurity importance of each feature, which is
+// its share of the weighted impurity decrease of each tree averaged over
+// the trees, and its permutation importance, which is the increase of
+// the out-of-bag error of each tree averaged over the trees.
+func Importances(data *Dataset, results []treeResult) []ImportanceInfo {
+
+	importances := make([]ImportanceInfo, len(data.Features))
+	for f, feature := range data.Features {
+		importances[f].Feature = feature.Name
+	}
+
+	decrease := make([]float64, len(data.Features))
+	for _, r := range results {
+		for f := range decrease {
+			decrease[f] = 0
+		}
+		impurityDecrease(r.tree, decrease)
+
+		var total float64
+		for _, d := range decrease {
+			total += d
+		}
+		for f, d := range decrease {
+			if total > 0 {
+				importances[f].Impurity += d / total / float64(len(results))
+			}
+			importances[f].Permutation += r.increase[f] / float64(len(results))
+		}
+	}
+
+	return importances
+}
+
+// impurityDecrease adds the decrease of the weighted impurity at each
+// split of the tree to the total of its feature.
+func impurityDecrease(node *Node, total []float64) {
+	if node.Left == nil {
+		return
+	}
+	total[node.feature] += node.Impurity*float64(node.Samples) -
+		node.Left.Impurity*float64(node.Left.Samples) -
+		node.Right.Impurity*float64(node.Right.Samples)
+	impurityDecrease(node.Left, total)
+	impurityDecrease(node.Right, total)
+}
+
+// variance returns the population variance of the values.
+func variance(values []float64) float64 {
+	var mean, sumSq float64
+	for _, v := range values {
+		mean += v / float64(len(values))
+	}
+	for _, v := range values {
+		sumSq += (v - mean) * (v - mean)
+	}
+	return sumSq / float64(len(values))
+}
+
+// Grow recursively grows a tree on the rows in idx, splitting each node
+// on the feature and split that most reduce the impurity, until a node
+// is pure, reaches the maximum depth or cannot be split with at least
+// the minimum number of samples in each leaf. The features considered
+// at each node are drawn with rng.
+func Grow(data *Dataset, idx []int, cfg Config, rng *rand.Rand) *Node {
+	return grow(data, idx, cfg, rng, 0)
+}
+
+func grow(data *Dataset, idx []int, cfg Config, rng *rand.Rand, level int) *Node {
+
+	node := leafNode(data, idx, cfg)
+	if node.Impurity <= 1e-12 || (cfg.MaxDepth > 0 && level >= cfg.MaxDepth) || len(idx) < 2*cfg.MinLeaf {
+		return node
+	}
+
+	// Find the best split over the features considered at this node.
+	candidates := rng.Perm(len(data.Features))
+	if cfg.MaxFeatures > 0 && cfg.MaxFeatures < len(candidates) {
+		candidates = candidates[:cfg.MaxFeatures]
+	}
+
+	bestCost := node.Impurity * float64(len(idx))
+	found := false
+	for _, f := range candidates {
+		feature := data.Features[f]
+		var s split
+		if feature.Categorical {
+			s = categoricalSplit(data, idx, f, cfg)
+		} else {
+			s = numericSplit(data, idx, f, cfg)
+		}
+		if s.ok && s.cost < bestCost-1e-12 {
+			bestCost, found = s.cost, true
+			node.feature = f
+			node.Feature = feature.Name
+			node.Threshold = s.threshold
+			node.left = s.left
+		}
+	}
+	if !found {
+		return node
+	}
+
+	// Partition the rows and grow the children.
+	var leftIdx, rightIdx []int
+	for _, i := range idx {
+		if goesLeft(node, data.Features, data.X[i]) {
+			leftIdx = append(leftIdx, i)
+		} else {
+			rightIdx = append(rightIdx, i)
+		}
+	}
+	if node.left != nil {
+		for l := range node.left {
+			node.Categories = append(node.Categories, data.Features[node.feature].Levels[l])
+		}
+		sort.Strings(node.Categories)
+	}
+
+	node.Left = grow(data, leftIdx, cfg, rng, level+1)
+	node.Right = grow(data, rightIdx, cfg, rng, level+1)
+
+	return node
+}
+
+// leafNode returns a leaf predicting the rows in idx.
+func leafNode(data *Dataset, idx []int, cfg Config) *Node {
+
+	acc := newAccumulator(cfg)
+	for _, i := range idx {
+		acc.add(data.Y[i])
+	}
+
+	node := &Node{
+		Samples:  len(idx),
+		Impurity: acc.impurity(),
+		feature:  -1,
+	}
+
+	switch a := acc.(type) {
+	case *classAccumulator:
+		node.Distribution = make([]float64, len(a.counts))
+		for c, count := range a.counts {
+			node.Distribution[c] = count / a.n
+			if count > a.counts[int(node.Value)] {
+				node.Value = float64(c)
+			}
+		}
+	case *mseAccumulator:
+		node.Value = a.sum / a.n
+	case *maeAccumulator:
+		node.Value = median(a.values)
+	}
+
+	return node
+}
+
+// split is a candidate split of a node, with the sum of the
+// impurities of its children weighted by their samples.
+type split struct {
+	ok        bool
+	cost      float64
+	threshold float64
+	left      map[int]bool
+}
+
+// numericSplit finds the best threshold of feature f, halfway
+// between consecutive distinct values.
+func numericSplit(data *Dataset, idx []int, f int, cfg Config) split {
+
+	sorted := append([]int(nil), idx...)
+	sort.Slice(sorted, func(a, b int) bool { return data.X[sorted[a]][f] < data.X[sorted[b]][f] })
+
+	left, right := newAccumulator(cfg), newAccumulator(cfg)
+	for _, i := range sorted {
+		right.add(data.Y[i])
+	}
+
+	var best split
+	for k := 0; k < len(sorted)-1; k++ {
+		left.add(data.Y[sorted[k]])
+		right.remove(data.Y[sorted[k]])
+
+		x, next := data.X[sorted[k]][f], data.X[sorted[k+1]][f]
+		if x == next || k+1 < cfg.MinLeaf || len(sorted)-k-1 < cfg.MinLeaf {
+			continue
+		}
+
+		cost := left.impurity()*left.count() + right.impurity()*right.count()
+		if !best.ok || cost < best.cost {
+			best = split{ok: true, cost: cost, threshold: (x + next) / 2}
+		}
+	}
+
+	return best
+}
+
+// categoricalSplit finds the best subset of the levels of feature f to
+// send left. For regression and binary classification the levels are
+// ordered by their mean target and only splits along that order are
+// tried, which finds the best subset. For more classes every subset is
+// tried when there are few levels, and otherwise the levels are ordered
+// by the proportion of the most common class.
+func categoricalSplit(data *Dataset, idx []int, f int, cfg Config) split {
+
+	// Group the rows by level.
+	groups := make(map[int][]int)
+	for _, i := range idx {
+		level := int(data.X[i][f])
+		groups[level] = append(groups[level], i)
+	}
+	if len(groups) < 2 {
+		return split{}
+	}
+	var levels []int
+	for level := range groups {
+		levels = append(levels, level)
+	}
+	sort.Ints(levels)
+
+	evaluate := func(left map[int]bool) split {
+		l, r := newAccumulator(cfg), newAccumulator(cfg)
+		for _, level := range levels {
+			acc := r
+			if left[level] {
+				acc = l
+			}
+			for _, i := range groups[level] {
+				acc.add(data.Y[i])
+			}
+		}
+		if int(l.count()) < cfg.MinLeaf || int(r.count()) < cfg.MinLeaf {
+			return split{}
+		}
+		return split{ok: true, cost: l.impurity()*l.count() + r.impurity()*r.count(), left: left}
+	}
+
+	var best split
+	consider := func(s split) {
+		if s.ok && (!best.ok || s.cost < best.cost) {
+			best = s
+		}
+	}
+
+	// Try every subset, keeping the last level on the right
+	// so that each split is only tried once.
+	if cfg.Classes > 2 && len(levels) <= 10 {
+		for mask := 1; mask < 1<<uint(len(levels)-1); mask++ {
+			left := make(map[int]bool)
+			for b, level := range levels[:len(levels)-1] {
+				if mask&(1<<uint(b)) != 0 {
+					left[level] = true
+				}
+			}
+			consider(evaluate(left))
+		}
+		return best
+	}
+
+	// Order the levels and try each prefix.
+	ordering := 1
+	if cfg.Classes > 2 {
+		ordering = majority(data, idx, cfg.Classes)
+	}
+	key := make(map[int]float64)
+	for _, level := range levels {
+		acc := newAccumulator(cfg)
+		for _, i := range groups[level] {
+			acc.add(data.Y[i])
+		}
+		switch a := acc.(type) {
+		case *classAccumulator:
+			key[level] = a.counts[ordering] / a.n
+		case *mseAccumulator:
+			key[level] = a.sum / a.n
+		case *maeAccumulator:
+			key[level] = median(a.values)
+		}
+	}
+	sort.SliceStable(levels, func(a, b int) bool { return key[levels[a]] < key[levels[b]] })
+
+	left := make(map[int]bool)
+	for _, level := range levels[:len(levels)-1] {
+		left[level] = true
+		prefix := make(map[int]bool)
+		for l := range left {
+			prefix[l] = true
+		}
+		consider(evaluate(prefix))
+	}
+
+	return best
+}
+
+// majority returns the most common class of the rows in idx.
+func majority(data *Dataset, idx []int, classes int) int {
+	counts := make([]int, classes)
+	best := 0
+	for _, i := range idx {
+		c := int(data.Y[i])
+		counts[c]++
+		if counts[c] > counts[best] {
+			best = c
+		}
+	}
+	return best
+}
+
+// accumulator keeps track of the impurity of a set of targets
+// as they are added and removed.
+type accumulator interface {
+	add(y float64)
+	remove(y float64)
+	count() float64
+	impurity() float64
+}
+
+func newAccumulator(cfg Config) accumulator {
+	switch cfg.Criterion {
+	case "gini", "entropy":
+		return &classAccumulator{counts: make([]float64, cfg.Classes), entropy: cfg.Criterion == "entropy"}
+	case "mae":
+		return &maeAccumulator{}
+	default:
+		return &mseAccumulator{}
+	}
+}
+
+// classAccumulator calculates the Gini impurity, 1 - Σp², or
+// the entropy, -Σp·log₂p, of the class counts.
+type classAccumulator struct {
+	counts  []float64
+	n       float64
+	entropy bool
+}
+
+func (a *classAccumulator) add(y float64)    { a.counts[int(y)]++; a.n++ }
+func (a *classAccumulator) remove(y float64) { a.counts[int(y)]--; a.n-- }
+func (a *classAccumulator) count() float64   { return a.n }
+
+func (a *classAccumulator) impurity() float64 {
+	if a.n == 0 {
+		return 0
+	}
+	var sum float64
+	for _, count := range a.counts {
+		p := count / a.n
+		if a.entropy {
+			if p > 0 {
+				sum -= p * math.Log2(p)
+			}
+		} else {
+			sum += p * p
+		}
+	}
+	if a.entropy {
+		return sum
+	}
+	return 1 - sum
+}
+
+// mseAccumulator calculates the variance of the targets,
+// which is their mean squared error about their mean.
+type mseAccumulator struct {
+	sum, sumSq, n float64
+}
+
+func (a *mseAccumulator) add(y float64)    { a.sum += y; a.sumSq += y * y; a.n++ }
+func (a *mseAccumulator) remove(y float64) { a.sum -= y; a.sumSq -= y * y; a.n-- }
+func (a *mseAccumulator) count() float64   { return a.n }
+
+func (a *mseAccumulator) impurity() float64 {
+	if a.n == 0 {
+		return 0
+	}
+	mean := a.sum / a.n
+	return math.Max(a.sumSq/a.n-mean*mean, 0)
+}
+
+// maeAccumulator calculates the mean absolute error of
+// the targets about their median.
+type maeAccumulator struct {
+	values []float64
+}
+
+func (a *maeAccumulator) add(y float64)  { a.values = append(a.values, y) }
+func (a *maeAccumulator) count() float64 { return float64(len(a.values)) }
+
+func (a *maeAccumulator) remove(y float64) {
+	for i, v := range a.values {
+		if v == y {
+			a.values = append(a.values[:i], a.values[i+1:]...)
+			return
+		}
+	}
+}
+
+func (a *maeAccumulator) impurity() float64 {
+	if len(a.values) == 0 {
+		return 0
+	}
+	m := median(a.values)
+	var sum float64
+	for _, v := range a.values {
+		sum += math.Abs(v - m)
+	}
+	return sum / float64(len(a.values))
+}
+
+// median returns the median of the values without reordering them.
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// goesLeft reports whether a row goes to the left child of a node.
+func goesLeft(node *Node, features []FeatureInfo, row []float64) bool {
+	if features[node.feature].Categorical {
+		return node.left[int(row[node.feature])]
+	}
+	return row[node.feature] <= node.Threshold
+}
+
+// Predict returns the leaf that a row falls into.
+func Predict(node *Node, features []FeatureInfo, row []float64) *Node {
+	for node.Left != nil {
+		if goesLeft(node, features, row) {
+			node = node.Left
+		} else {
+			node = node.Right
+		}
+	}
+	return node
+}
+
+// loss returns the error of a prediction under the criterion: the
+// misclassification for classification and the squared or absolute
+// error for regression.
+func loss(criterion string, observed, predicted float64) float64 {
+	switch criterion {
+	case "gini", "entropy":
+		if observed == predicted {
+			return 0
+		}
+		return 1
+	case "mae":
+		return math.Abs(observed - predicted)
+	default:
+		return (observed - predicted) * (observed - predicted)
+	}
+}
+
+// nameClasses sets the class of each node of a classification tree.
+func nameClasses(node *Node, classes []string) {
+	if classes == nil {
+		return
+	}
+	node.Class = classes[int(node.Value)]
+	if node.Left != nil {
+		nameClasses(node.Left, classes)
+		nameClasses(node.Right, classes)
+	}
+}
+
+// isClassification reports whether the criterion is for classification.
+func isClassification(criterion string) (bool, error) {
+	switch criterion {
+	case "gini", "entropy":
+		return true, nil
+	case "mse", "mae":
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown criterion %s", criterion)
+}
+
+// splitNames splits a comma separated list of column names.
+func splitNames(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// readData reads a CSV file with a header into a dataset, treating the
+// named columns and any non-numeric columns as categorical. For
+// classification the target is encoded as the index of its class in
+// the returned classes.
+func readData(path, target string, categorical []string, classification bool) (*Dataset, []string, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) < 2 {
+		return nil, nil, errors.New("expected a header and at least one row")
+	}
+	header, rows := records[0], records[1:]
+
+	targetCol := -1
+	for j, name := range header {
+		if name == target {
+			targetCol = j
+		}
+	}
+	if targetCol < 0 {
+		return nil, nil, fmt.Errorf("target column %s not found", target)
+	}
+
+	isCategorical := make(map[string]bool)
+	for _, name := range categorical {
+		isCategorical[name] = true
+	}
+
+	// levels returns the sorted distinct values of a column.
+	levels := func(col int) []string {
+		seen := make(map[string]bool)
+		var values []string
+		for _, row := range rows {
+			if !seen[row[col]] {
+				seen[row[col]] = true
+				values = append(values, row[col])
+			}
+		}
+		sort.Strings(values)
+		return values
+	}
+
+	// Work out the type of each feature column.
+	data := &Dataset{}
+	var cols []int
+	for j, name := range header {
+		if j == targetCol {
+			continue
+		}
+		feature := FeatureInfo{Name: name, Categorical: isCategorical[name]}
+		for _, row := range rows {
+			if _, err := strconv.ParseFloat(row[j], 64); err != nil {
+				feature.Categorical = true
+				break
+			}
+		}
+		if feature.Categorical {
+			feature.Levels = levels(j)
+		}
+		data.Features = append(data.Features, feature)
+		cols = append(cols, j)
+	}
+
+	var classes []string
+	classIndex := make(map[string]int)
+	if classification {
+		classes = levels(targetCol)
+		for c, class := range classes {
+			classIndex[class] = c
+		}
+	}
+
+	// Encode the rows.
+	for i, row := range rows {
+		x := make([]float64, len(cols))
+		for k, j := range cols {
+			feature := data.Features[k]
+			if feature.Categorical {
+				x[k] = float64(sort.SearchStrings(feature.Levels, row[j]))
+				continue
+			}
+			x[k], _ = strconv.ParseFloat(row[j], 64)
+		}
+
+		var y float64
+		if classification {
+			y = float64(classIndex[row[targetCol]])
+		} else if y, err = strconv.ParseFloat(row[targetCol], 64); err != nil {
+			return nil, nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+		}
+
+		data.X = append(data.X, x)
+		data.Y = append(data.Y, y)
+	}
+
+	return data, classes, nil
+}
@@ -0,0 +1,850 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+// Model is a model that can be fit to training data and then
+// make a prediction for a new observation.
+type Model interface {
+	Fit(features [][]float64, labels []float64) error
+	Predict(features []float64) (float64, error)
+}
+
+// Fold includes the training and test row indices of one fold.
+type Fold struct {
+	Train []int
+	Test  []int
+}
+
+// Metric scores the predictions of a model against the observed values.
+type Metric struct {
+	Name string
+	Fn   func(observed, predicted []float64) float64
+}
+
+// Score includes the value of a metric on each fold along with
+// its mean and standard deviation over the folds.
+type Score struct {
+	Name   string
+	Folds  []float64
+	Mean   float64
+	StdDev float64
+}
+
+// BoostedModel includes the information about the fitted
+// ensemble that is output from the training. The prediction
+// is Init plus LearningRate times the sum of the trees, which
+// is the log odds of class 1 for the logistic loss.
+type BoostedModel struct {
+	Loss           string      `json:"loss"`
+	LearningRate   float64     `json:"learning_rate"`
+	Init           float64     `json:"init"`
+	Features       []string    `json:"features"`
+	Trees          []*TreeNode `json:"trees"`
+	ValidationLoss []float64   `json:"validation_loss,omitempty"`
+}
+
+// TreeNode is a node of a regression tree. Rows go left when their
+// value of Feature is at most Threshold, and leaves have no children.
+type TreeNode struct {
+	Feature   string    `json:"feature,omitempty"`
+	Threshold float64   `json:"threshold,omitempty"`
+	Left      *TreeNode `json:"left,omitempty"`
+	Right     *TreeNode `json:"right,omitempty"`
+	Value     float64   `json:"value"`
+
+	index int
+	rows  []int
+}
+
+// Booster fits gradient boosted regression trees. Each tree is fit to
+// the negative gradient of the loss on a subsample of the rows, using
+// histograms of binned feature values to find the splits, and its
+// leaves are then set to the step that most reduces the loss.
+type Booster struct {
+	Loss               string
+	Trees              int
+	LearningRate       float64
+	MaxDepth           int
+	MinLeaf            int
+	Subsample          float64
+	Bins               int
+	ValidationFraction float64
+	Patience           int
+	HuberAlpha         float64
+	Seed               int64
+
+	Model *BoostedModel
+}
+
+func main() {
+
+	// Declare the data flags.
+	inPtr := flag.String("in", "diabetes.csv", "The training data")
+	targetPtr := flag.String("target", "y", "The column to model")
+	featuresPtr := flag.String("features", "", "Comma separated feature columns, or empty for every column except the target")
+
+	// Declare the boosting flags.
+	lossPtr := flag.String("loss", "squared", "The loss: squared, absolute, huber or logistic")
+	treesPtr := flag.Int("trees", 500, "The maximum number of trees")
+	learningRatePtr := flag.Float64("learningRate", 0.05, "The shrinkage applied to each tree")
+	maxDepthPtr := flag.Int("maxDepth", 3, "The depth of each tree")
+	minLeafPtr := flag.Int("minLeaf", 10, "The minimum number of rows in a leaf")
+	subsamplePtr := flag.Float64("subsample", 0.8, "The fraction of the rows used to fit each tree")
+	binsPtr := flag.Int("bins", 64, "The maximum number of histogram bins per feature")
+	validationPtr := flag.Float64("validation", 0.1, "The fraction of the rows held out for early stopping, or 0 to use every tree")
+	patiencePtr := flag.Int("patience", 20, "The trees without a better validation loss before stopping")
+	huberAlphaPtr := flag.Float64("huberAlpha", 0.9, "The quantile of the absolute residuals beyond which the Huber loss is linear")
+	seedPtr := flag.Int64("seed", 1, "The seed of the subsamples, validation rows and folds")
+
+	// Declare the cross validation and output flags.
+	foldsPtr := flag.Int("folds", 5, "The number of cross validation folds, or 0 to skip the cross validation")
+	workersPtr := flag.Int("workers", runtime.NumCPU(), "The number of folds evaluated in parallel")
+	outPtr := flag.String("out", "model.json", "The output file for the model")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Read in the data.
+	features, x, y, err := readData(*inPtr, *targetPtr, *featuresPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	newBooster := func() *Booster {
+		return &Booster{
+			Loss:               *lossPtr,
+			Trees:              *treesPtr,
+			LearningRate:       *learningRatePtr,
+			MaxDepth:           *maxDepthPtr,
+			MinLeaf:            *minLeafPtr,
+			Subsample:          *subsamplePtr,
+			Bins:               *binsPtr,
+			ValidationFraction: *validationPtr,
+			Patience:           *patiencePtr,
+			HuberAlpha:         *huberAlphaPtr,
+			Seed:               *seedPtr,
+		}
+	}
+
+	// Cross validate the booster.
+	if *foldsPtr > 0 {
+		metrics := []Metric{{"MAE", mae}, {"RMSE", rmse}, {"R^2", rSquared}}
+		if *lossPtr == "logistic" {
+			metrics = []Metric{{"Accuracy", accuracy}}
+		}
+
+		folds, err := KFold(len(y), *foldsPtr, *seedPtr)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		scores, err := CrossValidate(func() Model { return newBooster() }, x, y, folds, metrics, *workersPtr)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("\nGradient boosting, %s loss (%d folds)\n", *lossPtr, len(folds))
+		for _, s := range scores {
+			fmt.Printf("  %-8s %10.4f (+/- %0.4f)\n", s.Name, s.Mean, s.StdDev)
+		}
+	}
+
+	// Fit the booster on all of the data.
+	booster := newBooster()
+	if err := booster.Fit(x, y); err != nil {
+		log.Fatal(err)
+	}
+	booster.Model.Features = features
+	nameFeatures(booster.Model.Trees, features)
+
+	fmt.Printf("\nKept %d trees", len(booster.Model.Trees))
+	if v := booster.Model.ValidationLoss; len(v) > 0 {
+		fmt.Printf(" with validation %s %0.4f", validationMetric(*lossPtr), v[len(booster.Model.Trees)-1])
+	}
+	fmt.Print("\n\n")
+
+	// Save the model.
+	outputData, err := json.MarshalIndent(booster.Model, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(*outPtr, outputData, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Fit boosts the trees on the features and labels. When a validation
+// fraction and patience are set, those rows are held out and boosting
+// stops once the validation loss has not improved for that many trees,
+// keeping the trees up to the best one.
+func (b *Booster) Fit(features [][]float64, labels []float64) error {
+
+	switch b.Loss {
+	case "squared", "absolute", "huber":
+	case "logistic":
+		for _, y := range labels {
+			if y != 0 && y != 1 {
+				return errors.New("the logistic loss needs labels of 0 or 1")
+			}
+		}
+	default:
+		return fmt.Errorf("unknown loss %s", b.Loss)
+	}
+	if len(features) == 0 || len(features) != len(labels) {
+		return errors.New("there must be one label per row of features")
+	}
+
+	rng := rand.New(rand.NewSource(b.Seed))
+
+	// Hold out the validation rows.
+	var train, valid []int
+	perm := rng.Perm(len(labels))
+	holdout := 0
+	if b.ValidationFraction > 0 && b.Patience > 0 {
+		holdout = int(math.Round(b.ValidationFraction * float64(len(labels))))
+	}
+	valid, train = perm[:holdout], perm[holdout:]
+	sort.Ints(train)
+	if len(train) < 2*b.MinLeaf {
+		return errors.New("not enough training rows")
+	}
+
+	// Bin the features using the training rows.
+	trainX := make([][]float64, len(train))
+	for k, i := range train {
+		trainX[k] = features[i]
+	}
+	edges := binEdges(trainX, b.Bins)
+	binned := make([][]int, len(features))
+	for i, row := range features {
+		binned[i] = make([]int, len(row))
+		for f, v := range row {
+			binned[i][f] = sort.SearchFloat64s(edges[f], v)
+		}
+	}
+
+	// Start from the constant that minimizes the loss.
+	trainY := make([]float64, len(train))
+	for k, i := range train {
+		trainY[k] = labels[i]
+	}
+	b.Model = &BoostedModel{
+		Loss:         b.Loss,
+		LearningRate: b.LearningRate,
+		Init:         initialValue(b.Loss, trainY),
+	}
+
+	current := make([]float64, len(labels))
+	for i := range current {
+		current[i] = b.Model.Init
+	}
+
+	gradient := make([]float64, len(labels))
+	sampleSize := int(math.Max(math.Round(b.Subsample*float64(len(train))), float64(2*b.MinLeaf)))
+	if sampleSize > len(train) {
+		sampleSize = len(train)
+	}
+
+	best := 0
+	for t := 0; t < b.Trees; t++ {
+
+		// Subsample the training rows.
+		sample := append([]int(nil), train...)
+		rng.Shuffle(len(sample), func(i, j int) { sample[i], sample[j] = sample[j], sample[i] })
+		sample = sample[:sampleSize]
+
+		// Fit a tree to the negative gradient and set its leaves.
+		delta := negativeGradient(b.Loss, b.HuberAlpha, labels, current, sample, gradient)
+		tree := b.grow(binned, edges, gradient, sample, 0)
+		setLeaves(tree, b.Loss, delta, labels, current)
+		b.Model.Trees = append(b.Model.Trees, tree)
+
+		for i := range current {
+			current[i] += b.LearningRate * predictTree(tree, features[i])
+		}
+
+		// Check the validation loss for early stopping.
+		if len(valid) == 0 {
+			continue
+		}
+		var sum float64
+		for _, i := range valid {
+			sum += validationLoss(b.Loss, labels[i], current[i])
+		}
+		b.Model.ValidationLoss = append(b.Model.ValidationLoss, sum/float64(len(valid)))
+		if b.Model.ValidationLoss[t] < b.Model.ValidationLoss[best] {
+			best = t
+		}
+		if t-best >= b.Patience {
+			break
+		}
+	}
+
+	if len(valid) > 0 {
+		b.Model.Trees = b.Model.Trees[:best+1]
+		b.Model.ValidationLoss = b.Model.ValidationLoss[:best+1]
+	}
+	for _, tree := range b.Model.Trees {
+		clearRows(tree)
+	}
+
+	return nil
+}
+
+// Predict predicts the value of an observation, or its class,
+// 0 or 1, for the logistic loss.
+func (b *Booster) Predict(features []float64) (float64, error) {
+
+	if b.Model == nil {
+		return 0, errors.New("the booster has not been fit")
+	}
+
+	raw := b.Model.Raw(features)
+	if b.Loss == "logistic" {
+		if raw >= 0 {
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	return raw, nil
+}
+
+// Raw returns the initial value plus the shrunken sum of the trees.
+func (m *BoostedModel) Raw(features []float64) float64 {
+	raw := m.Init
+	for _, tree := range m.Trees {
+		raw += m.LearningRate * predictTree(tree, features)
+	}
+	return raw
+}
+
+// grow grows a regression tree to the gradient of the rows, choosing
+// each split from histograms of the gradient over the feature bins.
+func (b *Booster) grow(binned [][]int, edges [][]float64, gradient []float64, rows []int, depth int) *TreeNode {
+
+	node := &TreeNode{index: -1, rows: rows}
+	if depth >= b.MaxDepth || len(rows) < 2*b.MinLeaf {
+		return node
+	}
+
+	var total float64
+	for _, i := range rows {
+		total += gradient[i]
+	}
+	n := float64(len(rows))
+
+	// Find the split that most reduces the squared error, which is
+	// the split maximizing sumL²/nL + sumR²/nR.
+	bestGain, bestBin := 1e-12, -1
+	for f := range edges {
+		bins := len(edges[f]) + 1
+		if bins < 2 {
+			continue
+		}
+
+		sums := make([]float64, bins)
+		counts := make([]int, bins)
+		for _, i := range rows {
+			sums[binned[i][f]] += gradient[i]
+			counts[binned[i][f]]++
+		}
+
+		var sumL float64
+		var countL int
+		for bin := 0; bin < bins-1; bin++ {
+			sumL += sums[bin]
+			countL += counts[bin]
+			countR := len(rows) - countL
+			if countL < b.MinLeaf || countR < b.MinLeaf {
+				continue
+			}
+
+			sumR := total - sumL
+			gain := sumL*sumL/float64(countL) + sumR*sumR/float64(countR) - total*total/n
+			if gain > bestGain {
+				bestGain, bestBin = gain, bin
+				node.index = f
+			}
+		}
+	}
+	if bestBin < 0 {
+		return node
+	}
+
+	// Partition the rows and grow the children.
+	node.Threshold = edges[node.index][bestBin]
+	var left, right []int
+	for _, i := range rows {
+		if binned[i][node.index] <= bestBin {
+			left = append(left, i)
+		} else {
+			right = append(right, i)
+		}
+	}
+	node.rows = nil
+	node.Left = b.grow(binned, edges, gradient, left, depth+1)
+	node.Right = b.grow(binned, edges, gradient, right, depth+1)
+
+	return node
+}
+
+// binEdges returns the upper edges of the bins of each feature. Features
+// with no more distinct values than bins get an edge between each pair
+// of values, and others get edges at evenly spaced quantiles, so that a
+// value falls in the bin of the first edge that is not below it.
+func binEdges(x [][]float64, bins int) [][]float64 {
+
+	edges := make([][]float64, len(x[0]))
+	values := make([]float64, len(x))
+	for f := range edges {
+		for i, row := range x {
+			values[i] = row[f]
+		}
+		sort.Float64s(values)
+
+		var distinct []float64
+		for i, v := range values {
+			if i == 0 || v != values[i-1] {
+				distinct = append(distinct, v)
+			}
+		}
+
+		if len(distinct) <= bins {
+			for k := 0; k < len(distinct)-1; k++ {
+				edges[f] = append(edges[f], (distinct[k]+distinct[k+1])/2)
+			}
+			continue
+		}
+
+		for k := 1; k < bins; k++ {
+			q := stat.Quantile(float64(k)/float64(bins), stat.Empirical, values, nil)
+			if q < values[len(values)-1] && (len(edges[f]) == 0 || q > edges[f][len(edges[f])-1]) {
+				edges[f] = append(edges[f], q)
+			}
+		}
+	}
+
+	return edges
+}
+
+// initialValue returns the constant that minimizes the loss: the mean,
+// the median or the log odds of class 1.
+func initialValue(loss string, labels []float64) float64 {
+	switch loss {
+	case "absolute", "huber":
+		return median(labels)
+	case "logistic":
+		p := stat.Mean(labels, nil)
+		p = math.Min(math.Max(p, 1e-6), 1-1e-6)
+		return math.Log(p / (1 - p))
+	default:
+		return stat.Mean(labels, nil)
+	}
+}
+
+// negativeGradient fills in the negative gradient of the loss for the
+// rows, returning the Huber threshold, which is the alpha quantile of
+// the absolute residuals of the rows.
+func negativeGradient(loss string, alpha float64, labels, current []float64, rows []int, gradient []float64) float64 {
+
+	var delta float64
+	if loss == "huber" {
+		abs := make([]float64, len(rows))
+		for k, i := range rows {
+			abs[k] = math.Abs(labels[i] - current[i])
+		}
+		sort.Float64s(abs)
+		delta = stat.Quantile(alpha, stat.Empirical, abs, nil)
+	}
+
+	for _, i := range rows {
+		r := labels[i] - current[i]
+		switch loss {
+		case "absolute":
+			gradient[i] = sign(r)
+		case "huber":
+			if math.Abs(r) <= delta {
+				gradient[i] = r
+			} else {
+				gradient[i] = delta * sign(r)
+			}
+		case "logistic":
+			gradient[i] = labels[i] - sigmoid(current[i])
+		default:
+			gradient[i] = r
+		}
+	}
+
+	return delta
+}
+
+// setLeaves sets the value of each leaf to the step that reduces the loss
+// of its rows: the mean or median of the residuals, the median plus the
+// mean of the clipped deviations from it for the Huber loss, or a
+// Newton step for the logistic loss.
+func setLeaves(node *TreeNode, loss string, delta float64, labels, current []float64) {
+
+	if node.Left != nil {
+		setLeaves(node.Left, loss, delta, labels, current)
+		setLeaves(node.Right, loss, delta, labels, current)
+		return
+	}
+
+	residuals := make([]float64, len(node.rows))
+	for k, i := range node.rows {
+		residuals[k] = labels[i] - current[i]
+	}
+
+	switch loss {
+	case "absolute":
+		node.Value = median(residuals)
+	case "huber":
+		m := median(residuals)
+		var sum float64
+		for _, r := range residuals {
+			sum += sign(r-m) * math.Min(delta, math.Abs(r-m))
+		}
+		node.Value = m + sum/float64(len(residuals))
+	case "logistic":
+		var num, den float64
+		for _, i := range node.rows {
+			p := sigmoid(current[i])
+			num += labels[i] - p
+			den += p * (1 - p)
+		}
+		node.Value = num / math.Max(den, 1e-12)
+	default:
+		node.Value = stat.Mean(residuals, nil)
+	}
+}
+
+// validationLoss returns the loss of a prediction used for early
+// stopping: the squared error, the absolute error for the absolute
+// and Huber losses, or the log loss.
+func validationLoss(loss string, label, raw float64) float64 {
+	switch loss {
+	case "absolute", "huber":
+		return math.Abs(label - raw)
+	case "logistic":
+		p := math.Min(math.Max(sigmoid(raw), 1e-15), 1-1e-15)
+		return -label*math.Log(p) - (1-label)*math.Log(1-p)
+	default:
+		return (label - raw) * (label - raw)
+	}
+}
+
+// validationMetric names the validation loss.
+func validationMetric(loss string) string {
+	switch loss {
+	case "absolute", "huber":
+		return "MAE"
+	case "logistic":
+		return "log loss"
+	default:
+		return "MSE"
+	}
+}
+
+// predictTree returns the value of the leaf that a row falls into.
+func predictTree(node *TreeNode, features []float64) float64 {
+	for node.Left != nil {
+		if features[node.index] <= node.Threshold {
+			node = node.Left
+		} else {
+			node = node.Right
+		}
+	}
+	return node.Value
+}
+
+// nameFeatures sets the feature name of each split of the trees.
+func nameFeatures(trees []*TreeNode, names []string) {
+	var walk func(node *TreeNode)
+	walk = func(node *TreeNode) {
+		if node.Left == nil {
+			return
+		}
+		node.Feature = names[node.index]
+		walk(node.Left)
+		walk(node.Right)
+	}
+	for _, tree := range trees {
+		walk(tree)
+	}
+}
+
+// clearRows releases the training rows held by the leaves.
+func clearRows(node *TreeNode) {
+	node.rows = nil
+	if node.Left != nil {
+		clearRows(node.Left)
+		clearRows(node.Right)
+	}
+}
+
+func sigmoid(z float64) float64 {
+	return 1 / (1 + math.Exp(-z))
+}
+
+func sign(v float64) float64 {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
+
+// median returns the median of the values without reordering them.
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// CrossValidate fits a new model on the training rows of each fold and
+// scores its predictions for the test rows with each of the metrics.
+// The folds are evaluated in parallel using the given number of
+// goroutines.
+func CrossValidate(newModel func() Model, features [][]float64, labels []float64, folds []Fold, metrics []Metric, workers int) ([]Score, error) {
+
+	if len(features) != len(labels) {
+		return nil, errors.New("there must be one label per row of features")
+	}
+	if len(folds) == 0 {
+		return nil, errors.New("at least one fold is required")
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	values := make([][]float64, len(folds))
+	errs := make([]error, len(folds))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				values[f], errs[f] = evaluateFold(newModel(), features, labels, folds[f], metrics)
+			}
+		}()
+	}
+
+	for f := range folds {
+		jobs <- f
+	}
+	close(jobs)
+	wg.Wait()
+
+	for f, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("fold %d: %v", f+1, err)
+		}
+	}
+
+	// Aggregate each metric over the folds.
+	scores := make([]Score, len(metrics))
+	for m, metric := range metrics {
+		s := Score{Name: metric.Name, Folds: make([]float64, len(folds))}
+		for f := range folds {
+			s.Folds[f] = values[f][m]
+		}
+		s.Mean = stat.Mean(s.Folds, nil)
+		if len(folds) > 1 {
+			s.StdDev = stat.StdDev(s.Folds, nil)
+		}
+		scores[m] = s
+	}
+
+	return scores, nil
+}
+
+// evaluateFold fits the model on the training rows of the fold and
+// returns the value of each metric on the test rows.
+func evaluateFold(model Model, features [][]float64, labels []float64, fold Fold, metrics []Metric) ([]float64, error) {
+
+	trainX := make([][]float64, len(fold.Train))
+	trainY := make([]float64, len(fold.Train))
+	for i, idx := range fold.Train {
+		trainX[i] = features[idx]
+		trainY[i] = labels[idx]
+	}
+
+	if err := model.Fit(trainX, trainY); err != nil {
+		return nil, err
+	}
+
+	observed := make([]float64, len(fold.Test))
+	predicted := make([]float64, len(fold.Test))
+	for i, idx := range fold.Test {
+		p, err := model.Predict(features[idx])
+		if err != nil {
+			return nil, err
+		}
+		observed[i] = labels[idx]
+		predicted[i] = p
+	}
+
+	values := make([]float64, len(metrics))
+	for m, metric := range metrics {
+		values[m] = metric.Fn(observed, predicted)
+	}
+
+	return values, nil
+}
+
+// KFold shuffles n rows and divides them into k folds of nearly
+// equal size.
+func KFold(n, k int, seed int64) ([]Fold, error) {
+
+	if k < 2 || k > n {
+		return nil, fmt.Errorf("cannot make %d folds from %d rows", k, n)
+	}
+
+	perm := rand.New(rand.NewSource(seed)).Perm(n)
+	assignment := make([]int, n)
+	for i, idx := range perm {
+		assignment[idx] = i % k
+	}
+
+	folds := make([]Fold, k)
+	for i, f := range assignment {
+		for g := range folds {
+			if g == f {
+				folds[g].Test = append(folds[g].Test, i)
+			} else {
+				folds[g].Train = append(folds[g].Train, i)
+			}
+		}
+	}
+
+	return folds, nil
+}
+
+// mae calculates the mean absolute error.
+func mae(observed, predicted []float64) float64 {
+	var sum float64
+	for i, o := range observed {
+		sum += math.Abs(o - predicted[i])
+	}
+	return sum / float64(len(observed))
+}
+
+// rmse calculates the root mean squared error.
+func rmse(observed, predicted []float64) float64 {
+	var sum float64
+	for i, o := range observed {
+		sum += (o - predicted[i]) * (o - predicted[i])
+	}
+	return math.Sqrt(sum / float64(len(observed)))
+}
+
+// rSquared calculates the coefficient of determination.
+func rSquared(observed, predicted []float64) float64 {
+	return stat.RSquaredFrom(predicted, observed, nil)
+}
+
+// accuracy calculates the fraction of correct predictions.
+func accuracy(observed, predicted []float64) float64 {
+	var correct int
+	for i, o := range observed {
+		if o == predicted[i] {
+			correct++
+		}
+	}
+	return float64(correct) / float64(len(observed))
+}
+
+// readData reads the feature and target columns of a CSV file with a header.
+func readData(path, target, featureSpec string) ([]string, [][]float64, []float64, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(records) < 2 {
+		return nil, nil, nil, errors.New("expected a header and at least one row")
+	}
+	header := records[0]
+
+	// Work out the feature columns.
+	var features []string
+	for _, name := range strings.Split(featureSpec, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			features = append(features, name)
+		}
+	}
+	if len(features) == 0 {
+		for _, name := range header {
+			if name != target {
+				features = append(features, name)
+			}
+		}
+	}
+
+	index := make(map[string]int)
+	for i, name := range header {
+		index[name] = i
+	}
+	targetCol, ok := index[target]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("target column %s not found", target)
+	}
+	cols := make([]int, len(features))
+	for j, name := range features {
+		if cols[j], ok = index[name]; !ok || name == target {
+			return nil, nil, nil, fmt.Errorf("invalid feature column %s", name)
+		}
+	}
+
+	// Parse the rows.
+	x := make([][]float64, len(records)-1)
+	y := make([]float64, len(records)-1)
+	for i, record := range records[1:] {
+		if y[i], err = strconv.ParseFloat(record[targetCol], 64); err != nil {
+			return nil, nil, nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+		}
+		x[i] = make([]float64, len(cols))
+		for j, c := range cols {
+			if x[i][j], err = strconv.ParseFloat(record[c], 64); err != nil {
+				return nil, nil, nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+			}
+		}
+	}
+
+	return features, x, y, nil
+}
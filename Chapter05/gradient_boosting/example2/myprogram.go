@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"strconv"
+)
+
+// BoostedModel includes the information about the fitted
+// ensemble that is output from the training. The prediction
+// is Init plus LearningRate times the sum of the trees, which
+// is the log odds of class 1 for the logistic loss.
+type BoostedModel struct {
+	Loss           string      `json:"loss"`
+	LearningRate   float64     `json:"learning_rate"`
+	Init           float64     `json:"init"`
+	Features       []string    `json:"features"`
+	Trees          []*TreeNode `json:"trees"`
+	ValidationLoss []float64   `json:"validation_loss,omitempty"`
+}
+
+// TreeNode is a node of a regression tree. Rows go left when their
+// value of Feature is at most Threshold, and leaves have no children.
+type TreeNode struct {
+	Feature   string    `json:"feature,omitempty"`
+	Threshold float64   `json:"threshold,omitempty"`
+	Left      *TreeNode `json:"left,omitempty"`
+	Right     *TreeNode `json:"right,omitempty"`
+	Value     float64   `json:"value"`
+
+	index int
+}
+
+func main() {
+
+	// Declare the input and output flags.
+	modelPtr := flag.String("model", "../example1/model.json", "The model file output from the training")
+	inPtr := flag.String("in", "diabetes.csv", "The data to predict, with a header naming the model's features")
+	targetPtr := flag.String("target", "y", "The observed column to score the predictions against, or empty to skip the scoring")
+	outPtr := flag.String("out", "predictions.csv", "The output file for the predictions")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Load the model file.
+	f, err := ioutil.ReadFile(*modelPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Unmarshal the model information and look up the
+	// column of each split feature.
+	var model BoostedModel
+	if err := json.Unmarshal(f, &model); err != nil {
+		log.Fatal(err)
+	}
+	if err := model.Resolve(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Read in the rows to predict.
+	x, y, err := readData(*inPtr, model.Features, *targetPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Make the predictions, along with the probability
+	// of class 1 for the logistic loss.
+	records := [][]string{{"prediction"}}
+	if model.Loss == "logistic" {
+		records[0] = append(records[0], "probability")
+	}
+	if y != nil {
+		records[0] = append(records[0], *targetPtr)
+	}
+
+	predictions := make([]float64, len(x))
+	for i, row := range x {
+		raw := model.Raw(row)
+		record := []string{}
+		if model.Loss == "logistic" {
+			if raw >= 0 {
+				predictions[i] = 1
+			}
+			record = append(record, strconv.FormatFloat(predictions[i], 'f', 0, 64), strconv.FormatFloat(sigmoid(raw), 'f', 6, 64))
+		} else {
+			predictions[i] = raw
+			record = append(record, strconv.FormatFloat(raw, 'f', 6, 64))
+		}
+		if y != nil {
+			record = append(record, strconv.FormatFloat(y[i], 'f', -1, 64))
+		}
+		records = append(records, record)
+	}
+
+	// Score the predictions against the observed values.
+	if y != nil {
+		if model.Loss == "logistic" {
+			var correct float64
+			for i, p := range predictions {
+				if p == y[i] {
+					correct++
+				}
+			}
+			fmt.Printf("\nAccuracy = %0.4f on %d rows\n\n", correct/float64(len(y)), len(y))
+		} else {
+			var sum float64
+			for i, p := range predictions {
+				sum += (y[i] - p) * (y[i] - p)
+			}
+			fmt.Printf("\nRMSE = %0.4f on %d rows\n\n", math.Sqrt(sum/float64(len(y))), len(y))
+		}
+	}
+
+	// Save the predictions.
+	out, err := os.Create(*outPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer out.Close()
+
+	w := csv.NewWriter(out)
+	if err := w.WriteAll(records); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Resolve sets the column of each split from its feature name, as
+// the columns are not part of the saved model. It fails if a split
+// names a feature that the model does not list.
+func (m *BoostedModel) Resolve() error {
+
+	columns := make(map[string]int)
+	for j, name := range m.Features {
+		columns[name] = j
+	}
+
+	var walk func(node *TreeNode) error
+	walk = func(node *TreeNode) error {
+		if node.Left == nil || node.Right == nil {
+			if node.Left != node.Right {
+				return errors.New("a split must have two children")
+			}
+			return nil
+		}
+		j, ok := columns[node.Feature]
+		if !ok {
+			return fmt.Errorf("the trees split on %q, which is not one of the model's features", node.Feature)
+		}
+		node.index = j
+		if err := walk(node.Left); err != nil {
+			return err
+		}
+		return walk(node.Right)
+	}
+
+	for _, tree := range m.Trees {
+		if err := walk(tree); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Raw returns the initial value plus the shrunken sum of the trees.
+func (m *BoostedModel) Raw(features []float64) float64 {
+	raw := m.Init
+	for _, tree := range m.Trees {
+		raw += m.LearningRate * predictTree(tree, features)
+	}
+	return raw
+}
+
+// predictTree returns the value of the leaf that a row falls into.
+func predictTree(node *TreeNode, features []float64) float64 {
+	for node.Left != nil {
+		if features[node.index] <= node.Threshold {
+			node = node.Left
+		} else {
+			node = node.Right
+		}
+	}
+	return node.Value
+}
+
+func sigmoid(z float64) float64 {
+	return 1 / (1 + math.Exp(-z))
+}
+
+// readData reads the model's feature columns, in the model's order,
+// and the target column, if it is named, from a CSV file with a header.
+func readData(path string, features []string, target string) ([][]float64, []float64, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) < 2 {
+		return nil, nil, errors.New("expected a header and at least one row")
+	}
+
+	index := make(map[string]int)
+	for i, name := range records[0] {
+		index[name] = i
+	}
+	cols := make([]int, len(features))
+	for j, name := range features {
+		c, ok := index[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("feature column %s not found", name)
+		}
+		cols[j] = c
+	}
+
+	// Parse the rows.
+	x := make([][]float64, len(records)-1)
+	var y []float64
+	for i, record := range records[1:] {
+		x[i] = make([]float64, len(cols))
+		for j, c := range cols {
+			if x[i][j], err = strconv.ParseFloat(record[c], 64); err != nil {
+				return nil, nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+			}
+		}
+	}
+
+	if target != "" {
+		targetCol, ok := index[target]
+		if !ok {
+			return nil, nil, fmt.Errorf("target column %s not found", target)
+		}
+		y = make([]float64, len(records)-1)
+		for i, record := range records[1:] {
+			if y[i], err = strconv.ParseFloat(record[targetCol], 64); err != nil {
+				return nil, nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+			}
+		}
+	}
+
+	return x, y, nil
+}
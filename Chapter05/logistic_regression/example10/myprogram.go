@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Scorer produces a score, e.g. a probability, for a set of features.
+type Scorer func(features []float64) float64
+
+// CalibratorInfo includes the parameters of a fitted calibrator,
+// which are saved with the model and applied at prediction time.
+type CalibratorInfo struct {
+	Method     string    `json:"method"`
+	A          float64   `json:"a,omitempty"`
+	B          float64   `json:"b,omitempty"`
+	Thresholds []float64 `json:"thresholds,omitempty"`
+	Values     []float64 `json:"values,omitempty"`
+}
+
+func main() {
+
+	// Declare the calibrator flag.
+	calibratorPtr := flag.String("calibrator", "../example9/calibrator.json", "The fitted calibrator")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Load the calibrator.
+	data, err := ioutil.ReadFile(*calibratorPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var info CalibratorInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		log.Fatal(err)
+	}
+
+	// Wrap our logistic regression model with the calibrator.
+	scorer, err := Calibrated(predictProbability, info)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Open the test examples.
+	f, err := os.Open("test.csv")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	// Create a new CSV reader reading from the opened file.
+	reader := csv.NewReader(f)
+
+	// observed, probs and predicted will hold the observed labels and
+	// our calibrated probabilities and predictions.
+	var observed, probs, predicted []float64
+
+	// line will track row numbers for logging.
+	line := 1
+
+	// Read in the records looking for unexpected types in the columns.
+	for {
+
+		// Read in a row. Check if we are at the end of the file.
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		// Skip the header.
+		if line == 1 {
+			line++
+			continue
+		}
+
+		// Read in the observed value.
+		observedVal, err := strconv.ParseFloat(record[1], 64)
+		if err != nil {
+			log.Printf("Parsing line %d failed, unexpected type\n", line)
+			continue
+		}
+
+		// Make the corresponding calibrated prediction.
+		score, err := strconv.ParseFloat(record[0], 64)
+		if err != nil {
+			log.Printf("Parsing line %d failed, unexpected type\n", line)
+			continue
+		}
+
+		p := scorer([]float64{score})
+		predictedVal := 0.0
+		if p >= 0.5 {
+			predictedVal = 1.0
+		}
+
+		observed = append(observed, observedVal)
+		probs = append(probs, p)
+		predicted = append(predicted, predictedVal)
+		line++
+	}
+
+	// Calculate the accuracy and Brier score.
+	var truePosNeg int
+	var brier float64
+	for idx, oVal := range observed {
+		if oVal == predicted[idx] {
+			truePosNeg++
+		}
+		brier += (probs[idx] - oVal) * (probs[idx] - oVal)
+	}
+
+	// Output the results to standard out.
+	fmt.Printf("\nCalibration: %s\n", info.Method)
+	fmt.Printf("Accuracy = %0.2f\n", float64(truePosNeg)/float64(len(observed)))
+	fmt.Printf("Brier score = %0.4f\n\n", brier/float64(len(observed)))
+}
+
+// predictProbability calculates the probability of the positive class
+// from our trained logistic regression model.
+func predictProbability(features []float64) float64 {
+	return 1 / (1 + math.Exp(-13.65*features[0]+4.89))
+}
+
+// Calibrated wraps a scorer so that its scores are mapped
+// through the given calibrator.
+func Calibrated(scorer Scorer, info CalibratorInfo) (Scorer, error) {
+
+	switch info.Method {
+	case "platt":
+		return func(features []float64) float64 {
+			return 1 / (1 + math.Exp(info.A*scorer(features)+info.B))
+		}, nil
+	case "isotonic":
+		if len(info.Thresholds) == 0 || len(info.Thresholds) != len(info.Values) {
+			return nil, errors.New("invalid isotonic calibrator")
+		}
+		return func(features []float64) float64 {
+			return interpolate(info.Thresholds, info.Values, scorer(features))
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown calibration method %s", info.Method)
+}
+
+// interpolate linearly interpolates y at x between the points (xs, ys),
+// clipping to the end values outside of the range of xs.
+func interpolate(xs, ys []float64, x float64) float64 {
+
+	n := len(xs)
+	if x <= xs[0] {
+		return ys[0]
+	}
+	if x >= xs[n-1] {
+		return ys[n-1]
+	}
+
+	i := sort.SearchFloat64s(xs, x)
+	if xs[i] == x {
+		return ys[i]
+	}
+	t := (x - xs[i-1]) / (xs[i] - xs[i-1])
+
+	return ys[i-1] + t*(ys[i]-ys[i-1])
+}
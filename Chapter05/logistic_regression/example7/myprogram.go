@@ -2,16 +2,57 @@ package main
 
 import (
 	"encoding/csv"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"math"
 	"os"
 	"strconv"
 )
 
+// ThresholdInfo includes the decision threshold chosen
+// from the ROC or precision-recall curve of the model.
+type ThresholdInfo struct {
+	PositiveClass string  `json:"positive_class"`
+	Criterion     string  `json:"criterion"`
+	Threshold     float64 `json:"threshold"`
+}
+
+// positiveClass is the class whose probability the model predicts.
+const positiveClass = 1.0
+
 func main() {
 
+	// Declare the threshold flag.
+	thresholdPtr := flag.String("threshold", "", "A threshold JSON file to use instead of 0.5")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Use a threshold of 0.5 unless a chosen threshold is given.
+	threshold := 0.5
+	if *thresholdPtr != "" {
+		data, err := ioutil.ReadFile(*thresholdPtr)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var info ThresholdInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			log.Fatal(err)
+		}
+
+		// The model scores the probability of class 1, so a threshold
+		// chosen for another class would be applied the wrong way round.
+		if v, err := strconv.ParseFloat(info.PositiveClass, 64); err != nil || v != positiveClass {
+			log.Fatalf("the threshold was chosen for class %q, but the model scores class %v", info.PositiveClass, positiveClass)
+		}
+		threshold = info.Threshold
+	}
+
 	// Open the test examples.
 	f, err := os.Open("test.csv")
 	if err != nil {
@@ -59,7 +100,7 @@ func main() {
 			continue
 		}
 
-		predictedVal := predict(score)
+		predictedVal := predict(score, threshold)
 
 		// Append the record to our slice, if it has the expected type.
 		observed = append(observed, observedVal)
@@ -86,14 +127,15 @@ func main() {
 }
 
 // predict makes a prediction based on our
-// trained logistic regression model.
-func predict(score float64) float64 {
+// trained logistic regression model and the
+// given decision threshold.
+func predict(score, threshold float64) float64 {
 
 	// Calculate the predicted probability.
 	p := 1 / (1 + math.Exp(-13.65*score+4.89))
 
 	// Output the corresponding class.
-	if p >= 0.5 {
+	if p >= threshold {
 		return 1.0
 	}
 
@@ -0,0 +1,621 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+)
+
+// Scorer produces a score, e.g. a probability, for a set of features.
+type Scorer func(features []float64) float64
+
+// Calibrator maps raw scores to calibrated probabilities.
+type Calibrator interface {
+	Fit(scores, labels []float64) error
+	Calibrate(score float64) float64
+	Info() CalibratorInfo
+}
+
+// CalibratorInfo includes the parameters of a fitted calibrator,
+// which are saved with the model and applied at prediction time.
+type CalibratorInfo struct {
+	Method     string    `json:"method"`
+	A          float64   `json:"a,omitempty"`
+	B          float64   `json:"b,omitempty"`
+	Thresholds []float64 `json:"thresholds,omitempty"`
+	Values     []float64 `json:"values,omitempty"`
+}
+
+// Bin includes the mean predicted probability and observed
+// frequency of the positive class for one reliability bin.
+type Bin struct {
+	MeanPredicted float64
+	Observed      float64
+	Count         int
+}
+
+func main() {
+
+	// Declare the input and output flags.
+	trainPtr := flag.String("train", "training.csv", "The training data")
+	testPtr := flag.String("test", "test.csv", "The test data")
+	methodPtr := flag.String("method", "platt", "The calibration method: platt or isotonic")
+	binsPtr := flag.Int("bins", 10, "The number of reliability diagram bins")
+	binningPtr := flag.String("binning", "uniform", "The bin edges: uniform or quantile")
+	outPtr := flag.String("out", "calibrator.json", "The output file for the fitted calibrator")
+	scoredPtr := flag.Bool("scored", false, "Read label,score files instead of scoring the features")
+	foldsPtr := flag.Int("folds", 5, "The number of cross validation folds")
+	seedPtr := flag.Int64("seed", 42, "The seed for the folds and refitted models")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Score the training data out of fold, by refitting the logistic
+	// regression without each fold, and the test data with the model.
+	// Scoring the rows the model was trained on would overstate its
+	// confidence, and the calibrator would learn that bias.
+	// With -scored, the scores of another model are read instead and
+	// the training file should hold held-out scores.
+	var trainScores, trainLabels, testScores, testLabels []float64
+	var err error
+	if *scoredPtr {
+		if trainScores, trainLabels, err = readScored(*trainPtr); err != nil {
+			log.Fatal(err)
+		}
+		if testScores, testLabels, err = readScored(*testPtr); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		if trainScores, trainLabels, err = crossValidatedScores(*trainPtr, *foldsPtr, *seedPtr); err != nil {
+			log.Fatal(err)
+		}
+		if testScores, testLabels, err = scoreFile(*testPtr, predictProbability); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Fit the calibrator on the training scores. Platt scaling is the
+	// default, as isotonic regression needs more data: its end steps
+	// can reach 0 or 1, which makes the log-loss blow up.
+	var cal Calibrator
+	switch *methodPtr {
+	case "platt":
+		cal = &Platt{}
+	case "isotonic":
+		cal = &Isotonic{}
+	default:
+		log.Fatalf("Unknown calibration method %s", *methodPtr)
+	}
+
+	if err := cal.Fit(trainScores, trainLabels); err != nil {
+		log.Fatal(err)
+	}
+
+	// Calibrate the test scores.
+	calibrated := make([]float64, len(testScores))
+	for i, s := range testScores {
+		calibrated[i] = cal.Calibrate(s)
+	}
+
+	// Output the scores before and after calibration to standard out.
+	fmt.Printf("\n%-12s %10s %10s\n", "", "Brier", "log-loss")
+	fmt.Printf("%-12s %10.4f %10.4f\n", "raw", BrierScore(testScores, testLabels), LogLoss(testScores, testLabels))
+	fmt.Printf("%-12s %10.4f %10.4f\n\n", *methodPtr, BrierScore(calibrated, testLabels), LogLoss(calibrated, testLabels))
+
+	// Calculate the reliability diagrams and save the plot.
+	rawBins, err := Reliability(testScores, testLabels, *binsPtr, *binningPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	calBins, err := Reliability(calibrated, testLabels, *binsPtr, *binningPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := plotReliability("reliability.png", map[string][]Bin{"raw": rawBins, *methodPtr: calBins}); err != nil {
+		log.Fatal(err)
+	}
+
+	// Marshal the calibrator and save it to a file.
+	outputData, err := json.MarshalIndent(cal.Info(), "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(*outPtr, outputData, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// predictProbability calculates the probability of the positive class
+// from our trained logistic regression model.
+func predictProbability(features []float64) float64 {
+	return 1 / (1 + math.Exp(-13.65*features[0]+4.89))
+}
+
+// scoreFile reads a CSV file of features followed by a 0/1 label
+// and scores each row with the given scorer.
+func scoreFile(path string, scorer Scorer) ([]float64, []float64, error) {
+
+	features, labels, err := readFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scores := make([]float64, len(features))
+	for i, row := range features {
+		scores[i] = scorer(row)
+	}
+
+	return scores, labels, nil
+}
+
+// readFile reads a CSV file of features followed by a 0/1 label.
+func readFile(path string) ([][]float64, []float64, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var features [][]float64
+	var labels []float64
+	for i, record := range records {
+
+		// Skip the header.
+		if i == 0 {
+			continue
+		}
+
+		vals := make([]float64, len(record))
+		for j, raw := range record {
+			vals[j], err = strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parsing line %d failed: %v", i+1, err)
+			}
+		}
+
+		features = append(features, vals[:len(vals)-1])
+		labels = append(labels, vals[len(vals)-1])
+	}
+
+	return features, labels, nil
+}
+
+// crossValidatedScores reads the training data and scores each row
+// with a logistic regression refitted without the row's fold, in the
+// same way as our trained model. These out-of-fold scores behave like
+// the scores of unseen data, so the calibrator does not learn from the
+// rows the model was trained on.
+func crossValidatedScores(path string, folds int, seed int64) ([]float64, []float64, error) {
+
+	features, labels, err := readFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if folds < 2 || folds > len(labels) {
+		return nil, nil, fmt.Errorf("folds must be between 2 and %d", len(labels))
+	}
+
+	// Assign the shuffled rows to the folds in turn.
+	rng := rand.New(rand.NewSource(seed))
+	fold := make([]int, len(labels))
+	for i, idx := range rng.Perm(len(labels)) {
+		fold[idx] = i % folds
+	}
+
+	scores := make([]float64, len(labels))
+	for k := 0; k < folds; k++ {
+
+		var trainX [][]float64
+		var trainY []float64
+		for i := range labels {
+			if fold[i] != k {
+				trainX = append(trainX, features[i])
+				trainY = append(trainY, labels[i])
+			}
+		}
+
+		weights := logisticRegression(trainX, trainY, 1000, 0.3, rng)
+		for i, row := range features {
+			if fold[i] == k {
+				scores[i] = logistic(weights[0]*row[0] + weights[1])
+			}
+		}
+	}
+
+	return scores, labels, nil
+}
+
+// logistic implements the logistic function.
+func logistic(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+// logisticRegression fits the weight of the feature and the intercept
+// by stochastic gradient descent on the squared error, as our model
+// was trained.
+func logisticRegression(features [][]float64, labels []float64, numSteps int, learningRate float64, rng *rand.Rand) []float64 {
+
+	weights := []float64{rng.Float64(), rng.Float64()}
+	for i := 0; i < numSteps; i++ {
+		for idx, label := range labels {
+			row := []float64{features[idx][0], 1}
+			pred := logistic(row[0]*weights[0] + row[1]*weights[1])
+			predError := label - pred
+			for j := range weights {
+				weights[j] += learningRate * predError * pred * (1 - pred) * row[j]
+			}
+		}
+	}
+
+	return weights
+}
+
+// readScored reads a CSV file of 0/1 labels followed by the score of
+// the positive class, e.g. as saved by the naive Bayes classifier.
+func readScored(path string) ([]float64, []float64, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var scores, labels []float64
+	for i, record := range records {
+
+		// Skip the header.
+		if i == 0 {
+			continue
+		}
+
+		if len(record) != 2 {
+			return nil, nil, fmt.Errorf("line %d: expected a label and a single score", i+1)
+		}
+
+		label, err := strconv.ParseFloat(record[0], 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing line %d failed: %v", i+1, err)
+		}
+
+		score, err := strconv.ParseFloat(record[1], 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing line %d failed: %v", i+1, err)
+		}
+
+		scores = append(scores, score)
+		labels = append(labels, label)
+	}
+
+	return scores, labels, nil
+}
+
+// BrierScore returns the mean squared difference between the
+// predicted probabilities and the 0/1 labels.
+func BrierScore(probs, labels []float64) float64 {
+	var sum float64
+	for i, p := range probs {
+		sum += (p - labels[i]) * (p - labels[i])
+	}
+	return sum / float64(len(probs))
+}
+
+// LogLoss returns the mean negative log-likelihood of the labels,
+// clipping the probabilities away from 0 and 1.
+func LogLoss(probs, labels []float64) float64 {
+	const eps = 1e-15
+	var sum float64
+	for i, p := range probs {
+		p = math.Min(math.Max(p, eps), 1-eps)
+		sum -= labels[i]*math.Log(p) + (1-labels[i])*math.Log(1-p)
+	}
+	return sum / float64(len(probs))
+}
+
+// Reliability bins the predicted probabilities and calculates the
+// observed frequency of the positive class in each bin. The bins are
+// equally wide for uniform binning, or hold equal counts for quantile
+// binning. Empty bins are left out.
+func Reliability(probs, labels []float64, bins int, binning string) ([]Bin, error) {
+
+	if bins < 1 {
+		return nil, errors.New("at least one bin is required")
+	}
+
+	// Calculate the bin edges.
+	edges := make([]float64, bins+1)
+	switch binning {
+	case "uniform":
+		for i := range edges {
+			edges[i] = float64(i) / float64(bins)
+		}
+	case "quantile":
+		sorted := make([]float64, len(probs))
+		copy(sorted, probs)
+		sort.Float64s(sorted)
+		for i := range edges {
+			idx := i * (len(sorted) - 1) / bins
+			edges[i] = sorted[idx]
+		}
+	default:
+		return nil, fmt.Errorf("unknown binning %s", binning)
+	}
+
+	// Accumulate the predictions and labels in each bin.
+	sums := make([]Bin, bins)
+	for i, p := range probs {
+		// Find the first bin whose upper edge is not below p.
+		b := sort.Search(bins-1, func(k int) bool { return p <= edges[k+1] })
+		sums[b].MeanPredicted += p
+		sums[b].Observed += labels[i]
+		sums[b].Count++
+	}
+
+	var out []Bin
+	for _, b := range sums {
+		if b.Count == 0 {
+			continue
+		}
+		b.MeanPredicted /= float64(b.Count)
+		b.Observed /= float64(b.Count)
+		out = append(out, b)
+	}
+
+	return out, nil
+}
+
+// Platt calibrates scores with a logistic function of the score,
+// p = 1 / (1 + exp(A*s + B)), fitted by Newton's method.
+type Platt struct {
+	A, B float64
+}
+
+// Fit fits the Platt scaling parameters using the smoothed
+// targets suggested by Platt to avoid overfitting.
+func (p *Platt) Fit(scores, labels []float64) error {
+
+	var nPos, nNeg float64
+	for _, l := range labels {
+		if l == 1 {
+			nPos++
+		} else {
+			nNeg++
+		}
+	}
+	if nPos == 0 || nNeg == 0 {
+		return errors.New("platt scaling needs both positive and negative labels")
+	}
+
+	hi := (nPos + 1) / (nPos + 2)
+	lo := 1 / (nNeg + 2)
+	targets := make([]float64, len(labels))
+	for i, l := range labels {
+		if l == 1 {
+			targets[i] = hi
+		} else {
+			targets[i] = lo
+		}
+	}
+
+	// Iterate Newton's method on the cross-entropy.
+	a, b := 0.0, math.Log((nNeg+1)/(nPos+1))
+	for iter := 0; iter < 100; iter++ {
+		var gA, gB, hAA, hAB, hBB float64
+		for i, s := range scores {
+			q := 1 / (1 + math.Exp(a*s+b))
+			d := targets[i] - q
+			w := q * (1 - q)
+			gA += d * s
+			gB += d
+			hAA += w * s * s
+			hAB += w * s
+			hBB += w
+		}
+
+		// Add a little regularization to keep the Hessian invertible.
+		hAA += 1e-12
+		hBB += 1e-12
+		det := hAA*hBB - hAB*hAB
+		if det == 0 {
+			break
+		}
+		stepA := (hBB*gA - hAB*gB) / det
+		stepB := (hAA*gB - hAB*gA) / det
+		a -= stepA
+		b -= stepB
+
+		if math.Abs(stepA) < 1e-10 && math.Abs(stepB) < 1e-10 {
+			break
+		}
+	}
+
+	p.A, p.B = a, b
+	return nil
+}
+
+// Calibrate returns the calibrated probability for a score.
+func (p *Platt) Calibrate(score float64) float64 {
+	return 1 / (1 + math.Exp(p.A*score+p.B))
+}
+
+// Info returns the parameters of the fitted calibrator.
+func (p *Platt) Info() CalibratorInfo {
+	return CalibratorInfo{Method: "platt", A: p.A, B: p.B}
+}
+
+// Isotonic calibrates scores with a non-decreasing step function
+// fitted by the pool adjacent violators algorithm.
+type Isotonic struct {
+	Thresholds []float64
+	Values     []float64
+}
+
+// Fit fits the isotonic regression of the labels on the scores.
+func (iso *Isotonic) Fit(scores, labels []float64) error {
+
+	if len(scores) == 0 {
+		return errors.New("isotonic regression needs at least one score")
+	}
+
+	// Order the observations by score.
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return scores[order[a]] < scores[order[b]] })
+
+	// Each block holds the pooled mean of its labels and the range of
+	// scores it covers.
+	type block struct {
+		sum, weight float64
+		lo, hi      float64
+	}
+
+	var blocks []block
+	for _, i := range order {
+		blocks = append(blocks, block{sum: labels[i], weight: 1, lo: scores[i], hi: scores[i]})
+
+		// Pool adjacent blocks while they violate the ordering, and
+		// always pool blocks with the same score.
+		for len(blocks) > 1 {
+			last := blocks[len(blocks)-1]
+			prev := blocks[len(blocks)-2]
+			if prev.sum/prev.weight < last.sum/last.weight && prev.hi != last.lo {
+				break
+			}
+			blocks = blocks[:len(blocks)-2]
+			blocks = append(blocks, block{
+				sum:    prev.sum + last.sum,
+				weight: prev.weight + last.weight,
+				lo:     prev.lo,
+				hi:     last.hi,
+			})
+		}
+	}
+
+	iso.Thresholds = iso.Thresholds[:0]
+	iso.Values = iso.Values[:0]
+	for _, b := range blocks {
+		mean := b.sum / b.weight
+		iso.Thresholds = append(iso.Thresholds, b.lo)
+		iso.Values = append(iso.Values, mean)
+		if b.hi != b.lo {
+			iso.Thresholds = append(iso.Thresholds, b.hi)
+			iso.Values = append(iso.Values, mean)
+		}
+	}
+
+	return nil
+}
+
+// Calibrate returns the calibrated probability for a score, linearly
+// interpolating between the fitted points and clipping outside them.
+func (iso *Isotonic) Calibrate(score float64) float64 {
+	return interpolate(iso.Thresholds, iso.Values, score)
+}
+
+// Info returns the parameters of the fitted calibrator.
+func (iso *Isotonic) Info() CalibratorInfo {
+	return CalibratorInfo{Method: "isotonic", Thresholds: iso.Thresholds, Values: iso.Values}
+}
+
+// interpolate linearly interpolates y at x between the points (xs, ys),
+// clipping to the end values outside of the range of xs.
+func interpolate(xs, ys []float64, x float64) float64 {
+
+	n := len(xs)
+	if x <= xs[0] {
+		return ys[0]
+	}
+	if x >= xs[n-1] {
+		return ys[n-1]
+	}
+
+	i := sort.SearchFloat64s(xs, x)
+	if xs[i] == x {
+		return ys[i]
+	}
+	t := (x - xs[i-1]) / (xs[i] - xs[i-1])
+
+	return ys[i-1] + t*(ys[i]-ys[i-1])
+}
+
+// plotReliability saves a reliability diagram with one line per set
+// of bins and the diagonal of perfect calibration.
+func plotReliability(path string, curves map[string][]Bin) error {
+
+	p, err := plot.New()
+	if err != nil {
+		return err
+	}
+	p.Title.Text = "Reliability diagram"
+	p.X.Label.Text = "Mean predicted probability"
+	p.Y.Label.Text = "Observed frequency"
+	p.X.Min, p.X.Max = 0, 1
+	p.Y.Min, p.Y.Max = 0, 1
+	p.Add(plotter.NewGrid())
+
+	// Draw the diagonal of perfect calibration.
+	diag, err := plotter.NewLine(plotter.XYs{{X: 0, Y: 0}, {X: 1, Y: 1}})
+	if err != nil {
+		return err
+	}
+	diag.LineStyle.Dashes = []vg.Length{vg.Points(4), vg.Points(4)}
+	p.Add(diag)
+
+	var names []string
+	for name := range curves {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for k, name := range names {
+		pts := make(plotter.XYs, len(curves[name]))
+		for i, b := range curves[name] {
+			pts[i].X = b.MeanPredicted
+			pts[i].Y = b.Observed
+		}
+
+		l, s, err := plotter.NewLinePoints(pts)
+		if err != nil {
+			return err
+		}
+		l.LineStyle.Color = plotutil.Color(k)
+		s.GlyphStyle.Color = plotutil.Color(k)
+		s.GlyphStyle.Shape = draw.CircleGlyph{}
+		p.Add(l, s)
+		p.Legend.Add(name, l, s)
+	}
+	p.Legend.Top = true
+	p.Legend.Left = true
+
+	return p.Save(5*vg.Inch, 5*vg.Inch, path)
+}
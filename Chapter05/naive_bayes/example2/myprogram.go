@@ -0,0 +1,502 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NaiveBayes is a naive Bayes classifier that is output from the
+// training. The Gaussian variant keeps the mean and variance of each
+// feature per class, while the multinomial and complement variants
+// keep a log weight for each feature per class. The complement variant
+// has no priors, following Rennie et al. (2003).
+type NaiveBayes struct {
+	Variant   string      `json:"variant"`
+	Alpha     float64     `json:"alpha"`
+	Features  []string    `json:"features"`
+	Classes   []string    `json:"classes"`
+	LogPriors []float64   `json:"log_priors,omitempty"`
+	Means     [][]float64 `json:"means,omitempty"`
+	Variances [][]float64 `json:"variances,omitempty"`
+	Weights   [][]float64 `json:"weights,omitempty"`
+}
+
+func main() {
+
+	// Declare the data flags.
+	trainPtr := flag.String("train", "training.csv", "The training data")
+	testPtr := flag.String("test", "test.csv", "The test data, or empty to evaluate on the training data")
+	targetPtr := flag.String("target", "class", "The class column, with every other column used as a feature")
+
+	// Declare the model flags.
+	variantPtr := flag.String("variant", "gaussian", "The naive Bayes variant: gaussian, multinomial or complement")
+	alphaPtr := flag.Float64("alpha", 1, "The additive (Laplace) smoothing of the multinomial and complement counts")
+	varSmoothingPtr := flag.Float64("varSmoothing", 1e-9, "The fraction of the largest feature variance added to each Gaussian variance")
+	priorsPtr := flag.String("priors", "", "Class priors as class=p,... or uniform, or empty to learn them from the class frequencies (not used by the complement variant)")
+
+	// Declare the output flags.
+	outPtr := flag.String("out", "model.json", "The output file for the model")
+	scoresPtr := flag.String("scores", "scored.csv", "The output file for the test labels and class probabilities")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Read in the training data.
+	features, trainX, trainLabels, err := readData(*trainPtr, *targetPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Fit the classifier.
+	nb, err := Fit(*variantPtr, features, trainX, trainLabels, *alphaPtr, *varSmoothingPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *priorsPtr != "" {
+		if err := nb.SetPriors(*priorsPtr); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Read in the test data.
+	testX, testLabels := trainX, trainLabels
+	if *testPtr != "" {
+		var testFeatures []string
+		testFeatures, testX, testLabels, err = readData(*testPtr, *targetPtr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if strings.Join(testFeatures, ",") != strings.Join(features, ",") {
+			log.Fatal("the test data must have the same features as the training data")
+		}
+	}
+
+	// Calculate the class probabilities of the test data.
+	probs := make([][]float64, len(testX))
+	var correct int
+	var logLoss float64
+	for i, x := range testX {
+		if probs[i], err = nb.Probabilities(x); err != nil {
+			log.Fatal(err)
+		}
+
+		best := 0
+		for c, p := range probs[i] {
+			if p > probs[i][best] {
+				best = c
+			}
+		}
+		if nb.Classes[best] == testLabels[i] {
+			correct++
+		}
+
+		p := 0.0
+		for c, class := range nb.Classes {
+			if class == testLabels[i] {
+				p = probs[i][c]
+			}
+		}
+		logLoss -= math.Log(math.Max(p, 1e-15)) / float64(len(testX))
+	}
+
+	// Output the results to standard out.
+	fmt.Printf("\n%s naive Bayes on %d classes\n", strings.Title(nb.Variant), len(nb.Classes))
+	for c, class := range nb.Classes {
+		if nb.LogPriors == nil {
+			break
+		}
+		fmt.Printf("  prior(%s) = %0.4f\n", class, math.Exp(nb.LogPriors[c]))
+	}
+	fmt.Printf("\nAccuracy: %0.4f\nLog-loss: %0.4f\n\n", float64(correct)/float64(len(testX)), logLoss)
+
+	// Save the labels and class probabilities for the ROC and
+	// calibration tools.
+	if err := writeScores(*scoresPtr, nb.Classes, testLabels, probs); err != nil {
+		log.Fatal(err)
+	}
+
+	// Save the model.
+	outputData, err := json.MarshalIndent(nb, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(*outPtr, outputData, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Fit trains a naive Bayes classifier of the given variant, with the
+// priors learned from the class frequencies.
+//
+// The Gaussian variant models each feature within a class as normal,
+// adding varSmoothing times the largest feature variance to each
+// variance for stability. The multinomial variant models count
+// features with the smoothed class frequencies of each feature,
+//
+//	θ_ci = (N_ci + α) / (N_c + α·n),
+//
+// and the complement variant uses the frequencies of each feature in
+// every other class instead, which is better suited to imbalanced
+// classes, scoring a class by how unlike its complement a row is. Like
+// Rennie et al. (2003) and scikit-learn, the complement variant leaves
+// out the priors, as the complement weights already correct for the
+// class sizes and a prior would favor the large classes again.
+func Fit(variant string, features []string, x [][]float64, labels []string, alpha, varSmoothing float64) (*NaiveBayes, error) {
+
+	if len(x) == 0 || len(x) != len(labels) {
+		return nil, errors.New("there must be one label per row of features")
+	}
+
+	nb := &NaiveBayes{
+		Variant:  variant,
+		Features: features,
+		Classes:  distinct(labels),
+	}
+	classIndex := make(map[string]int)
+	for c, class := range nb.Classes {
+		classIndex[class] = c
+	}
+	k, n := len(nb.Classes), len(features)
+
+	// Learn the priors from the class frequencies.
+	counts := make([]float64, k)
+	for _, label := range labels {
+		counts[classIndex[label]]++
+	}
+	if variant != "complement" {
+		for _, count := range counts {
+			nb.LogPriors = append(nb.LogPriors, math.Log(count/float64(len(labels))))
+		}
+	}
+
+	switch variant {
+	case "gaussian":
+
+		// Calculate the mean and variance of each feature per class.
+		nb.Means = zeros(k, n)
+		nb.Variances = zeros(k, n)
+		for i, row := range x {
+			c := classIndex[labels[i]]
+			for j, v := range row {
+				nb.Means[c][j] += v / counts[c]
+			}
+		}
+		for i, row := range x {
+			c := classIndex[labels[i]]
+			for j, v := range row {
+				d := v - nb.Means[c][j]
+				nb.Variances[c][j] += d * d / counts[c]
+			}
+		}
+
+		// Smooth the variances by a fraction of the
+		// largest variance of the features.
+		epsilon := varSmoothing * maxVariance(x)
+		if epsilon == 0 {
+			epsilon = varSmoothing
+		}
+		for c := range nb.Variances {
+			for j := range nb.Variances[c] {
+				nb.Variances[c][j] += epsilon
+			}
+		}
+
+	case "multinomial", "complement":
+		if alpha <= 0 {
+			return nil, errors.New("the smoothing alpha must be positive")
+		}
+		nb.Alpha = alpha
+
+		// Total the counts of each feature per class.
+		featureCounts := zeros(k, n)
+		for i, row := range x {
+			c := classIndex[labels[i]]
+			for j, v := range row {
+				if v < 0 {
+					return nil, fmt.Errorf("the %s variant needs non-negative counts", variant)
+				}
+				featureCounts[c][j] += v
+			}
+		}
+
+		// For the complement variant, use the counts of every
+		// other class instead.
+		if variant == "complement" {
+			totals := make([]float64, n)
+			for _, fc := range featureCounts {
+				for j, v := range fc {
+					totals[j] += v
+				}
+			}
+			for _, fc := range featureCounts {
+				for j := range fc {
+					fc[j] = totals[j] - fc[j]
+				}
+			}
+		}
+
+		// Calculate the smoothed log frequencies, which are negated
+		// for the complement variant.
+		nb.Weights = zeros(k, n)
+		for c, fc := range featureCounts {
+			var total float64
+			for _, v := range fc {
+				total += v
+			}
+			for j, v := range fc {
+				nb.Weights[c][j] = math.Log((v + alpha) / (total + alpha*float64(n)))
+				if variant == "complement" {
+					nb.Weights[c][j] = -nb.Weights[c][j]
+				}
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown naive Bayes variant %s", variant)
+	}
+
+	return nb, nil
+}
+
+// SetPriors replaces the learned priors with uniform priors or with the
+// given class=p pairs, which must cover every class and sum to 1.
+func (nb *NaiveBayes) SetPriors(spec string) error {
+
+	if nb.Variant == "complement" {
+		return errors.New("the complement variant does not use priors")
+	}
+
+	if spec == "uniform" {
+		for c := range nb.LogPriors {
+			nb.LogPriors[c] = -math.Log(float64(len(nb.Classes)))
+		}
+		return nil
+	}
+
+	priors := make(map[string]float64)
+	var total float64
+	for _, part := range strings.Split(spec, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid prior %s", part)
+		}
+		p, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil || p <= 0 {
+			return fmt.Errorf("invalid prior %s", part)
+		}
+		priors[kv[0]] = p
+		total += p
+	}
+	if math.Abs(total-1) > 1e-6 {
+		return fmt.Errorf("the priors sum to %g, not 1", total)
+	}
+
+	for c, class := range nb.Classes {
+		p, ok := priors[class]
+		if !ok {
+			return fmt.Errorf("no prior given for class %s", class)
+		}
+		nb.LogPriors[c] = math.Log(p)
+	}
+	if len(priors) != len(nb.Classes) {
+		return errors.New("priors given for classes not in the training data")
+	}
+
+	return nil
+}
+
+// Probabilities returns the posterior probability of each class for a
+// row, normalizing the joint log likelihoods with the log-sum-exp.
+func (nb *NaiveBayes) Probabilities(x []float64) ([]float64, error) {
+
+	if len(x) != len(nb.Features) {
+		return nil, fmt.Errorf("expected %d features, got %d", len(nb.Features), len(x))
+	}
+
+	joint := make([]float64, len(nb.Classes))
+	for c := range nb.Classes {
+		if nb.LogPriors != nil {
+			joint[c] = nb.LogPriors[c]
+		}
+		for j, v := range x {
+			if nb.Variant == "gaussian" {
+				mean, variance := nb.Means[c][j], nb.Variances[c][j]
+				joint[c] -= 0.5*math.Log(2*math.Pi*variance) + (v-mean)*(v-mean)/(2*variance)
+				continue
+			}
+			joint[c] += v * nb.Weights[c][j]
+		}
+	}
+
+	max := joint[0]
+	for _, l := range joint {
+		max = math.Max(max, l)
+	}
+	var sum float64
+	for _, l := range joint {
+		sum += math.Exp(l - max)
+	}
+
+	probs := make([]float64, len(joint))
+	for c, l := range joint {
+		probs[c] = math.Exp(l - max - math.Log(sum))
+	}
+
+	return probs, nil
+}
+
+// distinct returns the sorted distinct values.
+func distinct(values []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// zeros returns a rows by cols slice of zeros.
+func zeros(rows, cols int) [][]float64 {
+	out := make([][]float64, rows)
+	for r := range out {
+		out[r] = make([]float64, cols)
+	}
+	return out
+}
+
+// maxVariance returns the largest variance of the feature columns.
+func maxVariance(x [][]float64) float64 {
+	var largest float64
+	for j := range x[0] {
+		var mean, sumSq float64
+		for _, row := range x {
+			mean += row[j] / float64(len(x))
+		}
+		for _, row := range x {
+			sumSq += (row[j] - mean) * (row[j] - mean)
+		}
+		largest = math.Max(largest, sumSq/float64(len(x)))
+	}
+	return largest
+}
+
+// writeScores saves the labels and class probabilities in the format
+// of the ROC tool: a label column followed by a score column named
+// after each class, or for two classes a single score column holding
+// the probability of the second class. For two classes the labels are
+// written as 1 for the second class and 0 for the first, so that the
+// calibration tools can read them whatever the class names are.
+func writeScores(path string, classes, labels []string, probs [][]float64) error {
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	header := append([]string{"label"}, classes...)
+	if len(classes) == 2 {
+		header = []string{"label", "score"}
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	for i, label := range labels {
+		record := []string{label}
+		if len(classes) == 2 {
+			record[0] = "0"
+			if label == classes[1] {
+				record[0] = "1"
+			}
+		}
+		for c, p := range probs[i] {
+			if len(classes) == 2 && c == 0 {
+				continue
+			}
+			record = append(record, strconv.FormatFloat(p, 'f', 6, 64))
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+
+	return w.Error()
+}
+
+// readData reads a CSV file with a header, returning the feature names,
+// the feature values and the class labels. Numeric labels are formatted
+// in their shortest form, so that 1.000000 becomes 1.
+func readData(path, target string) ([]string, [][]float64, []string, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(records) < 2 {
+		return nil, nil, nil, errors.New("expected a header and at least one row")
+	}
+	header := records[0]
+
+	targetCol := -1
+	var features []string
+	for j, name := range header {
+		if name == target {
+			targetCol = j
+		} else {
+			features = append(features, name)
+		}
+	}
+	if targetCol < 0 {
+		return nil, nil, nil, fmt.Errorf("target column %s not found", target)
+	}
+
+	var x [][]float64
+	var labels []string
+	for i, record := range records[1:] {
+		var row []float64
+		for j, raw := range record {
+			if j == targetCol {
+				continue
+			}
+			v, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("parsing line %d failed: %v", i+2, err)
+			}
+			row = append(row, v)
+		}
+
+		label := strings.TrimSpace(record[targetCol])
+		if v, err := strconv.ParseFloat(label, 64); err == nil {
+			label = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+
+		x = append(x, row)
+		labels = append(labels, label)
+	}
+
+	return features, x, labels, nil
+}
@@ -2,19 +2,57 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/stat/distuv"
 )
 
+// defaultIntervalLevel is the level of the intervals when
+// the prediction data does not request one.
+const defaultIntervalLevel = 0.95
+
 // ModelInfo includes the information about the
 // model that is output from the training.
 type ModelInfo struct {
 	Intercept    float64           `json:"intercept"`
 	Coefficients []CoefficientInfo `json:"coefficients"`
+	Expansion    *Expansion        `json:"expansion,omitempty"`
+	Covariance   *CovarianceInfo   `json:"covariance,omitempty"`
+	PCA          *PCA              `json:"pca,omitempty"`
+	Quantiles    []QuantileInfo    `json:"quantiles,omitempty"`
+	Rearrange    bool              `json:"rearrange,omitempty"`
+}
+
+// QuantileInfo includes the model of a single quantile, for
+// models trained with quantile regression. Their predictions
+// are sorted when the model sets Rearrange, so that the
+// quantiles cannot cross.
+type QuantileInfo struct {
+	Quantile     float64           `json:"quantile"`
+	Intercept    float64           `json:"intercept"`
+	Coefficients []CoefficientInfo `json:"coefficients"`
+}
+
+// PCA includes the parameters of a fitted principal component
+// analysis, which are saved with a model so that the same
+// projection can be applied at prediction time.
+type PCA struct {
+	Columns    []string    `json:"columns"`
+	Means      []float64   `json:"means"`
+	Scales     []float64   `json:"scales,omitempty"`
+	Components [][]float64 `json:"components"`
+	Variances  []float64   `json:"explained_variance"`
+	Ratios     []float64   `json:"explained_variance_ratio"`
+	Whiten     bool        `json:"whiten"`
 }
 
 // CoefficientInfo include information about a
@@ -24,11 +62,60 @@ type CoefficientInfo struct {
 	Coefficient float64 `json:"coefficient"`
 }
 
+// CovarianceInfo includes the residual variance, its degrees of
+// freedom and (XᵀX)⁻¹ from the training, with rows and columns
+// following Terms.
+type CovarianceInfo struct {
+	Terms            []string    `json:"terms"`
+	ResidualVariance float64     `json:"residual_variance"`
+	DFResidual       int         `json:"df_residual"`
+	XTXInverse       [][]float64 `json:"xtx_inverse"`
+}
+
+// Expansion describes how the raw inputs are expanded into the
+// features of the model. Each input gets polynomial terms up to
+// Degree, unless it has a natural cubic spline basis, and
+// Interactions ("none", "pairwise" or "all") adds the products
+// of the raw inputs.
+type Expansion struct {
+	Inputs       []string     `json:"inputs"`
+	Degree       int          `json:"degree"`
+	Interactions string       `json:"interactions"`
+	Splines      []SplineInfo `json:"splines,omitempty"`
+}
+
+// SplineInfo includes the knots of the natural cubic
+// spline basis of an input.
+type SplineInfo struct {
+	Input string    `json:"input"`
+	Knots []float64 `json:"knots"`
+}
+
 // PredictionData includes the data necessary to make
 // a prediction and encodes the output prediction.
+// The intervals are only filled in for models trained
+// with their covariance information, at IntervalLevel
+// or at 95% if no level is requested, and not for
+// quantile models.
 type PredictionData struct {
-	Prediction      float64          `json:"predicted_diabetes_progression"`
-	IndependentVars []IndependentVar `json:"independent_variables"`
+	Prediction         float64          `json:"predicted_diabetes_progression"`
+	IntervalLevel      float64          `json:"interval_level,omitempty"`
+	ConfidenceInterval *Interval        `json:"confidence_interval,omitempty"`
+	PredictionInterval *Interval        `json:"prediction_interval,omitempty"`
+	Quantiles          []QuantileValue  `json:"quantiles,omitempty"`
+	IndependentVars    []IndependentVar `json:"independent_variables"`
+}
+
+// QuantileValue includes the prediction of a quantile.
+type QuantileValue struct {
+	Quantile   float64 `json:"quantile"`
+	Prediction float64 `json:"prediction"`
+}
+
+// Interval includes the bounds of an interval around a prediction.
+type Interval struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
 }
 
 // IndependentVar include information about and a
@@ -123,6 +210,43 @@ func Predict(modelInfo *ModelInfo, predictionData *PredictionData) error {
 		varVals[indVar.Name] = indVar.Value
 	}
 
+	// Expand the raw inputs into the features of
+	// the model, if the model was trained on them.
+	if modelInfo.Expansion != nil {
+		names, values, err := Expand(modelInfo.Expansion, varVals)
+		if err != nil {
+			return err
+		}
+		varVals = make(map[string]float64)
+		for idx, name := range names {
+			varVals[name] = values[idx]
+		}
+	}
+
+	// Project the raw inputs onto the principal components
+	// the model was trained on.
+	if modelInfo.PCA != nil {
+		if modelInfo.Expansion != nil {
+			return errors.New("a model cannot both expand and project its inputs")
+		}
+		row := make([]float64, len(modelInfo.PCA.Columns))
+		for idx, name := range modelInfo.PCA.Columns {
+			val, ok := varVals[name]
+			if !ok {
+				return fmt.Errorf("Expected a value for variable %s", name)
+			}
+			row[idx] = val
+		}
+		names, values, err := modelInfo.PCA.Project(row)
+		if err != nil {
+			return err
+		}
+		varVals = make(map[string]float64)
+		for idx, name := range names {
+			varVals[name] = values[idx]
+		}
+	}
+
 	// Loop over the independent variables.
 	for _, varName := range varNames {
 
@@ -145,5 +269,300 @@ func Predict(modelInfo *ModelInfo, predictionData *PredictionData) error {
 	// Add the prediction to the prediction data.
 	predictionData.Prediction = prediction
 
+	// Predict each quantile, if the model has them. The point
+	// prediction is the quantile closest to the median, after
+	// any rearrangement.
+	if len(modelInfo.Quantiles) > 0 {
+		quantiles, err := PredictQuantiles(modelInfo, varVals)
+		if err != nil {
+			return err
+		}
+		median := 0
+		for idx, q := range quantiles {
+			if math.Abs(q.Quantile-0.5) < math.Abs(quantiles[median].Quantile-0.5) {
+				median = idx
+			}
+		}
+		predictionData.Prediction = quantiles[median].Prediction
+		predictionData.Quantiles = quantiles
+	}
+
+	// Add the intervals, if the model has the information
+	// needed to calculate them. They are centered on the least
+	// squares prediction, so they are left out for quantile
+	// models, whose quantiles already bound the prediction.
+	if modelInfo.Covariance == nil || len(modelInfo.Quantiles) > 0 {
+		return nil
+	}
+
+	if predictionData.IntervalLevel == 0 {
+		predictionData.IntervalLevel = defaultIntervalLevel
+	}
+	ci, pi, err := Intervals(modelInfo.Covariance, varVals, prediction, predictionData.IntervalLevel)
+	if err != nil {
+		return err
+	}
+	predictionData.ConfidenceInterval = ci
+	predictionData.PredictionInterval = pi
+
 	return nil
 }
+
+// PredictQuantiles predicts each quantile of a quantile regression
+// model, in increasing order of the quantiles. When the model sets
+// Rearrange, the predictions are sorted so that a larger quantile
+// never has a smaller prediction.
+func PredictQuantiles(modelInfo *ModelInfo, varVals map[string]float64) ([]QuantileValue, error) {
+
+	quantiles := make([]QuantileValue, len(modelInfo.Quantiles))
+	for idx, info := range modelInfo.Quantiles {
+		prediction := info.Intercept
+		for _, coeff := range info.Coefficients {
+			val, ok := varVals[coeff.Name]
+			if !ok {
+				return nil, fmt.Errorf("Expected a value for variable %s", coeff.Name)
+			}
+			prediction = prediction + coeff.Coefficient*val
+		}
+		quantiles[idx] = QuantileValue{Quantile: info.Quantile, Prediction: prediction}
+	}
+	sort.Slice(quantiles, func(i, j int) bool { return quantiles[i].Quantile < quantiles[j].Quantile })
+
+	if modelInfo.Rearrange {
+		predictions := make([]float64, len(quantiles))
+		for idx, q := range quantiles {
+			predictions[idx] = q.Prediction
+		}
+		sort.Float64s(predictions)
+		for idx := range quantiles {
+			quantiles[idx].Prediction = predictions[idx]
+		}
+	}
+
+	return quantiles, nil
+}
+
+// Project returns the names and values of the principal components of
+// a row of the projection's columns. The components are named PC1,
+// PC2 and so on.
+func (p *PCA) Project(row []float64) ([]string, []float64, error) {
+
+	if len(row) != len(p.Columns) {
+		return nil, nil, fmt.Errorf("expected %d values for the projection, got %d", len(p.Columns), len(row))
+	}
+
+	centered := make([]float64, len(row))
+	for j, v := range row {
+		centered[j] = v - p.Means[j]
+		if p.Scales != nil {
+			centered[j] /= p.Scales[j]
+		}
+	}
+
+	names := make([]string, len(p.Components))
+	values := make([]float64, len(p.Components))
+	for k, comp := range p.Components {
+		names[k] = fmt.Sprintf("PC%d", k+1)
+		for j, c := range comp {
+			values[k] += centered[j] * c
+		}
+		if p.Whiten {
+			if p.Variances[k] <= 0 {
+				return nil, nil, fmt.Errorf("component %d has no variance and cannot be whitened", k+1)
+			}
+			values[k] /= math.Sqrt(p.Variances[k])
+		}
+	}
+
+	return names, values, nil
+}
+
+// Intervals calculates the confidence interval for the mean response and
+// the prediction interval for a new observation at the given values:
+//
+//	ŷ ± t·√(σ² x₀ᵀ(XᵀX)⁻¹x₀)
+//	ŷ ± t·√(σ² (1 + x₀ᵀ(XᵀX)⁻¹x₀))
+func Intervals(cov *CovarianceInfo, varVals map[string]float64, prediction, level float64) (*Interval, *Interval, error) {
+
+	if level <= 0 || level >= 1 {
+		return nil, nil, errors.New("interval level must be between 0 and 1")
+	}
+	if len(cov.XTXInverse) != len(cov.Terms) || cov.DFResidual < 1 {
+		return nil, nil, errors.New("invalid covariance information in the model")
+	}
+
+	// Build x₀ with a one for the intercept.
+	x0 := make([]float64, len(cov.Terms))
+	for j, term := range cov.Terms {
+		if term == "intercept" {
+			x0[j] = 1
+			continue
+		}
+		val, ok := varVals[term]
+		if !ok {
+			return nil, nil, fmt.Errorf("Expected a value for variable %s", term)
+		}
+		x0[j] = val
+	}
+
+	// Calculate x₀ᵀ(XᵀX)⁻¹x₀.
+	var leverage float64
+	for j, row := range cov.XTXInverse {
+		if len(row) != len(x0) {
+			return nil, nil, errors.New("invalid covariance information in the model")
+		}
+		for k, v := range row {
+			leverage += x0[j] * v * x0[k]
+		}
+	}
+
+	t := distuv.StudentsT{Mu: 0, Sigma: 1, Nu: float64(cov.DFResidual)}
+	tCrit := t.Quantile(1 - (1-level)/2)
+
+	seMean := math.Sqrt(cov.ResidualVariance * leverage)
+	sePred := math.Sqrt(cov.ResidualVariance * (1 + leverage))
+
+	ci := &Interval{Lower: prediction - tCrit*seMean, Upper: prediction + tCrit*seMean}
+	pi := &Interval{Lower: prediction - tCrit*sePred, Upper: prediction + tCrit*sePred}
+
+	return ci, pi, nil
+}
+
+// Expand generates the names and values of the expanded features from
+// the raw input values. The features are the polynomial or spline terms
+// of each input in turn, followed by the interaction terms.
+func Expand(e *Expansion, raw map[string]float64) ([]string, []float64, error) {
+
+	if e.Degree < 1 {
+		return nil, nil, errors.New("the degree must be at least 1")
+	}
+
+	knots := make(map[string][]float64)
+	for _, s := range e.Splines {
+		knots[s.Input] = s.Knots
+	}
+
+	var names []string
+	var values []float64
+	xs := make([]float64, len(e.Inputs))
+	for i, input := range e.Inputs {
+		x, ok := raw[input]
+		if !ok {
+			return nil, nil, fmt.Errorf("expected a value for input %s", input)
+		}
+		xs[i] = x
+
+		// Add the spline basis, which is linear in x beyond the
+		// boundary knots.
+		if k, ok := knots[input]; ok {
+			basis, err := naturalSpline(x, k)
+			if err != nil {
+				return nil, nil, fmt.Errorf("spline for %s: %v", input, err)
+			}
+			names = append(names, input)
+			values = append(values, x)
+			for b, v := range basis {
+				names = append(names, fmt.Sprintf("ns(%s,%d)", input, b+1))
+				values = append(values, v)
+			}
+			continue
+		}
+
+		// Add the polynomial terms.
+		for d := 1; d <= e.Degree; d++ {
+			name := input
+			if d > 1 {
+				name = fmt.Sprintf("%s^%d", input, d)
+			}
+			names = append(names, name)
+			values = append(values, math.Pow(x, float64(d)))
+		}
+	}
+
+	// Add the products of each pair, or of each subset of two or
+	// more, of the raw inputs.
+	var maxOrder int
+	switch e.Interactions {
+	case "", "none":
+	case "pairwise":
+		maxOrder = 2
+	case "all":
+		maxOrder = len(e.Inputs)
+	default:
+		return nil, nil, fmt.Errorf("unknown interactions %s", e.Interactions)
+	}
+
+	for order := 2; order <= maxOrder; order++ {
+		for _, subset := range combinations(len(e.Inputs), order) {
+			product := 1.0
+			parts := make([]string, len(subset))
+			for p, i := range subset {
+				product *= xs[i]
+				parts[p] = e.Inputs[i]
+			}
+			names = append(names, strings.Join(parts, "*"))
+			values = append(values, product)
+		}
+	}
+
+	return names, values, nil
+}
+
+// naturalSpline returns the nonlinear terms of the natural cubic spline
+// basis with the given knots, which together with x itself span the
+// cubic splines that are linear beyond the boundary knots:
+//
+//	d_k(x) = ((x-ξ_k)³₊ - (x-ξ_K)³₊) / (ξ_K - ξ_k)
+//	N_k(x) = d_k(x) - d_{K-1}(x),  k = 1, ..., K-2
+func naturalSpline(x float64, knots []float64) ([]float64, error) {
+
+	n := len(knots)
+	if n < 3 {
+		return nil, errors.New("at least three knots are required")
+	}
+	for k := 1; k < n; k++ {
+		if knots[k] <= knots[k-1] {
+			return nil, errors.New("knots must be strictly increasing")
+		}
+	}
+
+	cube := func(v float64) float64 {
+		if v <= 0 {
+			return 0
+		}
+		return v * v * v
+	}
+	d := func(k int) float64 {
+		return (cube(x-knots[k]) - cube(x-knots[n-1])) / (knots[n-1] - knots[k])
+	}
+
+	basis := make([]float64, n-2)
+	last := d(n - 2)
+	for k := range basis {
+		basis[k] = d(k) - last
+	}
+
+	return basis, nil
+}
+
+// combinations returns the subsets of the given size of the
+// indices 0 to n-1, in lexicographic order.
+func combinations(n, size int) [][]int {
+
+	var out [][]int
+	subset := make([]int, size)
+	var build func(start, pos int)
+	build = func(start, pos int) {
+		if pos == size {
+			out = append(out, append([]int(nil), subset...))
+			return
+		}
+		for i := start; i < n; i++ {
+			subset[pos] = i
+			build(i+1, pos+1)
+		}
+	}
+	build(0, 0)
+
+	return out
+}
@@ -0,0 +1,628 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sajari/regression"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/mathext"
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// ModelInfo includes the information about the
+// model that is output from the training.
+type ModelInfo struct {
+	Intercept          float64           `json:"intercept"`
+	Coefficients       []CoefficientInfo `json:"coefficients"`
+	InterceptInference *Inference        `json:"intercept_inference,omitempty"`
+	Summary            *ModelSummary     `json:"summary,omitempty"`
+	Covariance         *CovarianceInfo   `json:"covariance,omitempty"`
+	PCA                *PCA              `json:"pca,omitempty"`
+}
+
+// PCA includes the parameters of a fitted principal component
+// analysis, which are saved with a model so that the same
+// projection can be applied at prediction time.
+type PCA struct {
+	Columns    []string    `json:"columns"`
+	Means      []float64   `json:"means"`
+	Scales     []float64   `json:"scales,omitempty"`
+	Components [][]float64 `json:"components"`
+	Variances  []float64   `json:"explained_variance"`
+	Ratios     []float64   `json:"explained_variance_ratio"`
+	Whiten     bool        `json:"whiten"`
+}
+
+// CovarianceInfo includes what is needed to calculate confidence and
+// prediction intervals at prediction time: the residual variance, its
+// degrees of freedom and (XᵀX)⁻¹, whose rows and columns follow Terms.
+type CovarianceInfo struct {
+	Terms            []string    `json:"terms"`
+	ResidualVariance float64     `json:"residual_variance"`
+	DFResidual       int         `json:"df_residual"`
+	XTXInverse       [][]float64 `json:"xtx_inverse"`
+}
+
+// CoefficientInfo include information about a
+// particular model coefficient.
+type CoefficientInfo struct {
+	Name        string     `json:"name"`
+	Coefficient float64    `json:"coefficient"`
+	Inference   *Inference `json:"inference,omitempty"`
+}
+
+// Inference includes the standard error, t-test and confidence
+// interval of a coefficient, along with the variance inflation
+// factor of its feature.
+type Inference struct {
+	StdError float64 `json:"std_error"`
+	TStat    float64 `json:"t_stat"`
+	PValue   float64 `json:"p_value"`
+	CILower  float64 `json:"ci_lower"`
+	CIUpper  float64 `json:"ci_upper"`
+	VIF      float64 `json:"vif,omitempty"`
+}
+
+// ModelSummary includes the goodness of fit statistics of the model.
+type ModelSummary struct {
+	Observations    int     `json:"observations"`
+	DFModel         int     `json:"df_model"`
+	DFResidual      int     `json:"df_residual"`
+	RSquared        float64 `json:"r_squared"`
+	AdjRSquared     float64 `json:"adj_r_squared"`
+	FStatistic      float64 `json:"f_statistic"`
+	FPValue         float64 `json:"f_p_value"`
+	LogLikelihood   float64 `json:"log_likelihood"`
+	AIC             float64 `json:"aic"`
+	BIC             float64 `json:"bic"`
+	ConditionNumber float64 `json:"condition_number"`
+	ConfidenceLevel float64 `json:"confidence_level"`
+}
+
+func main() {
+
+	// Declare the input and output directory flags.
+	inDirPtr := flag.String("inDir", "", "The directory containing the training data")
+	outDirPtr := flag.String("outDir", "", "The output directory")
+
+	// Declare the model flags.
+	inFilePtr := flag.String("inFile", "diabetes.csv", "The training data file in the input directory")
+	targetPtr := flag.String("target", "y", "The column to model")
+	featuresPtr := flag.String("features", "all-except", "Comma separated feature columns, or all-except[:col,...] to use every column except the target and those listed")
+	interceptPtr := flag.Bool("intercept", true, "Whether to fit an intercept")
+	levelPtr := flag.Float64("level", 0.95, "The confidence level of the coefficient intervals")
+	pcaPtr := flag.String("pca", "", "A fitted projection in the input directory, e.g. pca.json, to train on the principal components of its columns")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Open the training dataset file.
+	f, err := os.Open(filepath.Join(*inDirPtr, *inFilePtr))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	// Create a new CSV reader reading from the opened file.
+	reader := csv.NewReader(f)
+
+	// Read in all of the CSV records
+	trainingData, err := reader.ReadAll()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(trainingData) < 2 {
+		log.Fatal("expected a header and at least one training record")
+	}
+
+	// Find the target and feature columns from the header.
+	header := trainingData[0]
+	targetCol, err := columnIndex(header, *targetPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	features, err := parseFeatures(header, *targetPtr, *featuresPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Load the projection, whose columns are then used as the features.
+	var pca *PCA
+	if *pcaPtr != "" {
+		data, err := ioutil.ReadFile(filepath.Join(*inDirPtr, *pcaPtr))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := json.Unmarshal(data, &pca); err != nil {
+			log.Fatal(err)
+		}
+		features = pca.Columns
+	}
+
+	featureCols := make([]int, len(features))
+	for j, name := range features {
+		if featureCols[j], err = columnIndex(header, name); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Parse the target and feature values of each record.
+	var observed []float64
+	var variables [][]float64
+	for i, record := range trainingData[1:] {
+
+		yVal, err := strconv.ParseFloat(record[targetCol], 64)
+		if err != nil {
+			log.Fatalf("Parsing line %d failed: %v", i+2, err)
+		}
+
+		vars := make([]float64, len(featureCols))
+		for j, col := range featureCols {
+			vars[j], err = strconv.ParseFloat(record[col], 64)
+			if err != nil {
+				log.Fatalf("Parsing line %d failed: %v", i+2, err)
+			}
+		}
+
+		observed = append(observed, yVal)
+		variables = append(variables, vars)
+	}
+
+	// Project the features onto the principal components.
+	if pca != nil {
+		for i, vars := range variables {
+			if features, variables[i], err = pca.Project(vars); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	// Train the model.
+	var modelInfo ModelInfo
+	if *interceptPtr {
+		modelInfo, err = trainWithIntercept(*targetPtr, features, observed, variables)
+	} else {
+		modelInfo, err = trainThroughOrigin(features, observed, variables)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Add the coefficient inference and fit statistics.
+	if err := Summarize(&modelInfo, *interceptPtr, observed, variables, *levelPtr); err != nil {
+		log.Fatal(err)
+	}
+
+	// Save the projection with the model, so that the predictions
+	// project the raw features in the same way.
+	modelInfo.PCA = pca
+
+	// Output the trained model parameters to stdout, leaving out
+	// the intercept when none was fit.
+	var terms []string
+	if *interceptPtr {
+		terms = append(terms, fmt.Sprintf("%0.4f", modelInfo.Intercept))
+	}
+	for _, coeff := range modelInfo.Coefficients {
+		terms = append(terms, fmt.Sprintf("%s*%0.4f", coeff.Name, coeff.Coefficient))
+	}
+	formula := fmt.Sprintf("%s = %s", *targetPtr, strings.Join(terms, " + "))
+	fmt.Printf("\nRegression Formula:\n%s\n\n", formula)
+	fmt.Print(summaryTable(&modelInfo, *interceptPtr))
+
+	// Marshal the model information.
+	outputData, err := json.MarshalIndent(modelInfo, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Save the marshalled output to a file.
+	if err := ioutil.WriteFile(filepath.Join(*outDirPtr, "model.json"), outputData, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Project returns the names and values of the principal components of
+// a row of the projection's columns. The components are named PC1,
+// PC2 and so on.
+func (p *PCA) Project(row []float64) ([]string, []float64, error) {
+
+	if len(row) != len(p.Columns) {
+		return nil, nil, fmt.Errorf("expected %d values for the projection, got %d", len(p.Columns), len(row))
+	}
+
+	centered := make([]float64, len(row))
+	for j, v := range row {
+		centered[j] = v - p.Means[j]
+		if p.Scales != nil {
+			centered[j] /= p.Scales[j]
+		}
+	}
+
+	names := make([]string, len(p.Components))
+	values := make([]float64, len(p.Components))
+	for k, comp := range p.Components {
+		names[k] = fmt.Sprintf("PC%d", k+1)
+		for j, c := range comp {
+			values[k] += centered[j] * c
+		}
+		if p.Whiten {
+			if p.Variances[k] <= 0 {
+				return nil, nil, fmt.Errorf("component %d has no variance and cannot be whitened", k+1)
+			}
+			values[k] /= math.Sqrt(p.Variances[k])
+		}
+	}
+
+	return names, values, nil
+}
+
+// parseFeatures returns the feature names given by the features flag.
+func parseFeatures(header []string, target, spec string) ([]string, error) {
+
+	// Use every column except the target and any listed exclusions.
+	if spec == "all-except" || strings.HasPrefix(spec, "all-except:") {
+		excluded := map[string]bool{target: true}
+		for _, name := range splitNames(strings.TrimPrefix(strings.TrimPrefix(spec, "all-except"), ":")) {
+			if _, err := columnIndex(header, name); err != nil {
+				return nil, err
+			}
+			excluded[name] = true
+		}
+
+		var features []string
+		for _, name := range header {
+			if !excluded[name] {
+				features = append(features, name)
+			}
+		}
+		if len(features) == 0 {
+			return nil, errors.New("no feature columns remain")
+		}
+		return features, nil
+	}
+
+	features := splitNames(spec)
+	if len(features) == 0 {
+		return nil, errors.New("at least one feature is required")
+	}
+	for _, name := range features {
+		if name == target {
+			return nil, fmt.Errorf("the target %s cannot also be a feature", target)
+		}
+	}
+
+	return features, nil
+}
+
+// splitNames splits a comma separated list of column names.
+func splitNames(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// columnIndex returns the position of the named column in the header.
+func columnIndex(header []string, name string) (int, error) {
+	for i, h := range header {
+		if h == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("column %s not found in the header", name)
+}
+
+// trainWithIntercept fits the regression using github.com/sajari/regression,
+// with one variable per named feature.
+func trainWithIntercept(target string, features []string, observed []float64, variables [][]float64) (ModelInfo, error) {
+
+	// Create the regression value with the named variables.
+	var r regression.Regression
+	r.SetObserved(target)
+	for j, name := range features {
+		r.SetVar(j, name)
+	}
+
+	// Add the training data to the regression value.
+	for i, vars := range variables {
+		r.Train(regression.DataPoint(observed[i], vars))
+	}
+
+	// Train/fit the regression model.
+	if err := r.Run(); err != nil {
+		return ModelInfo{}, err
+	}
+
+	// Fill in the model information, where coefficient 0 is the intercept.
+	modelInfo := ModelInfo{Intercept: r.Coeff(0)}
+	for j, name := range features {
+		modelInfo.Coefficients = append(modelInfo.Coefficients, CoefficientInfo{
+			Name:        name,
+			Coefficient: r.Coeff(j + 1),
+		})
+	}
+
+	return modelInfo, nil
+}
+
+// trainThroughOrigin fits the regression without an intercept by least
+// squares, as github.com/sajari/regression always fits an intercept.
+func trainThroughOrigin(features []string, observed []float64, variables [][]float64) (ModelInfo, error) {
+
+	if len(observed) < len(features) {
+		return ModelInfo{}, errors.New("not enough training records for the number of features")
+	}
+
+	// Form the matrices for the least squares problem.
+	x := mat.NewDense(len(observed), len(features), nil)
+	for i, vars := range variables {
+		x.SetRow(i, vars)
+	}
+	y := mat.NewVecDense(len(observed), observed)
+
+	// Solve for the coefficients.
+	var beta mat.VecDense
+	if err := beta.SolveVec(x, y); err != nil {
+		return ModelInfo{}, err
+	}
+
+	// Fill in the model information.
+	var modelInfo ModelInfo
+	for j, name := range features {
+		modelInfo.Coefficients = append(modelInfo.Coefficients, CoefficientInfo{
+			Name:        name,
+			Coefficient: beta.AtVec(j),
+		})
+	}
+
+	return modelInfo, nil
+}
+
+// Summarize calculates the OLS inference for each coefficient of the
+// model and its fit statistics, using the QR decomposition of the
+// design matrix for (XᵀX)⁻¹. The results, along with the residual
+// variance and (XᵀX)⁻¹ themselves, are added to the model information.
+func Summarize(modelInfo *ModelInfo, intercept bool, observed []float64, variables [][]float64, level float64) error {
+
+	if level <= 0 || level >= 1 {
+		return errors.New("confidence level must be between 0 and 1")
+	}
+
+	// Form the design matrix, with a leading column of ones
+	// for the intercept.
+	n := len(observed)
+	offset := 0
+	if intercept {
+		offset = 1
+	}
+	p := len(modelInfo.Coefficients) + offset
+	if n <= p {
+		return errors.New("not enough training records for inference")
+	}
+
+	x := mat.NewDense(n, p, nil)
+	for i, vars := range variables {
+		if intercept {
+			x.Set(i, 0, 1)
+		}
+		for j, v := range vars {
+			x.Set(i, j+offset, v)
+		}
+	}
+
+	beta := make([]float64, p)
+	if intercept {
+		beta[0] = modelInfo.Intercept
+	}
+	for j, coeff := range modelInfo.Coefficients {
+		beta[j+offset] = coeff.Coefficient
+	}
+
+	// Calculate the residual sum of squares and the total sum of
+	// squares, which is centered only when there is an intercept.
+	var sse, sst float64
+	mean := stat.Mean(observed, nil)
+	for i, y := range observed {
+		pred := mat.Dot(x.RowView(i), mat.NewVecDense(p, beta))
+		sse += (y - pred) * (y - pred)
+		if intercept {
+			sst += (y - mean) * (y - mean)
+		} else {
+			sst += y * y
+		}
+	}
+
+	dfResid := n - p
+	dfModel := p - offset
+	sigma2 := sse / float64(dfResid)
+
+	// (XᵀX)⁻¹ = R⁻¹R⁻ᵀ from the QR decomposition X = QR.
+	var qr mat.QR
+	qr.Factorize(x)
+
+	var rFull mat.Dense
+	qr.RTo(&rFull)
+
+	var rInv mat.Dense
+	if err := rInv.Inverse(rFull.Slice(0, p, 0, p)); err != nil {
+		return fmt.Errorf("the features are collinear: %v", err)
+	}
+
+	var xtxInv mat.Dense
+	xtxInv.Mul(&rInv, rInv.T())
+
+	// Calculate the inference for each coefficient.
+	t := distuv.StudentsT{Mu: 0, Sigma: 1, Nu: float64(dfResid)}
+	tCrit := t.Quantile(1 - (1-level)/2)
+
+	inference := make([]*Inference, p)
+	for j := range inference {
+		se := math.Sqrt(sigma2 * xtxInv.At(j, j))
+		tStat := beta[j] / se
+		inference[j] = &Inference{
+			StdError: se,
+			TStat:    tStat,
+			PValue:   2 * t.Survival(math.Abs(tStat)),
+			CILower:  beta[j] - tCrit*se,
+			CIUpper:  beta[j] + tCrit*se,
+		}
+	}
+
+	// Calculate the variance inflation factor of each feature by
+	// regressing it on the other columns of the design matrix.
+	for j := offset; j < p; j++ {
+		vif, err := varianceInflation(x, j, intercept)
+		if err != nil {
+			return err
+		}
+		inference[j].VIF = vif
+	}
+
+	if intercept {
+		modelInfo.InterceptInference = inference[0]
+	}
+	for j := range modelInfo.Coefficients {
+		modelInfo.Coefficients[j].Inference = inference[j+offset]
+	}
+
+	// Calculate the fit statistics.
+	nf := float64(n)
+	logLikelihood := -nf / 2 * (math.Log(2*math.Pi) + math.Log(sse/nf) + 1)
+	summary := &ModelSummary{
+		Observations:    n,
+		DFModel:         dfModel,
+		DFResidual:      dfResid,
+		RSquared:        1 - sse/sst,
+		AdjRSquared:     1 - (sse/float64(dfResid))/(sst/float64(n-offset)),
+		LogLikelihood:   logLikelihood,
+		AIC:             -2*logLikelihood + 2*float64(p),
+		BIC:             -2*logLikelihood + math.Log(nf)*float64(p),
+		ConditionNumber: mat.Cond(x, 2),
+		ConfidenceLevel: level,
+	}
+	if dfModel > 0 {
+		summary.FStatistic = ((sst - sse) / float64(dfModel)) / sigma2
+
+		// Use the regularized incomplete beta function directly, as
+		// 1 - CDF loses the small p-values of strong fits.
+		d1, d2 := float64(dfModel), float64(dfResid)
+		summary.FPValue = mathext.RegIncBeta(d2/2, d1/2, d2/(d2+d1*summary.FStatistic))
+	}
+	modelInfo.Summary = summary
+
+	// Save the residual variance and (XᵀX)⁻¹ for the intervals
+	// of the predictions.
+	covariance := &CovarianceInfo{
+		ResidualVariance: sigma2,
+		DFResidual:       dfResid,
+		XTXInverse:       make([][]float64, p),
+	}
+	if intercept {
+		covariance.Terms = append(covariance.Terms, "intercept")
+	}
+	for _, coeff := range modelInfo.Coefficients {
+		covariance.Terms = append(covariance.Terms, coeff.Name)
+	}
+	for j := range covariance.XTXInverse {
+		covariance.XTXInverse[j] = mat.Row(nil, j, &xtxInv)
+	}
+	modelInfo.Covariance = covariance
+
+	return nil
+}
+
+// varianceInflation calculates 1 / (1 - R²) of the regression of column
+// j of the design matrix on its other columns.
+func varianceInflation(x *mat.Dense, j int, intercept bool) (float64, error) {
+
+	n, p := x.Dims()
+	if p == 1 {
+		return 1, nil
+	}
+
+	others := mat.NewDense(n, p-1, nil)
+	for i := 0; i < n; i++ {
+		col := 0
+		for k := 0; k < p; k++ {
+			if k != j {
+				others.Set(i, col, x.At(i, k))
+				col++
+			}
+		}
+	}
+	y := mat.NewVecDense(n, mat.Col(nil, j, x))
+
+	var beta, fitted mat.VecDense
+	if err := beta.SolveVec(others, y); err != nil {
+		return 0, err
+	}
+	fitted.MulVec(others, &beta)
+
+	// The R² is uncentered when the model has no intercept.
+	var sse, sst float64
+	mean := stat.Mean(y.RawVector().Data, nil)
+	for i := 0; i < n; i++ {
+		v := y.AtVec(i)
+		sse += (v - fitted.AtVec(i)) * (v - fitted.AtVec(i))
+		if intercept {
+			sst += (v - mean) * (v - mean)
+		} else {
+			sst += v * v
+		}
+	}
+
+	return sst / sse, nil
+}
+
+// summaryTable formats the coefficient inference and fit
+// statistics as a table.
+func summaryTable(modelInfo *ModelInfo, intercept bool) string {
+
+	s := modelInfo.Summary
+	lowerPct := 100 * (1 - s.ConfidenceLevel) / 2
+	upperPct := 100 - lowerPct
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Observations: %d, Df model: %d, Df residuals: %d\n", s.Observations, s.DFModel, s.DFResidual)
+	fmt.Fprintf(&b, "R^2: %0.4f, Adjusted R^2: %0.4f\n", s.RSquared, s.AdjRSquared)
+	fmt.Fprintf(&b, "F-statistic: %0.4f, Prob (F-statistic): %0.4g\n", s.FStatistic, s.FPValue)
+	fmt.Fprintf(&b, "Log-likelihood: %0.4f, AIC: %0.4f, BIC: %0.4f\n", s.LogLikelihood, s.AIC, s.BIC)
+	fmt.Fprintf(&b, "Condition number: %0.4g\n\n", s.ConditionNumber)
+
+	fmt.Fprintf(&b, "%-12s %12s %12s %10s %10s %12s %12s %8s\n", "", "coef", "std err", "t", "P>|t|",
+		fmt.Sprintf("[%0.3g%%", lowerPct), fmt.Sprintf("%0.4g%%]", upperPct), "VIF")
+	row := func(name string, coef float64, inf *Inference) {
+		vif := ""
+		if inf.VIF != 0 {
+			vif = fmt.Sprintf("%0.3f", inf.VIF)
+		}
+		fmt.Fprintf(&b, "%-12s %12.4f %12.4f %10.3f %10.4f %12.4f %12.4f %8s\n", name, coef, inf.StdError,
+			inf.TStat, inf.PValue, inf.CILower, inf.CIUpper, vif)
+	}
+	if intercept {
+		row("intercept", modelInfo.Intercept, modelInfo.InterceptInference)
+	}
+	for _, coeff := range modelInfo.Coefficients {
+		row(coeff.Name, coeff.Coefficient, coeff.Inference)
+	}
+	b.WriteString("\n")
+
+	return b.String()
+}
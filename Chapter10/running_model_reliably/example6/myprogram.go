@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// ForestModel includes the information about the fitted
+// forest that is output from the training.
+type ForestModel struct {
+	Criterion   string           `json:"criterion"`
+	Target      string           `json:"target"`
+	Classes     []string         `json:"classes,omitempty"`
+	Features    []FeatureInfo    `json:"features"`
+	MaxFeatures int              `json:"max_features"`
+	OOBError    float64          `json:"oob_error"`
+	Importances []ImportanceInfo `json:"importances"`
+	Trees       []*Node          `json:"trees"`
+}
+
+// ImportanceInfo includes the importance of a feature as its share of
+// the impurity decrease of the splits, and as the increase of the
+// out-of-bag error when its values are permuted.
+type ImportanceInfo struct {
+	Feature     string  `json:"feature"`
+	Impurity    float64 `json:"impurity"`
+	Permutation float64 `json:"permutation"`
+}
+
+// FeatureInfo describes a feature column. The values of a
+// categorical feature are one of its levels.
+type FeatureInfo struct {
+	Name        string   `json:"name"`
+	Categorical bool     `json:"categorical"`
+	Levels      []string `json:"levels,omitempty"`
+}
+
+// Node is a node of the tree. Rows go left when their value of Feature
+// is at most Threshold or, for a categorical feature, is one of
+// Categories. Leaves have no children and predict Value, which for
+// classification is the index of Class, with Distribution holding the
+// proportion of each class.
+type Node struct {
+	Feature      string    `json:"feature,omitempty"`
+	Threshold    float64   `json:"threshold,omitempty"`
+	Categories   []string  `json:"categories,omitempty"`
+	Left         *Node     `json:"left,omitempty"`
+	Right        *Node     `json:"right,omitempty"`
+	Value        float64   `json:"value"`
+	Class        string    `json:"class,omitempty"`
+	Distribution []float64 `json:"distribution,omitempty"`
+	Samples      int       `json:"samples"`
+	Impurity     float64   `json:"impurity"`
+}
+
+// PredictionData includes the data necessary to make a prediction and
+// encodes the output prediction. For classification forests Prediction
+// is the index of Class, and Probabilities holds the mean of the class
+// distributions of the trees.
+type PredictionData struct {
+	Prediction      float64            `json:"prediction"`
+	Class           string             `json:"class,omitempty"`
+	Probabilities   map[string]float64 `json:"probabilities,omitempty"`
+	IndependentVars []IndependentVar   `json:"independent_variables"`
+}
+
+// IndependentVar include information about and a value for an
+// independent variable, which is Category for categorical features.
+type IndependentVar struct {
+	Name     string  `json:"name"`
+	Value    float64 `json:"value"`
+	Category string  `json:"category,omitempty"`
+}
+
+func main() {
+
+	// Declare the input and output directory flags.
+	inModelDirPtr := flag.String("inModelDir", "", "The directory containing the model.")
+	inVarDirPtr := flag.String("inVarDir", "", "The directory containing the input attributes.")
+	outDirPtr := flag.String("outDir", "", "The output directory")
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Load the model file.
+	f, err := ioutil.ReadFile(filepath.Join(*inModelDirPtr, "forest.json"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Unmarshal the forest.
+	var model ForestModel
+	if err := json.Unmarshal(f, &model); err != nil {
+		log.Fatal(err)
+	}
+
+	// Walk over files in the input.
+	if err := filepath.Walk(*inVarDirPtr, func(path string, info os.FileInfo, err error) error {
+
+		// Skip any directories.
+		if info.IsDir() {
+			return nil
+		}
+
+		// Open any files.
+		f, err := ioutil.ReadFile(filepath.Join(*inVarDirPtr, info.Name()))
+		if err != nil {
+			return err
+		}
+
+		// Unmarshal the independent variables.
+		var predictionData PredictionData
+		if err := json.Unmarshal(f, &predictionData); err != nil {
+			return err
+		}
+
+		// Make the prediction.
+		if err := Predict(&model, &predictionData); err != nil {
+			return err
+		}
+
+		// Marshal the prediction data.
+		outputData, err := json.MarshalIndent(predictionData, "", "    ")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Save the marshalled output to a file.
+		if err := ioutil.WriteFile(filepath.Join(*outDirPtr, info.Name()), outputData, 0644); err != nil {
+			log.Fatal(err)
+		}
+
+		return nil
+	}); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Predict makes a prediction based on input JSON by combining
+// the predictions of each tree of the forest.
+func Predict(model *ForestModel, predictionData *PredictionData) error {
+
+	if len(model.Trees) == 0 {
+		return errors.New("the model has no trees")
+	}
+
+	// Create a map of the independent variables.
+	varVals := make(map[string]IndependentVar)
+	for _, indVar := range predictionData.IndependentVars {
+		varVals[indVar.Name] = indVar
+	}
+
+	categorical := make(map[string]bool)
+	for _, feature := range model.Features {
+		categorical[feature.Name] = feature.Categorical
+	}
+
+	// Check that each categorical variable gives one of the levels
+	// seen in the training, as any other category would silently
+	// go right at every split.
+	for _, feature := range model.Features {
+		indVar, ok := varVals[feature.Name]
+		if !feature.Categorical || !ok {
+			continue
+		}
+		if indVar.Category == "" {
+			return fmt.Errorf("Expected a category for variable %s", feature.Name)
+		}
+		known := false
+		for _, level := range feature.Levels {
+			if indVar.Category == level {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("Category %s of variable %s was not seen in the training", indVar.Category, feature.Name)
+		}
+	}
+
+	// Sum the predictions of the trees.
+	var sum float64
+	distribution := make([]float64, len(model.Classes))
+	for _, tree := range model.Trees {
+		leaf, err := predictTree(tree, varVals, categorical)
+		if err != nil {
+			return err
+		}
+		sum += leaf.Value
+		for c, p := range leaf.Distribution {
+			if c < len(distribution) {
+				distribution[c] += p
+			}
+		}
+	}
+
+	// Average the predictions, taking the most
+	// probable class for classification.
+	if model.Classes == nil {
+		predictionData.Prediction = sum / float64(len(model.Trees))
+		return nil
+	}
+
+	best := 0
+	predictionData.Probabilities = make(map[string]float64)
+	for c, class := range model.Classes {
+		predictionData.Probabilities[class] = distribution[c] / float64(len(model.Trees))
+		if distribution[c] > distribution[best] {
+			best = c
+		}
+	}
+	predictionData.Prediction = float64(best)
+	predictionData.Class = model.Classes[best]
+
+	return nil
+}
+
+// predictTree returns the leaf of a tree that the independent
+// variables fall into. Categories not seen in the training are
+// rejected by Predict before the trees are walked.
+func predictTree(node *Node, varVals map[string]IndependentVar, categorical map[string]bool) (*Node, error) {
+
+	for node.Left != nil {
+
+		// Get the variable value.
+		indVar, ok := varVals[node.Feature]
+		if !ok {
+			return nil, fmt.Errorf("Expected a value for variable %s", node.Feature)
+		}
+
+		left := false
+		if categorical[node.Feature] {
+			for _, category := range node.Categories {
+				if indVar.Category == category {
+					left = true
+					break
+				}
+			}
+		} else {
+			left = indVar.Value <= node.Threshold
+		}
+
+		if left {
+			node = node.Left
+		} else {
+			node = node.Right
+		}
+		if node == nil {
+			return nil, errors.New("the tree is missing a child node")
+		}
+	}
+
+	return node, nil
+}